@@ -3,7 +3,7 @@ module github.com/clickonetwo/automations/airtable/inquiries-migration
 go 1.23.3
 
 require (
-	github.com/deckarep/golang-set/v2 v2.6.0
+	github.com/clickonetwo/automations/phonenum v0.1.0
 	github.com/go-test/deep v1.1.1
 	github.com/spf13/cobra v1.8.1
 	golang.org/x/text v0.21.0
@@ -13,3 +13,4 @@ require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 )
+
@@ -11,35 +11,10 @@ import (
 	"regexp"
 	"strings"
 
-	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/clickonetwo/automations/phonenum"
 )
 
 var (
-	nonDigitsOnly        = regexp.MustCompile(`\D+`)
-	spacesDashesOnly     = regexp.MustCompile(`[-—‑\s]+`)
-	zone1NumberFront     = regexp.MustCompile(`^\s*(\(\d{3}\)\s*\d{3}(?:\s*-?\s*)\d{4})(?:\D|$)`)
-	zone1Plus1           = regexp.MustCompile(`^\(\+?0?0?1\)(\(\d{3}\)\d{3}\d{4})(?:\D|$)`)
-	zone1AreaFront       = regexp.MustCompile(`^(\(\d{3}\)\(\d{3}\)\d{4})(\D|$)`)
-	zone1DoubleArea      = regexp.MustCompile(`^\((\d{3})\)(\((\d{3})\)\d{3}\d{4})(?:\D|$)`)
-	zone1AreaZipArea     = regexp.MustCompile(`^\((\d{3})\)\(\d{5}\)(?:\+?0?0?1)?(\(?(\d{3})\)?\d{3}\d{4})(?:\D|$)`)
-	zone1ZipArea         = regexp.MustCompile(`^\(\+?0?0?1\)\(\d{5}\)(?:\+?0?0?1)?(\(?\d{3}\)?\d{3}\d{4})(?:\D|$)`)
-	zone1ZipFront        = regexp.MustCompile(`^\(\d{5}\)(\(\d{3}\)\d{3}\d{4})(?:\D|$)`)
-	zone1ZipDouble       = regexp.MustCompile(`^\(\d{5}\)\(\d{5}\)(?:\+?0?0?1)?(\(?\d{3}\)?\d{3}\d{4})(?:\D|$)`)
-	zone1DigitsOnly      = regexp.MustCompile(`^(?:\+?1)?(\(?\d{3}\)?\d{7})(?:\D|$)`)
-	zone1AreaTenDigits   = regexp.MustCompile(`^\([0+]?0?1?\)\((?:1|\d{3})\)(\d{10})(?:\D|$)`)
-	intlPlus             = regexp.MustCompile(`(^\(?\+0?0?[2-9]\d\d?\)?\(?\d+\)?\d+)(?:\D|$)`)
-	intlNonPlus          = regexp.MustCompile(`(^\(0?[2-9]\d\d?\)\(?\d+\)?\d+)(?:\D|$)`)
-	intlDialingPrefix    = regexp.MustCompile(`^\(011\)(\(?\d+\)?\d+)(?:\D|$)`)
-	twoDigitCountryCodes = mapset.NewSet(
-		"20", "27",
-		"30", "31", "32", "33", "34", "36", "39",
-		"40", "41", "43", "44", "45", "46", "47", "48", "49",
-		"51", "52", "53", "54", "55", "56", "57", "58",
-		"60", "61", "62", "63", "64", "65", "66",
-		"70", "71", "72", "73", "74", "75", "76", "77", "78", "79",
-		"81", "82", "84", "86", "87", "88",
-		"90", "91", "92", "93", "94", "95", "98",
-	)
 	statesAndAbbreviations = map[string]string{
 		"Alabama":              "AL",
 		"Alaska":               "AK",
@@ -106,18 +81,13 @@ func cleanField(fromCol, val string, toRow map[string]string) error {
 		}
 		fallthrough
 	case "Phone Number":
-		phone := findValidPhone(val)
-		if phone == "" {
+		if phone, ok := phonenum.Extract(val); !ok {
 			// can't be cleaned
 			toRow["E.164 number"] = ""
 			toRow["Phone"] = val
 		} else {
-			toRow["E.164 number"] = phone
-			f, err := formatE164(phone)
-			if err != nil {
-				return err
-			}
-			toRow["Phone"] = f
+			toRow["E.164 number"] = phone.E164
+			toRow["Phone"] = phone.Format()
 		}
 	case "State / Province":
 		toRow["Migrated State"] = val
@@ -155,114 +125,6 @@ func cleanField(fromCol, val string, toRow map[string]string) error {
 	return nil
 }
 
-func findValidPhone(s string) string {
-	if match := zone1NumberFront.FindStringSubmatch(s); match != nil {
-		return makeE164(spacesDashesOnly.ReplaceAllString(match[1], ""), true)
-	}
-	ns := spacesDashesOnly.ReplaceAllString(s, "")
-	if ns == "" {
-		return ""
-	}
-	if match := zone1Plus1.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], true)
-	}
-	if match := zone1AreaFront.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], true)
-	}
-	if match := zone1DoubleArea.FindStringSubmatch(ns); match != nil && match[1] == match[3] {
-		return makeE164(match[2], true)
-	}
-	if match := zone1AreaZipArea.FindStringSubmatch(ns); match != nil && match[1] == match[3] {
-		return makeE164(match[2], true)
-	}
-	if match := zone1ZipArea.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], true)
-	}
-	if match := zone1ZipFront.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], true)
-	}
-	if match := zone1ZipDouble.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], true)
-	}
-	if match := zone1DigitsOnly.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], true)
-	}
-	if match := zone1AreaTenDigits.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], true)
-	}
-	if match := intlPlus.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], false)
-	}
-	if match := intlNonPlus.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], false)
-	}
-	if match := intlDialingPrefix.FindStringSubmatch(ns); match != nil {
-		return makeE164(match[1], false)
-	}
-	return ""
-}
-
-func makeE164(s string, z1 bool) string {
-	do := nonDigitsOnly.ReplaceAllString(s, "")
-	if z1 {
-		if strings.HasPrefix(s, "1") {
-			return "+" + do
-		}
-		return "+1" + do
-	}
-	// international
-	// strip leading 0*1*
-	for do[0] == '0' || do[0] == '1' {
-		do = do[1:]
-	}
-	// find country code
-	cc, rest := do[:2], do[2:]
-	if !twoDigitCountryCodes.Contains(cc) {
-		cc, rest = do[:3], do[3:]
-	}
-	// strip leading 0*1*
-	for rest[0] == '0' || rest[0] == '1' {
-		rest = rest[1:]
-	}
-	// remove duplicated country code
-	if strings.HasPrefix(rest, cc) {
-		rest = rest[len(cc):]
-	}
-	if len(rest) < 5 {
-		return ""
-	}
-	return "+" + cc + rest
-}
-
-func formatE164(phone string) (string, error) {
-	if strings.HasPrefix(phone, "+1") {
-		// Zone 1
-		if len(phone) != 12 {
-			return "", fmt.Errorf("invalid zone 1 phone (length %d): %q", len(phone), phone)
-		}
-		return fmt.Sprintf("(%s) %s-%s", phone[2:5], phone[5:8], phone[8:12]), nil
-	} else if strings.HasPrefix(phone, "+") {
-		if len(phone) < 10 || len(phone) > 16 {
-			return "", fmt.Errorf("invalid international phone (length %d): %q", len(phone), phone)
-		}
-		// international, separate the country code
-		prefix, suffix := phone[1:3], phone[3:]
-		if !twoDigitCountryCodes.Contains(prefix) {
-			prefix, suffix = phone[1:4], phone[4:]
-		}
-		var suffixSuffix string
-		if len(suffix)%3 == 1 {
-			// put last 4 together
-			suffix, suffixSuffix = suffix[:len(suffix)-4], "-"+suffix[len(suffix)-4:]
-		}
-		for i := len(suffix); i > 3; i = i - 3 {
-			suffix = suffix[0:i-3] + "-" + suffix[i-3:]
-		}
-		return fmt.Sprintf("(+%s) %s%s", prefix, suffix, suffixSuffix), nil
-	}
-	return "", fmt.Errorf("invalid E164 phone (no +): %q", phone)
-}
-
 func preferredLanguage(s string) string {
 	s = strings.ToLower(strings.TrimSpace(s))
 	if strings.HasPrefix(s, "en") || strings.HasPrefix(s, "in") {
@@ -11,6 +11,9 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/clickonetwo/automations/phonenum"
+	"github.com/clickonetwo/automations/phonenum/phonetest"
 )
 
 func TestCleanupPhones(t *testing.T) {
@@ -21,13 +24,13 @@ func TestCleanupPhones(t *testing.T) {
 	clean := make(map[string]string)
 	dirty := make([]string, 0, 20)
 	for _, phone := range phones {
-		valid := findValidPhone(phone)
-		if valid == "" {
+		valid, ok := phonenum.Extract(phone)
+		if !ok {
 			if strings.TrimSpace(phone) != "" {
 				dirty = append(dirty, phone)
 			}
 		} else {
-			clean[phone] = valid
+			clean[phone] = valid.String()
 		}
 	}
 	exportJsonToPath(clean, "/tmp/clean-phones.json")
@@ -37,6 +40,23 @@ func TestCleanupPhones(t *testing.T) {
 	}
 }
 
+func TestCleanPhoneCorpus(t *testing.T) {
+	for _, test := range phonetest.Load().Extract {
+		row := make(map[string]string)
+		if err := cleanField("Phone Number", test.Input, row); err != nil {
+			t.Fatal(err)
+		}
+		expected := phonenum.Number{E164: test.E164, Extension: test.Ext}
+		if row["E.164 number"] != test.E164 {
+			t.Errorf("%q: got E.164 number %q, expected %q", test.Input, row["E.164 number"], test.E164)
+		} else if test.E164 == "" && row["Phone"] != test.Input {
+			t.Errorf("%q: got phone %q, expected it unchanged", test.Input, row["Phone"])
+		} else if test.E164 != "" && row["Phone"] != expected.Format() {
+			t.Errorf("%q: got phone %q, expected %q", test.Input, row["Phone"], expected.Format())
+		}
+	}
+}
+
 func TestCleanupStates(t *testing.T) {
 	states, err := ExtractOneFieldFromFile("../../local/all-inquiries-table.csv", "State / Province")
 	if err != nil {
@@ -5,6 +5,8 @@
  */
 
 // takes a phone in E.164 format and formats it for display
+// (Airtable scripts can't use the Go phonenum module, so this is
+// a simplified version of its formatting; the Go tools use phonenum.)
 function formatPhone(phone) {
     const twoDigitCountryCodes = [
         "20", "27", "30", "31", "32", "33", "34", "36", "39",
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+	"github.com/clickonetwo/automations/dialpad/internal/users"
+)
+
+// accountsCmd represents the accounts command
+var accountsCmd = &cobra.Command{
+	Use:   "accounts [flags] path_to_csv",
+	Short: "Download contacts from all accounts",
+	Long: `Downloads the company contacts and the private contacts of every
+user and office account to a local spreadsheet. Each contact is tagged
+with its scope ("company", "user", or "office") and, for private
+contacts, the ID and name of the account that owns it.
+
+With --duplicates, the people who are stored in more than one account
+(or in an account and the company contacts) are also exported, using
+the same path but with a ".duplicates.csv" suffix.
+
+To share private contacts with everyone, edit the spreadsheet down to
+the contacts you want to share and give it to the promote command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		dupCount, _ := cmd.Flags().GetCount("duplicates")
+		minScore, _ := cmd.Flags().GetInt("min-score")
+		downloadAccounts(args[0], dupCount > 0, minScore)
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(accountsCmd)
+
+	accountsCmd.Args = cobra.ExactArgs(1)
+	accountsCmd.Flags().Count("duplicates", "Also export people stored in several accounts")
+	accountsCmd.Flags().Int("min-score", contacts.SharedEmailScore, "Ignore evidence of duplication scoring below this")
+}
+
+func downloadAccounts(path string, duplicates bool, minScore int) {
+	err := storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the Dialpad API key")
+	}
+	defer storage.PopConfig()
+	accounts := fetchAccounts()
+	ctx, stop := interruptContext()
+	defer stop()
+	entries, errs := contacts.ListAccountContacts(ctx, accounts)
+	if errs != nil {
+		log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+		if entries == nil {
+			log.Fatalf("Can't download the company contacts")
+		}
+		path = strings.TrimSuffix(path, ".csv") + ".partial.csv"
+	}
+	applySavedExtensions(entries)
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		counts[entry.Scope]++
+	}
+	log.Printf("Found %d company, %d user, and %d office contacts",
+		counts[contacts.CompanyScope], counts[contacts.UserScope], counts[contacts.OfficeScope])
+	if err := contacts.ExportAccountContacts(entries, accounts, path); err != nil {
+		log.Fatalf("Could not write file at path %s: %v", path, err)
+	}
+	log.Printf("Saved all %d contacts to %s", len(entries), path)
+	if !duplicates {
+		return
+	}
+	groups := contacts.FindCrossAccountDuplicates(entries, minScore)
+	if len(groups) == 0 {
+		log.Printf("There is nobody stored in more than one account")
+		return
+	}
+	dupesPath := strings.TrimSuffix(path, ".csv") + ".duplicates.csv"
+	if err := contacts.ExportAccountDuplicates(groups, accounts, dupesPath); err != nil {
+		log.Fatalf("Can't export to %q: %v", dupesPath, err)
+	}
+	log.Printf("%d people stored in more than one account are exported to %q", len(groups), dupesPath)
+}
+
+// fetchAccounts returns all the user and office accounts.
+func fetchAccounts() []contacts.Account {
+	log.Printf("Fetching users and offices from Dialpad...")
+	allUsers, err := users.FetchDialpadUsers()
+	if err != nil {
+		log.Fatalf("Dialpad user fetch failed: %v", err)
+	}
+	var accounts []contacts.Account
+	for _, user := range allUsers {
+		name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+		accounts = append(accounts, contacts.Account{Id: user.Id, Name: name, Scope: contacts.UserScope})
+	}
+	offices, err := contacts.FetchOffices()
+	if err != nil {
+		log.Fatalf("Dialpad office fetch failed: %v", err)
+	}
+	accounts = append(accounts, offices...)
+	log.Printf("Found %d users and %d offices", len(allUsers), len(offices))
+	return accounts
+}
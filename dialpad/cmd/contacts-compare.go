@@ -100,8 +100,53 @@ func compareById(left string, right string) {
 	}
 }
 
-func compareByNameAndPhone(_ string, _ string) {
-
+func compareByNameAndPhone(left string, right string) {
+	l, err := contacts.ImportContacts(left)
+	if err != nil {
+		log.Fatalf("Can't import from %q: %v", left, err)
+	}
+	r, err := contacts.ImportContacts(right)
+	if err != nil {
+		log.Fatalf("Can't import from %q: %v", right, err)
+	}
+	both, leftOnly, rightOnly, conflicts := contacts.CompareByNameAndPhone(l, r)
+	if len(both) > 0 {
+		bothPath := strings.TrimSuffix(left, ".csv") + ".both.csv"
+		if err := contacts.ExportUIDs(both, bothPath); err != nil {
+			log.Fatalf("Can't export to %q: %v", bothPath, err)
+		}
+		log.Printf("The UIDs of %d contacts matched in left and right are exported to %q", len(both), bothPath)
+	} else {
+		log.Printf("There were no contacts matched in left and right inputs")
+	}
+	if len(leftOnly) > 0 {
+		leftOnlyPath := strings.TrimSuffix(left, ".csv") + ".only.csv"
+		if err := contacts.ExportContacts(leftOnly, leftOnlyPath); err != nil {
+			log.Fatalf("Can't export to %q: %v", leftOnlyPath, err)
+		}
+		log.Printf("%d contacts only in left are exported to %q", len(leftOnly), leftOnlyPath)
+	} else {
+		log.Printf("There were no contacts that were only in left.")
+	}
+	if len(rightOnly) > 0 {
+		rightOnlyPath := strings.TrimSuffix(right, ".csv") + ".only.csv"
+		if err := contacts.ExportContacts(rightOnly, rightOnlyPath); err != nil {
+			log.Fatalf("Can't export to %q: %v", rightOnlyPath, err)
+		}
+		log.Printf("%d contacts only in right are exported to %q", len(rightOnly), rightOnlyPath)
+	} else {
+		log.Printf("There were no contacts that were only in right.")
+	}
+	if len(conflicts) > 0 {
+		conflictsPath := strings.TrimSuffix(right, ".csv") + ".conflicts.csv"
+		if err := contacts.ExportConflicts(conflicts, conflictsPath); err != nil {
+			log.Fatalf("Can't export to %q: %v", conflictsPath, err)
+		}
+		log.Printf(
+			"%d pairs of unmatched contacts with the same phone but different names are exported to %q",
+			len(conflicts), conflictsPath,
+		)
+	}
 }
 
 func compareByOffset(left, right string, offset int64) {
@@ -7,7 +7,11 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
@@ -20,16 +24,63 @@ var deleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete contacts",
 	Long: `Deletes contacts that match criteria specified by a flag.
-See the flags for the details of the criteria.`,
+See the flags for the details of the criteria.
+
+With --where, the contacts are downloaded and those that match the
+expression are deleted, for example:
+
+    contacts delete --where 'last_name = "" and phone ~ "^\+52" and created < 2023-01-01'
+
+Comparisons are field = value, !=, ~ (regular expression match), or !~,
+and can be combined with and, or, not, and parentheses.  The fields are
+id, uid, first_name, last_name, name, phone, email, company, job_title,
+url, extension, owner, and type; created (the creation time in the UID)
+is compared with dates using <, <=, >, or >=.  A preview of the matching
+contacts is shown first.  If more than --max-deletions contacts match,
+nothing is deleted unless --allow-over is given at least the number of
+matches.  The contacts that were deleted are exported to a spreadsheet
+(see the --deleted flag), and, as with every deletion, a snapshot is
+taken first so they can be brought back with the restore command.
+
+The result of deleting each contact is exported to a spreadsheet
+(see the --results flag). If some deletions fail, they can be
+retried with the resubmit command.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Default().SetFlags(0)
 		drCount, _ := cmd.Flags().GetCount("dry-run")
 		fromList, _ := cmd.Flags().GetString("from-list")
 		wpCount, _ := cmd.Flags().GetCount("without-phones")
-		deleteContacts(drCount > 0, fromList, wpCount > 0)
+		where, _ := cmd.Flags().GetString("where")
+		results, _ := cmd.Flags().GetString("results")
+		if results == "" {
+			if fromList != "" {
+				results = strings.TrimSuffix(fromList, ".csv") + ".results.csv"
+			} else if where != "" {
+				results = "where.results.csv"
+			} else {
+				results = "without-phones.results.csv"
+			}
+		}
+		if where != "" {
+			limits := deletionLimits{}
+			limits.max, _ = cmd.Flags().GetInt("max-deletions")
+			limits.allowOver, _ = cmd.Flags().GetInt("allow-over")
+			limits.preview, _ = cmd.Flags().GetInt("preview")
+			deleted, _ := cmd.Flags().GetString("deleted")
+			deleteWhere(drCount > 0, where, limits, deleted, results)
+			return
+		}
+		deleteContacts(drCount > 0, fromList, wpCount > 0, results)
 	},
 }
 
+// deletionLimits are the safety settings for query-based deletion.
+type deletionLimits struct {
+	max       int
+	allowOver int
+	preview   int
+}
+
 func init() {
 	contactsCmd.AddCommand(deleteCmd)
 
@@ -37,16 +88,24 @@ func init() {
 	deleteCmd.Flags().CountP("dry-run", "d", "Don't delete, just report what would be deleted")
 	deleteCmd.Flags().String("from-list", "", "Delete duplicates with UIDs offset from master")
 	deleteCmd.Flags().Count("without-phones", "Delete contacts that have no phone numbers")
-	deleteCmd.MarkFlagsOneRequired("from-list", "without-phones")
-	deleteCmd.MarkFlagsMutuallyExclusive("from-list", "without-phones")
+	deleteCmd.Flags().String("where", "", "Delete contacts that match this filter expression")
+	deleteCmd.Flags().Int("max-deletions", 25, "With --where, the most contacts that can be deleted without --allow-over")
+	deleteCmd.Flags().Int("allow-over", 0, "With --where, allow deleting up to this many contacts")
+	deleteCmd.Flags().Int("preview", 20, "With --where, how many matching contacts to show (0 for all)")
+	deleteCmd.Flags().String("deleted", "where.deleted.csv", "With --where, export the deleted contacts to this path")
+	deleteCmd.Flags().String("results", "", "Export the results to this path (default based on the criteria)")
+	deleteCmd.MarkFlagsOneRequired("from-list", "without-phones", "where")
+	deleteCmd.MarkFlagsMutuallyExclusive("from-list", "without-phones", "where")
 }
 
-func deleteContacts(dryRun bool, fromList string, withoutPhones bool) {
+func deleteContacts(dryRun bool, fromList string, withoutPhones bool, resultsPath string) {
 	err := storage.PushConfig("")
 	if err != nil {
 		log.Fatalf("You must have a .env file containg the Dialpad API key")
 	}
 	defer storage.PopConfig()
+	ctx, stop := interruptContext()
+	defer stop()
 	if fromList != "" {
 		entries, err := contacts.ImportContacts(fromList)
 		if err != nil {
@@ -57,19 +116,14 @@ func deleteContacts(dryRun bool, fromList string, withoutPhones bool) {
 			log.Printf("Not deleting contacts since dry-run was specified")
 			return
 		}
-		errs := contacts.DeleteContacts(entries)
-		if errs != nil {
-			log.Printf("Failed to delete %d contacts:", len(errs))
-			for _, err := range errs {
-				log.Printf("--> %v", err)
-			}
-		}
-		log.Printf("Deleted %d contacts", len(entries)-len(errs))
+		snapshotContacts(nil)
+		failed := writeContacts(ctx, contacts.BulkDelete, entries, resultsPath)
+		log.Printf("Deleted %d contacts", len(entries)-failed)
 	}
 	if withoutPhones {
 		entries, errs := contacts.ListContacts("")
 		if errs != nil {
-			log.Printf("Dialpad download errors:")
+			log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
 			for _, err := range errs {
 				log.Printf("--> %v", err)
 			}
@@ -82,13 +136,77 @@ func deleteContacts(dryRun bool, fromList string, withoutPhones bool) {
 			log.Printf("Not deleting contacts since dry-run was specified")
 			return
 		}
-		errs = contacts.DeleteContacts(wps)
-		if errs != nil {
-			log.Printf("Failed to delete %d contacts:", len(errs))
-			for _, err := range errs {
-				log.Printf("--> %v", err)
-			}
+		snapshotContacts(entries)
+		failed := writeContacts(ctx, contacts.BulkDelete, wps, resultsPath)
+		log.Printf("Deleted %d contacts without phones", len(wps)-failed)
+	}
+}
+
+func deleteWhere(dryRun bool, where string, limits deletionLimits, deletedPath, resultsPath string) {
+	filter, err := contacts.ParseFilter(where)
+	if err != nil {
+		log.Fatalf("Invalid --where expression: %v", err)
+	}
+	err = storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the Dialpad API key")
+	}
+	defer storage.PopConfig()
+	ctx, stop := interruptContext()
+	defer stop()
+	entries, errs := contacts.ListContacts("")
+	if errs != nil {
+		log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
 		}
-		log.Printf("Deleted %d contacts without phones", len(entries)-len(errs))
+		log.Fatalf("Can't continue with an incomplete list of contacts")
+	}
+	log.Printf("Found %d contacts to inspect", len(entries))
+	matches := contacts.FilterEntries(entries, filter)
+	log.Printf("Found %d contacts where %s", len(matches), filter)
+	if len(matches) == 0 {
+		return
+	}
+	previewDeletions(matches, limits.preview)
+	if len(matches) > max(limits.max, limits.allowOver) {
+		log.Fatalf("Not deleting %d contacts, since that's more than the maximum of %d; "+
+			"to delete them anyway, specify --allow-over %d", len(matches), limits.max, len(matches))
+	}
+	if dryRun {
+		log.Printf("Not deleting contacts since dry-run was specified")
+		return
+	}
+	snapshotContacts(entries)
+	results := contacts.BulkWrite(ctx, contacts.BulkDelete, matches)
+	var deleted []contacts.Entry
+	for _, result := range results {
+		if result.Err == nil {
+			deleted = append(deleted, result.Entry)
+		}
+	}
+	if err := contacts.ExportContacts(deleted, deletedPath); err != nil {
+		log.Printf("Warning: can't export the deleted contacts to %q: %v", deletedPath, err)
+	} else {
+		log.Printf("The %d deleted contacts are exported to %q", len(deleted), deletedPath)
+	}
+	failed := reportResults(results, resultsPath)
+	log.Printf("Deleted %d contacts", len(matches)-failed)
+}
+
+// previewDeletions shows a table of (up to limit of) the contacts to be deleted.
+func previewDeletions(entries []contacts.Entry, limit int) {
+	if limit <= 0 || limit > len(entries) {
+		limit = len(entries)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "UID\tName\tPhones\tEmails")
+	for _, e := range entries[:limit] {
+		name := strings.TrimSpace(e.FirstName + " " + e.LastName)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Uid, name, strings.Join(e.Phones, " "), strings.Join(e.Emails, " "))
+	}
+	_ = w.Flush()
+	if limit < len(entries) {
+		log.Printf("... and %d more", len(entries)-limit)
 	}
 }
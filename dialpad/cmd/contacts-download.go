@@ -8,6 +8,7 @@ package cmd
 
 import (
 	"log"
+	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -21,15 +22,24 @@ var downloadCmd = &cobra.Command{
 	Use:   "download [flags] path_to_csv",
 	Short: "Download contacts",
 	Long: `Downloads all the contacts in Dialpad to a local spreadsheet.
-You must specify the path to the CSV-format spreadsheet to be created.
-If no account id is specified, downloads the company contacts.`,
+You must specify the path to the CSV-format spreadsheet to be created,
+or to a ".vcf" file if you want the contacts as vCards.
+If no account id is specified, downloads the company contacts.
+(To download the contacts of every account at once, use the accounts command.)
+Phone extensions, which Dialpad doesn't store, are filled in from those
+saved by earlier uploads and syncs.
+
+As the contacts are downloaded, they are saved (encrypted) in a local cache.
+If the download fails or is interrupted, it can be continued from where it
+stopped by running it again with --resume.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Default().SetFlags(0)
 		accountId, err := cmd.Flags().GetString("account")
 		if err != nil {
 			log.Panic(err)
 		}
-		download(args[0], accountId)
+		resumeCount, _ := cmd.Flags().GetCount("resume")
+		download(args[0], accountId, resumeCount > 0)
 	},
 }
 
@@ -38,21 +48,40 @@ func init() {
 
 	downloadCmd.Args = cobra.ExactArgs(1)
 	downloadCmd.Flags().StringP("account", "a", "", "User account id")
+	downloadCmd.Flags().Count("resume", "Continue an interrupted download")
 }
 
-func download(path string, accountId string) {
+func download(path string, accountId string, resume bool) {
 	err := storage.PushConfig("")
 	if err != nil {
 		log.Fatalf("You must have a .env file containg the Dialpad API key")
 	}
 	defer storage.PopConfig()
-	entries, errs := contacts.ListContacts(accountId)
+	cache, err := contacts.NewDownloadCache(accountId)
+	if err != nil {
+		log.Fatalf("Can't find a place for the download cache: %v", err)
+	}
+	if !resume {
+		if err := cache.Clear(); err != nil {
+			log.Fatalf("Can't clear the download cache: %v", err)
+		}
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	entries, errs := contacts.ListContactsContext(ctx, accountId, cache)
 	if errs != nil {
-		log.Printf("Dialpad download errors:")
+		log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
 		for _, err := range errs {
 			log.Printf("--> %v", err)
 		}
-		path = strings.TrimSuffix(path, ".csv") + ".partial.csv"
+	}
+	applySavedExtensions(entries)
+	if contacts.DownloadStopped(errs) {
+		if cache.HasCheckpoint() {
+			log.Printf("To continue the download from where it stopped, use --resume")
+		}
+		ext := filepath.Ext(path)
+		path = strings.TrimSuffix(path, ext) + ".partial" + ext
 		log.Printf("Saving partial results (%d entries) to %s", len(entries), path)
 	} else {
 		log.Printf("Saving results (%d entries) to %s", len(entries), path)
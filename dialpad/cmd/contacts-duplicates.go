@@ -0,0 +1,66 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+)
+
+// duplicatesCmd represents the duplicates command
+var duplicatesCmd = &cobra.Command{
+	Use:   "duplicates [flags] path-to-contacts.csv",
+	Short: "Find probable duplicate contacts",
+	Long: `Find groups of probable duplicates in a list of contacts downloaded from Dialpad.
+
+Contacts are grouped if they share a phone or an email, or if their names are
+near-identical (ignoring case, accents, and the order of first and last names,
+or within a small edit distance). Each group is scored by its weakest link,
+from 20 (similar names only) to 100 (shared phone, shared email, and same name).
+
+The groups are exported for review using the same path as the input but with a
+".duplicates.csv" suffix. The first row of each group is the proposed surviving
+record (marked "yes" in the Keep column), which has all the group's phones and
+emails. The other rows of the group are the contacts that would be merged into it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		minScore, _ := cmd.Flags().GetInt("min-score")
+		findDuplicates(args[0], minScore)
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(duplicatesCmd)
+
+	duplicatesCmd.Args = cobra.ExactArgs(1)
+	duplicatesCmd.Flags().Int("min-score", contacts.SharedEmailScore, "Ignore evidence of duplication scoring below this")
+}
+
+func findDuplicates(path string, minScore int) {
+	entries, err := contacts.ImportContacts(path)
+	if err != nil {
+		log.Fatalf("Can't import from %q: %v", path, err)
+	}
+	groups := contacts.FindDuplicates(entries, minScore)
+	if len(groups) == 0 {
+		log.Printf("There were no probable duplicates among %d contacts", len(entries))
+		return
+	}
+	count := 0
+	for _, group := range groups {
+		count += len(group.Members)
+	}
+	dupesPath := strings.TrimSuffix(path, ".csv") + ".duplicates.csv"
+	if err := contacts.ExportDuplicates(groups, dupesPath); err != nil {
+		log.Fatalf("Can't export to %q: %v", dupesPath, err)
+	}
+	log.Printf("%d groups containing %d contacts are exported to %q", len(groups), count, dupesPath)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// contactHistoryCmd represents the contacts history command
+var contactHistoryCmd = &cobra.Command{
+	Use:   "history [flags] uid",
+	Short: "Show the change log of a contact",
+	Long: `Shows every change made to a contact by these tools, oldest first:
+when it was made, whether it was a creation, update, or deletion, who
+made it (and with which environment and command), and what changed.
+
+Unless --offline is specified, the contact is then fetched from Dialpad
+to check whether it has been changed there since the last recorded change.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		offlineCount, _ := cmd.Flags().GetCount("offline")
+		showContactHistory(args[0], offlineCount > 0)
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(contactHistoryCmd)
+
+	contactHistoryCmd.Args = cobra.ExactArgs(1)
+	contactHistoryCmd.Flags().Count("offline", "Don't check the contact's current state in Dialpad")
+}
+
+func showContactHistory(uid string, offline bool) {
+	err := storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the Dialpad API key")
+	}
+	defer storage.PopConfig()
+	records, err := contacts.CompanyAuditLog.History(uid)
+	if err != nil {
+		log.Fatalf("Can't read the audit log: %v", err)
+	}
+	if len(records) == 0 {
+		log.Printf("There are no recorded changes to contact %s", uid)
+		return
+	}
+	for _, r := range records {
+		log.Printf("%s: %s by %s (%s environment)", r.Time.Local().Format(time.RFC1123), r.Action, r.Operator, r.Environment)
+		log.Printf("    command: %s", r.Command)
+		for _, line := range r.Diff {
+			log.Printf("    %s", line)
+		}
+	}
+	if offline {
+		return
+	}
+	last := records[len(records)-1]
+	current, err := contacts.GetContact(last.FullId)
+	switch {
+	case errors.Is(err, contacts.NotFound) && last.Action == "delete":
+		log.Printf("The contact is still deleted in Dialpad.")
+	case errors.Is(err, contacts.NotFound):
+		log.Printf("The contact has been deleted in Dialpad since the last recorded change.")
+	case err != nil:
+		log.Fatalf("Can't fetch the contact from Dialpad: %v", err)
+	case last.Action == "delete":
+		log.Printf("The contact has been recreated in Dialpad since the last recorded change.")
+	case !contacts.HashMatches(current, last.Hash):
+		log.Printf("The contact has been edited in Dialpad since the last recorded change; it is now:")
+		log.Printf("    %s %s, phones %v, emails %v", current.FirstName, current.LastName, current.Phones, current.Emails)
+	default:
+		log.Printf("The contact is unchanged in Dialpad since the last recorded change.")
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/schollz/progressbar/v3"
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge [flags]",
+	Short: "Merge duplicate contacts",
+	Long: `Merges groups of duplicate contacts in Dialpad, or undoes a prior merge.
+
+The --plan flag specifies a merge plan, in the format exported by the
+duplicates command. In each group, the contact marked "yes" in the Keep
+column survives: it gets the name given in the plan and all the phones
+and emails of the group. The contacts marked "no" are deleted.
+
+Before anything is changed, an encrypted undo journal is written (by default
+next to the plan, with a ".journal.age" suffix). To undo the merge, give the
+journal to the --undo flag: the deleted contacts are recreated and the
+survivors are restored to their prior state.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		drCount, _ := cmd.Flags().GetCount("dry-run")
+		plan, _ := cmd.Flags().GetString("plan")
+		journal, _ := cmd.Flags().GetString("journal")
+		undo, _ := cmd.Flags().GetString("undo")
+		if undo != "" {
+			undoMerge(undo, drCount > 0)
+		} else {
+			if journal == "" {
+				journal = strings.TrimSuffix(plan, ".csv") + ".journal.age"
+			}
+			mergeContacts(plan, journal, drCount > 0)
+		}
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Args = cobra.ExactArgs(0)
+	mergeCmd.Flags().CountP("dry-run", "d", "Don't change contacts, just report what would be changed")
+	mergeCmd.Flags().String("plan", "", "Merge the groups of contacts in this plan")
+	mergeCmd.Flags().String("journal", "", "Write the undo journal to this path")
+	mergeCmd.Flags().String("undo", "", "Undo the merges recorded in this journal")
+	mergeCmd.MarkFlagsOneRequired("plan", "undo")
+	mergeCmd.MarkFlagsMutuallyExclusive("plan", "undo")
+	mergeCmd.MarkFlagsMutuallyExclusive("journal", "undo")
+}
+
+func mergeContacts(plan, journal string, dryRun bool) {
+	err := storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the Dialpad API key")
+	}
+	defer storage.PopConfig()
+	groups, err := contacts.ImportMergePlan(plan)
+	if err != nil {
+		log.Fatalf("Can't import merge plan from %q: %v", plan, err)
+	}
+	log.Printf("Found %d groups to merge in %q", len(groups), plan)
+	current, errs := contacts.ListContacts("")
+	if errs != nil {
+		log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+		log.Fatalf("Can't continue with an incomplete list of contacts")
+	}
+	records, errs := contacts.PlanMerges(groups, current)
+	if errs != nil {
+		log.Printf("Skipping %d groups that can't be merged:", len(groups)-len(records))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+	}
+	deleteCount := 0
+	for _, record := range records {
+		deleteCount += len(record.Deleted)
+	}
+	log.Printf("Merging will update %d contacts and delete %d contacts", len(records), deleteCount)
+	if dryRun {
+		log.Printf("Not merging contacts since dry-run was specified")
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+	snapshotContacts(current)
+	if err := contacts.SaveMergeJournal(records, journal); err != nil {
+		log.Fatalf("Can't write undo journal to %q: %v", journal, err)
+	}
+	log.Printf("Undo journal written to %q", journal)
+	errs = nil
+	bar := progressbar.Default(int64(len(records)), "Merging contacts")
+	for _, record := range records {
+		errs = append(errs, contacts.ExecuteMerge(record)...)
+		_ = bar.Add(1)
+	}
+	_ = bar.Close()
+	if errs != nil {
+		log.Printf("Dialpad merge errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+	}
+	log.Printf("Merged %d groups of contacts; use --undo %s to reverse this", len(records), journal)
+}
+
+func undoMerge(journal string, dryRun bool) {
+	err := storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the Dialpad API key")
+	}
+	defer storage.PopConfig()
+	records, err := contacts.LoadMergeJournal(journal)
+	if err != nil {
+		log.Fatalf("Can't read undo journal from %q: %v", journal, err)
+	}
+	createCount := 0
+	for _, record := range records {
+		createCount += len(record.Deleted)
+	}
+	log.Printf("Undoing will restore %d contacts and recreate %d contacts", len(records), createCount)
+	if dryRun {
+		log.Printf("Not restoring contacts since dry-run was specified")
+		return
+	}
+	snapshotContacts(nil)
+	var errs []error
+	bar := progressbar.Default(int64(len(records)), "Undoing merges")
+	for _, record := range records {
+		errs = append(errs, contacts.UndoMerge(record)...)
+		_ = bar.Add(1)
+	}
+	_ = bar.Close()
+	if errs != nil {
+		log.Printf("Dialpad restore errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+	}
+	log.Printf("Undid the merges of %d groups of contacts", len(records))
+}
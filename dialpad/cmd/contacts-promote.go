@@ -0,0 +1,88 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// promoteCmd represents the promote command
+var promoteCmd = &cobra.Command{
+	Use:   "promote [flags] path_to_csv",
+	Short: "Share private contacts with the company",
+	Long: `Promotes private contacts to company contacts, so everyone can see them.
+
+The spreadsheet must be in the format exported by the accounts command;
+every user or office contact in it is promoted (company contacts in it
+are ignored). Contacts that are already company contacts, with the same
+name and primary phone, are skipped. The same person in several accounts
+is promoted once, with all their phones and emails.
+
+The private contacts are left as they are. The result of creating each
+company contact is exported using the same path as the input but with
+a ".results.csv" suffix.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		drCount, _ := cmd.Flags().GetCount("dry-run")
+		promoteContacts(args[0], drCount > 0)
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(promoteCmd)
+
+	promoteCmd.Args = cobra.ExactArgs(1)
+	promoteCmd.Flags().CountP("dry-run", "d", "Don't promote, just report what would be promoted")
+}
+
+func promoteContacts(path string, dryRun bool) {
+	err := storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the Dialpad API key")
+	}
+	defer storage.PopConfig()
+	entries, err := contacts.ImportAccountContacts(path)
+	if err != nil {
+		log.Fatalf("Can't import from %q: %v", path, err)
+	}
+	var private []contacts.Entry
+	for _, entry := range entries {
+		if entry.Scope != contacts.CompanyScope {
+			private = append(private, entry)
+		}
+	}
+	log.Printf("Found %d private contacts in %q", len(private), path)
+	company, errs := contacts.ListContacts("")
+	if errs != nil {
+		log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+		log.Fatalf("Can't continue with an incomplete list of contacts")
+	}
+	promote, skipped := contacts.PlanPromotions(private, company)
+	log.Printf("%d contacts will be promoted; %d are already company contacts", len(promote), len(skipped))
+	if dryRun {
+		log.Printf("Not promoting contacts since dry-run was specified")
+		return
+	}
+	if len(promote) == 0 {
+		return
+	}
+	snapshotContacts(company)
+	ctx, stop := interruptContext()
+	defer stop()
+	resultsPath := strings.TrimSuffix(path, ".csv") + ".results.csv"
+	failed := writeContacts(ctx, contacts.BulkUpdate, promote, resultsPath)
+	log.Printf("Promoted %d contacts to company contacts.", len(promote)-failed)
+}
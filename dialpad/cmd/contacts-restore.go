@@ -0,0 +1,88 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [flags]",
+	Short: "Restore contacts from a snapshot",
+	Long: `Restores Dialpad contacts to their state in a snapshot.
+
+Contacts in the snapshot that have since been deleted are recreated,
+and contacts that have since been changed are reverted. Contacts
+created since the snapshot are left alone. Use --only to restrict the
+restore to specific contacts (by UID). Use the "snapshots list"
+command to find the ID of a snapshot.
+
+Like every command that changes contacts, this one saves a new
+snapshot before it changes anything.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		drCount, _ := cmd.Flags().GetCount("dry-run")
+		id, _ := cmd.Flags().GetString("snapshot")
+		only, _ := cmd.Flags().GetStringSlice("only")
+		restoreContacts(id, only, drCount > 0)
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Args = cobra.NoArgs
+	restoreCmd.Flags().CountP("dry-run", "d", "Don't restore, just report what would be restored")
+	restoreCmd.Flags().String("snapshot", "", "ID of the snapshot to restore from")
+	restoreCmd.Flags().StringSlice("only", nil, "Restore only the contacts with these UIDs")
+	_ = restoreCmd.MarkFlagRequired("snapshot")
+}
+
+func restoreContacts(id string, only []string, dryRun bool) {
+	err := storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the Dialpad API key")
+	}
+	defer storage.PopConfig()
+	snapshot, err := contacts.DownloadSnapshot(id)
+	if err != nil {
+		log.Fatalf("Can't download snapshot %s: %v", id, err)
+	}
+	log.Printf("Found %d contacts in snapshot %s", len(snapshot), id)
+	current, errs := contacts.ListContacts("")
+	if errs != nil {
+		log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+		log.Fatalf("Can't continue with an incomplete list of contacts")
+	}
+	recreate, revert := contacts.PlanRestore(snapshot, current, only)
+	log.Printf("There are %d deleted contacts to recreate and %d changed contacts to revert.", len(recreate), len(revert))
+	if dryRun {
+		log.Printf("Not restoring contacts since dry-run was specified")
+		return
+	}
+	if len(recreate)+len(revert) == 0 {
+		return
+	}
+	snapshotContacts(current)
+	log.Printf("Restoring %d contacts to Dialpad...", len(recreate)+len(revert))
+	if errs := contacts.RestoreContacts(append(recreate, revert...)); errs != nil {
+		log.Printf("Dialpad update errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+	}
+	log.Printf("Restored contacts from snapshot %s.", id)
+}
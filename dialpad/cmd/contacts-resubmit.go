@@ -0,0 +1,76 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// resubmitCmd represents the resubmit command
+var resubmitCmd = &cobra.Command{
+	Use:   "resubmit [flags] path_to_results_csv",
+	Short: "Retry failed contact writes",
+	Long: `Retries the failed updates and deletes in a results spreadsheet,
+as exported by the upload and delete commands. Rows that succeeded
+are ignored.
+
+The results of the retry are exported using the same path as the
+input but with a ".retry.csv" suffix, so it can in turn be resubmitted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		drCount, _ := cmd.Flags().GetCount("dry-run")
+		resubmit(args[0], drCount > 0)
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(resubmitCmd)
+
+	resubmitCmd.Args = cobra.ExactArgs(1)
+	resubmitCmd.Flags().CountP("dry-run", "d", "Don't retry, just report what would be retried")
+}
+
+func resubmit(path string, dryRun bool) {
+	err := storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the Dialpad API key")
+	}
+	defer storage.PopConfig()
+	results, err := contacts.ImportBulkResults(path)
+	if err != nil {
+		log.Fatalf("Can't import results from %q: %v", path, err)
+	}
+	var updates, deletes []contacts.Entry
+	for _, failure := range contacts.BulkFailures(results) {
+		if failure.Action == contacts.BulkDelete {
+			deletes = append(deletes, failure.Entry)
+		} else {
+			updates = append(updates, failure.Entry)
+		}
+	}
+	log.Printf("Found %d failed updates and %d failed deletes in %q", len(updates), len(deletes), path)
+	if dryRun {
+		log.Printf("Not retrying since dry-run was specified")
+		return
+	}
+	if len(updates)+len(deletes) == 0 {
+		return
+	}
+	snapshotContacts(nil)
+	ctx, stop := interruptContext()
+	defer stop()
+	retried := contacts.BulkWrite(ctx, contacts.BulkUpdate, updates)
+	retried = append(retried, contacts.BulkWrite(ctx, contacts.BulkDelete, deletes)...)
+	failed := reportResults(retried, strings.TrimSuffix(path, ".csv")+".retry.csv")
+	log.Printf("Retried %d contacts, of which %d failed again", len(updates)+len(deletes), failed)
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// snapshotsCmd represents the snapshots command
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "Manage snapshots of dialpad contacts",
+	Long: `Every command that changes Dialpad contacts first saves an encrypted
+snapshot of all the contacts to AWS. This command allows managing those snapshots.
+Use the restore command to restore contacts from a snapshot.`,
+}
+
+// snapshotsListCmd represents the snapshots list command
+var snapshotsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots of dialpad contacts",
+	Long:  `Lists the IDs of the saved snapshots of Dialpad contacts, oldest first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		listSnapshots()
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(snapshotsCmd)
+	snapshotsCmd.AddCommand(snapshotsListCmd)
+
+	snapshotsListCmd.Args = cobra.NoArgs
+}
+
+func listSnapshots() {
+	err := storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the AWS credentials")
+	}
+	defer storage.PopConfig()
+	snapshots, err := contacts.ListSnapshots()
+	if err != nil {
+		log.Fatalf("Can't list snapshots: %v", err)
+	}
+	if len(snapshots) == 0 {
+		log.Printf("There are no snapshots.")
+		return
+	}
+	for _, s := range snapshots {
+		log.Printf("%s (taken %s, %d bytes)", s.Id, s.Time.Local().Format(time.RFC1123), s.Size)
+	}
+}
+
+// snapshotContacts saves a snapshot of the current Dialpad contacts before they are changed.
+//
+// If the current contacts have already been downloaded, they are used;
+// otherwise they are downloaded. Either way, they are returned, and they are
+// the baseline against which the changes are recorded in the audit log.
+// If the snapshot can't be saved, this exits rather than allow changes.
+func snapshotContacts(current []contacts.Entry) []contacts.Entry {
+	if current == nil {
+		var errs []error
+		current, errs = contacts.ListContacts("")
+		if errs != nil {
+			log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
+			for _, err := range errs {
+				log.Printf("--> %v", err)
+			}
+			log.Fatalf("Can't take a snapshot with an incomplete list of contacts")
+		}
+	}
+	contacts.AuditBaseline(current)
+	id, err := contacts.UploadSnapshot(current)
+	if err != nil {
+		log.Fatalf("Can't save a snapshot of the contacts, so not changing them: %v", err)
+	}
+	log.Printf("Saved a snapshot of %d contacts with id %s", len(current), id)
+	return current
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// statsCmd represents the contacts stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats [flags] [path_to_csv]",
+	Short: "Report on the quality of the contact list",
+	Long: `Reports statistics about the quality of the Dialpad contacts:
+how many there are, how many have no phone or no email, how many have
+more than one phone, how many are in each country (by calling code),
+which phones aren't in canonical form, which phones are shared by more
+than one contact, and how many were created in each month (according
+to their UIDs).
+
+The contacts are downloaded from Dialpad unless a spreadsheet (or vCard
+file) in the format written by the download command is given.
+
+The report is written to standard output, as text or (with --json) JSON.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		jsonCount, _ := cmd.Flags().GetCount("json")
+		limit, _ := cmd.Flags().GetInt("limit")
+		var path string
+		if len(args) > 0 {
+			path = args[0]
+		}
+		reportStats(path, jsonCount > 0, limit)
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(statsCmd)
+
+	statsCmd.Args = cobra.MaximumNArgs(1)
+	statsCmd.Flags().Count("json", "Write the report as JSON")
+	statsCmd.Flags().Int("limit", 20, "In a text report, list at most this many problem phones of each kind (0 for all)")
+}
+
+func reportStats(path string, asJson bool, limit int) {
+	var entries []contacts.Entry
+	if path != "" {
+		var err error
+		entries, err = contacts.ImportContacts(path)
+		if err != nil {
+			log.Fatalf("Error importing contacts: %v", err)
+		}
+	} else {
+		err := storage.PushConfig("")
+		if err != nil {
+			log.Fatalf("You must have a .env file containg the Dialpad API key")
+		}
+		defer storage.PopConfig()
+		var errs []error
+		entries, errs = contacts.ListContacts("")
+		if errs != nil {
+			log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
+			for _, err := range errs {
+				log.Printf("--> %v", err)
+			}
+			log.Fatalf("Can't report on an incomplete list of contacts")
+		}
+	}
+	stats := contacts.ComputeStats(entries)
+	if asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(stats); err != nil {
+			log.Fatalf("Can't write the report: %v", err)
+		}
+		return
+	}
+	if err := stats.WriteText(os.Stdout, limit); err != nil {
+		log.Fatalf("Can't write the report: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync [flags] path_to_csv_or_vcf",
+	Short: "Sync contacts incrementally",
+	Long: `Syncs the contacts from a local spreadsheet to Dialpad.
+
+Unlike upload, sync doesn't download the Dialpad contacts to find what
+has changed. Instead, it remembers (in the database) what it last pushed
+for each contact, and only pushes contacts that are new or have changed
+in the spreadsheet since then. With --prune, contacts it pushed that are
+no longer in the spreadsheet are deleted from Dialpad.
+
+Each contact is pushed just as the source has it. Unlike upload, sync
+doesn't fill in a blank company, job title, or URLs from Dialpad, so
+clearing them in the source clears them in Dialpad. Spreadsheets don't
+have those columns, so use vCards if they are kept in Dialpad.
+
+Before a contact is updated or deleted, it is fetched from Dialpad to
+check whether it was edited there since it was last pushed. Such conflicts
+are reported (and exported using the same path as the input but with a
+".conflicts.csv" suffix) and left alone unless --force is specified.
+
+Contacts whose source gives them no UID (no ID or date column, or a
+vCard with no UID) are matched to the Dialpad contact with one of their
+phones or, failing that, their name, which means downloading the Dialpad
+contacts; give the spreadsheet an ID column to avoid that.
+
+The first sync should be done with --reset, which downloads the Dialpad
+contacts and remembers them as if they had been pushed.  The sync state
+is also reset, once, if it was recorded by an older version of this tool.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Default().SetFlags(0)
+		drCount, _ := cmd.Flags().GetCount("dry-run")
+		pruneCount, _ := cmd.Flags().GetCount("prune")
+		forceCount, _ := cmd.Flags().GetCount("force")
+		resetCount, _ := cmd.Flags().GetCount("reset")
+		profile, _ := cmd.Flags().GetString("profile")
+		syncContacts(args[0], profile, drCount > 0, pruneCount > 0, forceCount > 0, resetCount > 0)
+	},
+}
+
+func init() {
+	contactsCmd.AddCommand(syncCmd)
+
+	syncCmd.Args = cobra.ExactArgs(1)
+	syncCmd.Flags().CountP("dry-run", "d", "Don't sync, just report what would be synced")
+	syncCmd.Flags().Count("prune", "Delete contacts that are no longer in the spreadsheet")
+	syncCmd.Flags().Count("force", "Overwrite contacts that were edited in Dialpad")
+	syncCmd.Flags().Count("reset", "Start by remembering the current Dialpad contacts")
+	syncCmd.Flags().String("profile", "dialpad", "Column profile name or YAML path (see validate)")
+}
+
+func syncContacts(path, profile string, dryRun, prune, force, reset bool) {
+	err := storage.PushConfig("")
+	if err != nil {
+		log.Fatalf("You must have a .env file containg the Dialpad API key")
+	}
+	defer storage.PopConfig()
+	source, err := contacts.ParseProfileContacts(path, lookupProfile(profile), false)
+	if err != nil {
+		log.Fatalf("Could not read file at path %s: %v", path, err)
+	}
+	log.Printf("Found %d valid contacts in %s", len(source), path)
+	state := contacts.CompanySyncState
+	records, err := state.Fetch()
+	if err != nil {
+		log.Fatalf("Can't fetch the sync state: %v", err)
+	}
+	if !reset && contacts.Outdated(records) {
+		log.Printf("The sync state was recorded by an older version of this tool, so it must be reset")
+		reset = true
+	}
+	derived := slices.ContainsFunc(source, func(e contacts.Entry) bool { return e.UidDerived })
+	var dialpad []contacts.Entry
+	if reset || derived {
+		var errs []error
+		dialpad, errs = contacts.ListContacts("")
+		if errs != nil {
+			log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
+			for _, err := range errs {
+				log.Printf("--> %v", err)
+			}
+			log.Fatalf("Can't continue with an incomplete list of contacts")
+		}
+	}
+	if reset {
+		if err := state.Reset(dialpad); err != nil {
+			log.Fatalf("Can't reset the sync state: %v", err)
+		}
+		log.Printf("Reset the sync state to the %d contacts in Dialpad", len(dialpad))
+		if records, err = state.Fetch(); err != nil {
+			log.Fatalf("Can't fetch the sync state: %v", err)
+		}
+	}
+	if derived {
+		if matched := contacts.MatchDerivedUids(source, dialpad); matched > 0 {
+			log.Printf("Matched %d contacts without a source UID to Dialpad contacts", matched)
+		}
+	}
+	if len(records) == 0 {
+		log.Printf("Warning: there is no sync state, so every contact will be pushed (see --reset)")
+	}
+	plan := contacts.PlanSync(source, records, prune)
+	log.Printf(
+		"There are %d new, %d changed, %d removed, and %d unchanged contacts since the last sync.",
+		len(plan.Create), len(plan.Update), len(plan.Delete), plan.Unchanged,
+	)
+	conflicts, errs := contacts.FindConflicts(&plan, records)
+	if errs != nil {
+		log.Printf("Dialpad fetch errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+		log.Fatalf("Can't continue without checking for conflicts")
+	}
+	if len(plan.Vanished) > 0 {
+		log.Printf("%d removed contacts were already deleted in Dialpad", len(plan.Vanished))
+	}
+	if len(conflicts) > 0 {
+		log.Printf("%d contacts to be changed were edited in Dialpad since the last sync:", len(conflicts))
+		var edited []contacts.Entry
+		for _, c := range conflicts {
+			if c.Dialpad.FullId == "" {
+				log.Printf("--> %s (%s %s): deleted in Dialpad, won't %s", c.Planned.Uid, c.Planned.FirstName, c.Planned.LastName, c.Action)
+			} else {
+				log.Printf("--> %s (%s %s): edited in Dialpad, won't %s", c.Planned.Uid, c.Planned.FirstName, c.Planned.LastName, c.Action)
+				edited = append(edited, c.Dialpad)
+			}
+		}
+		if len(edited) > 0 {
+			conflictsPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".conflicts.csv"
+			if err := contacts.ExportContacts(edited, conflictsPath); err != nil {
+				log.Fatalf("Can't export to %q: %v", conflictsPath, err)
+			}
+			log.Printf("The Dialpad versions of %d edited contacts are exported to %q", len(edited), conflictsPath)
+		}
+		if force {
+			log.Printf("Changing them anyway since force was specified")
+		} else {
+			plan.Exclude(conflicts)
+		}
+	}
+	if dryRun {
+		log.Printf("Not syncing contacts since dry-run was specified")
+		return
+	}
+	saveExtensions(source)
+	if len(plan.Create)+len(plan.Update)+len(plan.Delete) == 0 {
+		log.Printf("There are no contacts to sync.")
+		return
+	}
+	snapshotContacts(dialpad)
+	if errs := contacts.ExecuteSync(state, plan); errs != nil {
+		log.Printf("Dialpad sync errors (%s):", contacts.SummarizeErrors(errs))
+		for _, err := range errs {
+			log.Printf("--> %v", err)
+		}
+		total := len(plan.Create) + len(plan.Update) + len(plan.Delete)
+		log.Fatalf("Sync of %d changes to Dialpad had %d failures; run it again to retry them.", total, len(errs))
+	}
+	log.Printf("Synced all contacts to Dialpad.")
+}
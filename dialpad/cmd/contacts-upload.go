@@ -8,6 +8,8 @@ package cmd
 
 import (
 	"log"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -17,17 +19,36 @@ import (
 
 // uploadCmd represents the upload command
 var uploadCmd = &cobra.Command{
-	Use:   "upload [flags] path_to_csv",
+	Use:   "upload [flags] path_to_csv_or_vcf",
 	Short: "Upload contacts",
 	Long: `Uploads the contacts from a local spreadsheet to Dialpad.
-Only new and/or updated contacts are sent.`,
+Only new and/or updated contacts are sent. If the file has a ".vcf"
+extension, it is read as vCards rather than as CSV.
+
+The result of uploading each contact is exported using the same path
+as the input but with a ".results.csv" suffix. If some uploads fail,
+they can be retried with the resubmit command.
+
+Contacts whose source gives them no UID (no ID or date column, or a
+vCard with no UID) are matched to the Dialpad contact with one of their
+phones or, failing that, their name, so they can be edited safely.
+
+Spreadsheets don't have company, job title, or URL columns, so a
+contact's company, job title, and URLs are kept in Dialpad when the file
+leaves them blank. With --clear-blank, they are cleared instead, which
+is how to remove them using a vCard file that has them for some contacts.
+
+Dialpad doesn't store phone extensions (such as "510-555-1234 x12"),
+so they are saved separately for use by the history server.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Default().SetFlags(0)
 		count, err := cmd.Flags().GetCount("dry-run")
 		if err != nil {
 			log.Panic(err)
 		}
-		upload(args[0], count != 0)
+		profile, _ := cmd.Flags().GetString("profile")
+		clearBlank, _ := cmd.Flags().GetCount("clear-blank")
+		upload(args[0], profile, count != 0, clearBlank != 0)
 	},
 }
 
@@ -36,46 +57,63 @@ func init() {
 
 	uploadCmd.Args = cobra.ExactArgs(1)
 	uploadCmd.Flags().CountP("dry-run", "d", "Don't upload, just report what would be uploaded")
+	uploadCmd.Flags().String("profile", "dialpad", "Column profile name or YAML path (see validate)")
+	uploadCmd.Flags().Count("clear-blank", "Clear the company, job title, and URLs of contacts that leave them blank")
 }
 
-func upload(path string, dryRun bool) {
+func upload(path, profile string, dryRun, clearBlank bool) {
 	err := storage.PushConfig("")
 	if err != nil {
 		log.Fatalf("You must have a .env file containg the Dialpad API key")
 	}
 	defer storage.PopConfig()
-	local, err := contacts.ParseContacts(path, false)
+	local, err := contacts.ParseProfileContacts(path, lookupProfile(profile), false)
 	if err != nil {
 		log.Fatalf("Could not read file at path %s: %v", path, err)
 	}
 	log.Printf("Found %d valid contacts in %s", len(local), path)
 	dialpad, errs := contacts.ListContacts("")
 	if errs != nil {
-		log.Printf("Dialpad download errors:")
+		log.Printf("Dialpad download errors (%s):", contacts.SummarizeErrors(errs))
 		for _, err := range errs {
 			log.Printf("--> %v", err)
 		}
 		log.Fatalf("Can't continue with a incomplete list of contacts")
 	}
 	log.Printf("Found %d valid contacts in Dialpad", len(dialpad))
-	update, create := contacts.DiffEntries(dialpad, local)
+	if matched := contacts.MatchDerivedUids(local, dialpad); matched > 0 {
+		log.Printf("Matched %d contacts without a source UID to Dialpad contacts", matched)
+	}
+	update, create := contacts.DiffEntries(dialpad, local, clearBlank)
 	log.Printf("There are %d new contacts and %d updated contacts.", len(create), len(update))
 	if dryRun {
 		return
 	}
-	log.Printf("Uploading %d changed contacts to Dialpad...", len(update))
-	if errs := contacts.UpdateContacts(update); errs != nil {
-		log.Printf("Dialpad update errors:")
-		for _, err := range errs {
-			log.Printf("--> %v", err)
-		}
+	snapshotContacts(dialpad)
+	ctx, stop := interruptContext()
+	defer stop()
+	log.Printf("Uploading %d changed and %d new contacts to Dialpad...", len(update), len(create))
+	resultsPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".results.csv"
+	failed := writeContacts(ctx, contacts.BulkUpdate, append(update, create...), resultsPath)
+	log.Printf("Uploaded %d contacts to Dialpad.", len(update)+len(create)-failed)
+	saveExtensions(local)
+}
+
+// applySavedExtensions fills in the phone extensions saved by earlier uploads
+// and syncs, so that contacts downloaded from Dialpad keep them when they
+// are edited and uploaded again.
+func applySavedExtensions(entries []contacts.Entry) {
+	extensions, err := contacts.LoadExtensions()
+	if err != nil {
+		log.Fatalf("Couldn't load the saved phone extensions: %v", err)
 	}
-	log.Printf("Uploading %d new contacts to Dialpad...", len(create))
-	if errs := contacts.UpdateContacts(create); errs != nil {
-		log.Printf("Dialpad update errors:")
-		for _, err := range errs {
-			log.Printf("--> %v", err)
-		}
+	contacts.ApplyExtensions(entries, extensions)
+}
+
+// saveExtensions remembers the phone extensions in the given contacts,
+// which Dialpad can't store, so the history pages can show them.
+func saveExtensions(entries []contacts.Entry) {
+	if err := contacts.SaveExtensions(entries); err != nil {
+		log.Printf("Warning: couldn't save the phone extensions: %v", err)
 	}
-	log.Printf("Uploaded all contacts to Dialpad.")
 }
@@ -8,6 +8,7 @@ package cmd
 
 import (
 	"log"
+	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -17,21 +18,45 @@ import (
 
 // validateCmd represents the validate command
 var validateCmd = &cobra.Command{
-	Use:   "validate path_to_csv",
+	Use:   "validate path_to_csv_or_vcf",
 	Short: "Validate contacts",
 	Long: `Validate a CSV file of Dialpad contact information.
 
-The first row of the file must be the following header line:
+By default, the first row of the file must be a header line with
+the following columns (in any order, with others ignored):
     Creation Date,First_Name,Last_Name,Phones,Email
-and each row must have all 5 fields. The processing will print
+Files exported from elsewhere can be read by specifying a column
+profile with --profile: one of dialpad (the default), google,
+outlook, or airtable, or the path of a YAML file describing the
+columns (see the ColumnProfile type). The processing will print
 a list of rows that have errors, and then do an export of
 what would be uploaded to Dialpad by the upload command.
+Each contact's UID comes from the profile's ID column, if it has one,
+or else its creation date, so rows with the same UID as an earlier
+row (such as contacts created in the same minute, when the dates
+are only that precise) are skipped as duplicates.
 
-The exported CSV uses the same path as the input but with a
-".valid.csv" suffix.`,
+If the file has a ".vcf" extension, it is read as vCards
+(version 3.0 or 4.0) rather than as CSV.
+
+The export uses the same path and format as the input but with
+a ".valid" suffix before the extension.
+
+A report of every problem found is also written, with the row
+number, field, raw value, error class, and a suggested fix where
+one can be derived (such as a missing '+' on an international
+number). By default the report is a CSV at the input path with
+a ".report.csv" suffix; use --report to choose another path, and
+give it a ".json" extension to get JSON instead. With --apply-fixes,
+the suggested fixes are applied to a copy of the input (with a
+".fixed" suffix before the extension), and the export is made
+from the fixed copy.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Default().SetFlags(0)
-		validate(args[0])
+		profile, _ := cmd.Flags().GetString("profile")
+		report, _ := cmd.Flags().GetString("report")
+		applyFixes, _ := cmd.Flags().GetBool("apply-fixes")
+		validate(args[0], profile, report, applyFixes)
 	},
 }
 
@@ -39,16 +64,60 @@ func init() {
 	contactsCmd.AddCommand(validateCmd)
 
 	validateCmd.Args = cobra.ExactArgs(1)
+	validateCmd.Flags().String("profile", "dialpad", "Column profile name or YAML path")
+	validateCmd.Flags().String("report", "", "Path of the validation report (.csv or .json)")
+	validateCmd.Flags().Bool("apply-fixes", false, "Write a copy of the input with suggested fixes applied")
 }
 
-func validate(path string) {
-	entries, err := contacts.ParseContacts(path, true)
+func validate(path, profileName, reportPath string, applyFixes bool) {
+	profile := lookupProfile(profileName)
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	if contacts.IsVCardPath(path) {
+		if applyFixes {
+			log.Fatalf("Fixes can only be applied to CSV files")
+		}
+		entries, err := contacts.ParseProfileContacts(path, profile, true)
+		if err != nil {
+			log.Fatalf("Could not read file at path %s: %v", path, err)
+		}
+		exportValid(entries, base+".valid"+ext)
+		return
+	}
+	entries, issues, err := contacts.ValidateProfileContacts(path, profile)
 	if err != nil {
 		log.Fatalf("Could not read file at path %s: %v", path, err)
 	}
-	path = strings.TrimSuffix(path, ".csv") + ".valid.csv"
-	err = contacts.ExportContacts(entries, path)
-	if err != nil {
+	contacts.LogValidationIssues(issues)
+	if reportPath == "" {
+		reportPath = base + ".report.csv"
+	}
+	if err = contacts.ExportValidationReport(issues, reportPath); err != nil {
+		log.Fatalf("Could not write report at path %s: %v", reportPath, err)
+	}
+	fixable := 0
+	for _, issue := range issues {
+		if issue.Fix != "" {
+			fixable++
+		}
+	}
+	log.Printf("%d issues (%d with suggested fixes) written to path %s", len(issues), fixable, reportPath)
+	if applyFixes {
+		fixedPath := base + ".fixed" + ext
+		count, err := contacts.ApplyFixes(path, issues, fixedPath)
+		if err != nil {
+			log.Fatalf("Could not write file at path %s: %v", fixedPath, err)
+		}
+		log.Printf("%d fixes applied in path %s", count, fixedPath)
+		if entries, err = contacts.ParseProfileContacts(fixedPath, profile, false); err != nil {
+			log.Fatalf("Could not read file at path %s: %v", fixedPath, err)
+		}
+	}
+	exportValid(entries, base+".valid"+ext)
+}
+
+func exportValid(entries []contacts.Entry, path string) {
+	if err := contacts.ExportContacts(entries, path); err != nil {
 		log.Fatalf("Could not write file at path %s: %v", path, err)
 	}
 	log.Printf("%d valid entries written to path %s", len(entries), path)
@@ -7,7 +7,16 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
 	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
 )
 
 // historyContactsCmd represents the contacts command
@@ -15,9 +24,70 @@ var contactsCmd = &cobra.Command{
 	Use:   "contacts",
 	Short: "Operate on dialpad contacts",
 	Long: `This command allows you to operate on a spreadsheet of Dialpad contacts.
-You must specify an operation and the path to the CSV file(s) to be operated on.`,
+You must specify an operation and the path to the CSV file(s) to be operated on.
+
+Phone numbers without an international prefix are assumed to be in
+the region given by --region (an ISO 3166 code such as US or GB).`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		region, _ := cmd.Flags().GetString("region")
+		if err := contacts.SetDefaultRegion(region); err != nil {
+			log.Fatalf("Can't use region: %v", err)
+		}
+		contacts.StartAudit(strings.Join(os.Args, " "))
+	},
 }
 
 func init() {
 	rootCmd.AddCommand(contactsCmd)
+	contactsCmd.PersistentFlags().String("region", "US", "Default region for phone numbers")
+}
+
+// interruptContext returns a context that is cancelled by Ctrl-C,
+// so long-running operations can stop cleanly.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// writeContacts updates or deletes the contacts in bulk, and exports
+// the result for each contact to resultsPath. It returns the number
+// of contacts that were not written.
+func writeContacts(ctx context.Context, action contacts.BulkAction, entries []contacts.Entry, resultsPath string) int {
+	return reportResults(contacts.BulkWrite(ctx, action, entries), resultsPath)
+}
+
+// reportResults logs the failures among the results of a bulk write, and
+// exports all the results to resultsPath. It returns the number of failures.
+func reportResults(results []contacts.BulkResult, resultsPath string) int {
+	failures := contacts.BulkFailures(results)
+	if err := contacts.ExportBulkResults(results, resultsPath); err != nil {
+		log.Fatalf("Can't export results to %q: %v", resultsPath, err)
+	}
+	if len(failures) == 0 {
+		log.Printf("Results for %d contacts are exported to %q", len(results), resultsPath)
+		return 0
+	}
+	var unattempted int
+	log.Printf("Failed to write %d contacts (%s):", len(failures), contacts.SummarizeErrors(contacts.BulkErrors(failures)))
+	for _, f := range failures {
+		if errors.Is(f.Err, context.Canceled) {
+			unattempted++
+			continue
+		}
+		log.Printf("--> %s %s: %v", f.Action, f.Entry.Uid, f.Err)
+	}
+	if unattempted > 0 {
+		log.Printf("--> %d contacts were not written because of an interrupt", unattempted)
+	}
+	log.Printf("Results for %d contacts are exported to %q", len(results), resultsPath)
+	log.Printf("To retry the failures, use: contacts resubmit %s", resultsPath)
+	return len(failures)
+}
+
+// lookupProfile returns the named column profile, exiting if there is none.
+func lookupProfile(name string) contacts.ColumnProfile {
+	profile, err := contacts.LookupProfile(name)
+	if err != nil {
+		log.Fatalf("Can't use column profile: %v", err)
+	}
+	return profile
 }
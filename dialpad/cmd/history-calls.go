@@ -0,0 +1,134 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/clickonetwo/automations/dialpad/internal/history"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// callsCmd represents the calls command
+var callsCmd = &cobra.Command{
+	Use:   "calls [flags] [path-to-report.csv[.age]]",
+	Short: "Manage the call history known to the history server",
+	Long: `The history server loads a call history from AWS each time it starts,
+and shows the calls with a phone along with the texts.  This command
+initializes or updates that history from a downloaded calls report.
+If the report path ends in ".age", it's decrypted before being imported.
+As with the sms command, --update merges the report's calls into the
+stored history, and --initialize replaces the stored calls of the months
+the report covers.
+
+With --sync, no report path is needed: a report of the calls since the
+last stored call is requested from Dialpad, downloaded (encrypted) into
+the --work-dir once it's ready, and merged into the stored history,
+just as the sms command does for texts.
+
+The history is stored in monthly partitions, which can be listed with
+--manifest and archived with --archive-before and --unarchive-before,
+as with the sms command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetFlags(0)
+		envName, _ := cmd.InheritedFlags().GetString("env")
+		if err := storage.PushConfig(envName); err != nil {
+			panic(err)
+		}
+		defer storage.PopConfig()
+		initialize, _ := cmd.Flags().GetCount("initialize")
+		update, _ := cmd.Flags().GetCount("update")
+		sync, _ := cmd.Flags().GetCount("sync")
+		manifest, _ := cmd.Flags().GetCount("manifest")
+		archive, _ := cmd.Flags().GetString("archive-before")
+		unarchive, _ := cmd.Flags().GetString("unarchive-before")
+		if manifest > 0 || archive != "" || unarchive != "" || sync > 0 {
+			if len(args) > 0 {
+				log.Fatalf("No report path is needed with --sync, --manifest, --archive-before, or --unarchive-before")
+			}
+		} else if len(args) != 1 {
+			log.Fatalf("A report path is required")
+		}
+		switch {
+		case sync > 0:
+			workDir, _ := cmd.Flags().GetString("work-dir")
+			syncCallHistory(workDir)
+		case manifest > 0 || archive != "" || unarchive != "":
+			if archive != "" {
+				archiveHistory("call", history.ArchiveCallHistory, archive, true)
+			} else if unarchive != "" {
+				archiveHistory("call", history.ArchiveCallHistory, unarchive, false)
+			}
+			showManifest("call", history.DownloadCallManifest)
+		case initialize > 0:
+			updateCallHistory(args[0], true)
+		case update > 0:
+			updateCallHistory(args[0], false)
+		}
+	},
+}
+
+func init() {
+	historyCmd.AddCommand(callsCmd)
+	callsCmd.Args = cobra.MaximumNArgs(1)
+	callsCmd.Flags().Count("initialize", "initialize call history from report")
+	callsCmd.Flags().Count("update", "update call history from report")
+	callsCmd.Flags().Count("sync", "request, download, and merge a report of new calls")
+	callsCmd.Flags().String("work-dir", ".", "with --sync, the directory to download the report into")
+	callsCmd.Flags().Count("manifest", "list the stored monthly partitions of the call history")
+	callsCmd.Flags().String("archive-before", "", "archive the partitions of months before this one (2006-01)")
+	callsCmd.Flags().String("unarchive-before", "", "unarchive the partitions of months before this one (2006-01)")
+	callsCmd.MarkFlagsOneRequired("initialize", "update", "sync", "manifest", "archive-before", "unarchive-before")
+	callsCmd.MarkFlagsMutuallyExclusive("initialize", "update", "sync", "manifest", "archive-before", "unarchive-before")
+}
+
+func syncCallHistory(workDir string) {
+	ctx, stop := interruptContext()
+	defer stop()
+	added, err := history.SyncCallHistory(ctx, history.CallHistorySync, workDir, log.Printf)
+	if err != nil {
+		log.Fatalf("Sync failed, run it again to resume: %v", err)
+	}
+	log.Printf("Successfully synced the call history: %d calls added.", added)
+}
+
+// updateCallHistory imports a calls report and merges it into the stored
+// history or, if initialize is true, replaces the stored calls of the
+// months the report covers with it.
+func updateCallHistory(path string, initialize bool) {
+	log.Printf("Importing call history from %q...", path)
+	var calls []history.CallRecord
+	var err error
+	if strings.HasSuffix(path, ".age") {
+		calls, err = history.ImportEncryptedCallRecords(path)
+	} else {
+		calls, err = history.ImportCallRecords(path)
+	}
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+	if initialize {
+		log.Printf("Uploading call history (%d calls) to AWS...", len(calls))
+		if err = history.UploadCallHistory(calls); err != nil {
+			log.Fatalf("Upload failed: %v", err)
+		}
+		log.Printf("Successfully initialized the call history.")
+		return
+	}
+	log.Printf("Merging %d calls into the call history in AWS...", len(calls))
+	added, err := history.MergeCallHistory(calls)
+	if err != nil {
+		log.Fatalf("Upload failed: %v", err)
+	}
+	if added == 0 {
+		log.Fatalf("No calls that aren't already in the history found to import")
+	}
+	log.Printf("Successfully uploaded the call history with %d new calls.", added)
+}
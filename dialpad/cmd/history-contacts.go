@@ -54,9 +54,9 @@ func updateContacts() []contacts.Entry {
 	if errs != nil {
 		log.Fatalf("Dialpad fetch failed: %v", errs)
 	}
+	applySavedExtensions(allContacts)
 	log.Printf("Uploading contacts to AWS...")
-	err := contacts.UploadAllContacts(allContacts)
-	if err != nil {
+	if err := contacts.UploadAllContacts(allContacts); err != nil {
 		log.Fatalf("AWS upload failed: %v", err)
 	}
 	log.Printf("Contacts update complete.")
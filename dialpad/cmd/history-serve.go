@@ -7,6 +7,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -25,24 +26,39 @@ import (
 // serveCmd represents the serve command
 var serveCmd = &cobra.Command{
 	Use:   "serve",
-	Short: "Serve SMS history from Dialpad",
-	Long: `This command runs a server for SMS history from Dialpad.
-The server has an HTML interface that is served from the root.`,
+	Short: "Serve SMS and call history from Dialpad",
+	Long: `This command runs a server for SMS and call history from Dialpad.
+The server has an HTML interface that is served from the root.
+
+With --sync-every, the server also brings its SMS and call histories up
+to date with Dialpad on that schedule, as the history sms --sync and
+history calls --sync commands do.
+A sync that's interrupted by a restart is resumed by the next one.
+
+The users, SMS and call histories, and contacts are loaded when the server starts.
+An admin can reload them without a restart by posting to /admin/reload,
+and with --reload-every the server reloads them on that schedule.
+Reloaded data is swapped in only once all of it has been loaded, and
+the status of reloads is reported by /status.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		envName, err := cmd.InheritedFlags().GetString("env")
 		if err != nil {
 			panic(err)
 		}
-		serveHistory(envName)
+		syncEvery, _ := cmd.Flags().GetDuration("sync-every")
+		reloadEvery, _ := cmd.Flags().GetDuration("reload-every")
+		serveHistory(envName, syncEvery, reloadEvery)
 		fmt.Println("serve called")
 	},
 }
 
 func init() {
 	historyCmd.AddCommand(serveCmd)
+	serveCmd.Flags().Duration("sync-every", 0, "sync the SMS and call histories with Dialpad this often (e.g. 24h)")
+	serveCmd.Flags().Duration("reload-every", 0, "reload users, history, and contacts this often (e.g. 1h)")
 }
 
-func serveHistory(envName string) {
+func serveHistory(envName string, syncEvery, reloadEvery time.Duration) {
 	startTime := time.Now().In(history.PT)
 	err := storage.PushConfig(envName)
 	if err != nil {
@@ -60,17 +76,29 @@ func serveHistory(envName string) {
 		panic(err)
 	}
 	defer logger.Sync()
-	logger.Info("Starting resource downloads for users, events, and contacts")
+	logger.Info("Starting resource downloads for users, events, calls, and contacts")
 	if err = users.LoadUsers(); err != nil {
 		logger.Panic("error loading users", zap.Error(err))
 	}
 	if err = history.LoadEventHistory(); err != nil {
 		logger.Panic("error loading event history", zap.Error(err))
 	}
+	if err = history.LoadCallHistory(); err != nil {
+		logger.Panic("error loading call history", zap.Error(err))
+	}
 	if err = history.LoadAllContacts(); err != nil {
 		logger.Panic("error loading contacts", zap.Error(err))
 	}
-	logger.Info("Completed resource downloads for users, events, and contacts")
+	logger.Info("Completed resource downloads for users, events, calls, and contacts")
+	if syncEvery > 0 {
+		go syncHistoryEvery(syncEvery, logger)
+	}
+	if reloadEvery > 0 {
+		stop := history.ReloadEvery(reloadEvery, func(format string, args ...any) {
+			logger.Info(fmt.Sprintf(format, args...))
+		})
+		defer stop()
+	}
 	if config.Name == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -81,6 +109,7 @@ func serveHistory(envName string) {
 			"env":     config.Name,
 			"started": startTime.Format(time.RFC850),
 			"time":    time.Since(startTime).String(),
+			"reload":  history.CurrentReloadStatus(),
 		})
 	})
 	r.GET("/", func(c *gin.Context) {
@@ -88,7 +117,9 @@ func serveHistory(envName string) {
 	})
 	r.GET("/history", users.CheckLoginMiddleware, history.RequestHandler)
 	r.GET("/search", users.CheckLoginMiddleware, history.SearchHandler)
+	r.GET("/api/contacts/search", history.SearchApiHandler)
 	r.GET("/stats", history.StatsHandler)
+	r.POST("/admin/reload", history.ReloadHandler)
 	r.GET("/login", users.LoginHandler)
 	r.GET("/logout", users.LogoutHandler)
 	port, found := os.LookupEnv("PORT")
@@ -108,3 +139,33 @@ func serveHistory(envName string) {
 		panic(err)
 	}
 }
+
+// syncHistoryEvery syncs the SMS and call histories with Dialpad on a schedule,
+// starting right away (so an interrupted sync is resumed promptly).
+func syncHistoryEvery(every time.Duration, logger *zap.Logger) {
+	logf := func(format string, args ...any) {
+		logger.Info(fmt.Sprintf(format, args...))
+	}
+	syncs := []struct {
+		noun string
+		sync func(context.Context, history.HistorySyncJob, string, func(string, ...any)) (int, error)
+		job  history.HistorySyncJob
+	}{
+		{"SMS", history.SyncSmsHistory, history.SmsHistorySync},
+		{"call", history.SyncCallHistory, history.CallHistorySync},
+	}
+	for {
+		for _, s := range syncs {
+			logger.Info(fmt.Sprintf("Starting scheduled %s history sync", s.noun))
+			ctx, cancel := context.WithTimeout(context.Background(), every)
+			added, err := s.sync(ctx, s.job, os.TempDir(), logf)
+			cancel()
+			if err != nil {
+				logger.Error(fmt.Sprintf("Scheduled %s history sync failed", s.noun), zap.Error(err))
+			} else {
+				logger.Info(fmt.Sprintf("Completed scheduled %s history sync", s.noun), zap.Int("added", added))
+			}
+		}
+		time.Sleep(every)
+	}
+}
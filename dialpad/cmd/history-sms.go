@@ -7,11 +7,14 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"os"
 	"strings"
+	"text/tabwriter"
 	"time"
 
-	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 
 	"github.com/clickonetwo/automations/dialpad/internal/history"
@@ -20,11 +23,25 @@ import (
 
 // smsCmd represents the sms command
 var smsCmd = &cobra.Command{
-	Use:   "sms [flags] path-to-report.csv[.age]",
+	Use:   "sms [flags] [path-to-report.csv[.age]]",
 	Short: "Manage the SMS event history known to the history server",
 	Long: `The history server loads an SMS event history from AWS each time it starts.
 This command allows initializing or updating that history from a downloaded SMS report.
-If the report path ends in ".age", it's decrypted before being imported.`,
+If the report path ends in ".age", it's decrypted before being imported.
+With --update, the report's events are merged into the stored history.
+With --initialize, they replace the stored events of the months they cover,
+and the stored events of other months are left alone.
+
+With --sync, no report path is needed: a report of the texts since the
+last stored event is requested from Dialpad, downloaded (encrypted) into
+the --work-dir once it's ready, and merged into the stored history.
+The progress of the sync is saved, so if it's interrupted (with ^C or
+otherwise), running it again resumes where it left off.
+
+The history is stored in monthly partitions.  With --manifest, the stored
+partitions are listed.  With --archive-before MONTH (such as 2023-01), the
+partitions of earlier months are archived, so they are kept but no longer
+loaded by the history server; --unarchive-before MONTH restores them.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.SetFlags(0)
 		envName, _ := cmd.InheritedFlags().GetString("env")
@@ -35,6 +52,33 @@ If the report path ends in ".age", it's decrypted before being imported.`,
 		update, _ := cmd.Flags().GetCount("update")
 		initialize, _ := cmd.Flags().GetCount("initialize")
 		id, _ := cmd.Flags().GetString("download-report")
+		sync, _ := cmd.Flags().GetCount("sync")
+		manifest, _ := cmd.Flags().GetCount("manifest")
+		archive, _ := cmd.Flags().GetString("archive-before")
+		unarchive, _ := cmd.Flags().GetString("unarchive-before")
+		if manifest > 0 || archive != "" || unarchive != "" {
+			if len(args) > 0 {
+				log.Fatalf("No report path is needed with --manifest, --archive-before, or --unarchive-before")
+			}
+			if archive != "" {
+				archiveHistory("SMS", history.ArchiveSmsHistory, archive, true)
+			} else if unarchive != "" {
+				archiveHistory("SMS", history.ArchiveSmsHistory, unarchive, false)
+			}
+			showManifest("SMS", history.DownloadSmsManifest)
+			return
+		}
+		if sync > 0 {
+			if len(args) > 0 {
+				log.Fatalf("No report path is needed with --sync")
+			}
+			workDir, _ := cmd.Flags().GetString("work-dir")
+			syncHistory(workDir)
+			return
+		}
+		if len(args) != 1 {
+			log.Fatalf("A report path is required")
+		}
 		if initialize > 0 {
 			initializeHistory(args[0])
 		} else if update > 0 {
@@ -47,13 +91,71 @@ If the report path ends in ".age", it's decrypted before being imported.`,
 
 func init() {
 	historyCmd.AddCommand(smsCmd)
-	smsCmd.Args = cobra.ExactArgs(1)
+	smsCmd.Args = cobra.MaximumNArgs(1)
 	smsCmd.Flags().Count("initialize", "initialize SMS history from report")
 	smsCmd.Flags().Count("update", "update SMS history from report")
 	smsCmd.Flags().Count("request-report", "request report for SMS history update")
 	smsCmd.Flags().String("download-report", "", "download requested SMS history report")
-	smsCmd.MarkFlagsOneRequired("initialize", "update", "request-report", "download-report")
-	smsCmd.MarkFlagsMutuallyExclusive("initialize", "update", "request-report", "download-report")
+	smsCmd.Flags().Count("sync", "request, download, and merge a report of new texts")
+	smsCmd.Flags().String("work-dir", ".", "with --sync, the directory to download the report into")
+	smsCmd.Flags().Count("manifest", "list the stored monthly partitions of the SMS history")
+	smsCmd.Flags().String("archive-before", "", "archive the partitions of months before this one (2006-01)")
+	smsCmd.Flags().String("unarchive-before", "", "unarchive the partitions of months before this one (2006-01)")
+	smsCmd.MarkFlagsOneRequired("initialize", "update", "request-report", "download-report", "sync",
+		"manifest", "archive-before", "unarchive-before")
+	smsCmd.MarkFlagsMutuallyExclusive("initialize", "update", "request-report", "download-report", "sync",
+		"manifest", "archive-before", "unarchive-before")
+}
+
+// archiveHistory archives (or unarchives) the partitions of a history before a month.
+func archiveHistory(noun string, archiveFn func(string, bool) (int, error), before string, archive bool) {
+	verb := "Archived"
+	if !archive {
+		verb = "Unarchived"
+	}
+	changed, err := archiveFn(before, archive)
+	if err != nil {
+		log.Fatalf("Failed to update the %s history manifest: %v", noun, err)
+	}
+	log.Printf("%s %d partitions before %s.", verb, changed, before)
+}
+
+// showManifest lists the partitions of a history.
+func showManifest(noun string, load func() (history.Manifest, error)) {
+	manifest, err := load()
+	if storage.IsBlobNotFound(err) {
+		log.Fatalf("The %s history hasn't been partitioned yet; update or sync it to partition it.", noun)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load the %s history manifest: %v", noun, err)
+	}
+	log.Printf("%s history manifest, updated %s:", noun, time.UnixMicro(manifest.Updated).Format(time.RFC1123))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "Month\tRecords\tFirst\tLast\tArchived\tChecksum")
+	total := 0
+	for _, p := range manifest.Partitions {
+		archived := ""
+		if p.Archived {
+			archived = "yes"
+		} else {
+			total += p.Count
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", p.Month, p.Count,
+			time.UnixMicro(p.MinDate).Format(time.DateTime), time.UnixMicro(p.MaxDate).Format(time.DateTime),
+			archived, p.Checksum[:12])
+	}
+	_ = w.Flush()
+	log.Printf("%d partitions, %d records loaded by the history server.", len(manifest.Partitions), total)
+}
+
+func syncHistory(workDir string) {
+	ctx, stop := interruptContext()
+	defer stop()
+	added, err := history.SyncSmsHistory(ctx, history.SmsHistorySync, workDir, log.Printf)
+	if err != nil {
+		log.Fatalf("Sync failed, run it again to resume: %v", err)
+	}
+	log.Printf("Successfully synced the SMS history: %d events added.", added)
 }
 
 func initializeHistory(path string) {
@@ -77,13 +179,9 @@ func initializeHistory(path string) {
 }
 
 func updateHistory(path string) {
-	log.Printf("Downloading existing SMS history...")
-	err := history.LoadEventHistory()
-	if err != nil {
-		log.Fatalf("Failed to load existing history: %v", err)
-	}
 	log.Printf("Importing additional history from %q...", path)
 	var events []history.SmsEvent
+	var err error
 	if strings.HasSuffix(path, ".age") {
 		events, err = history.ImportEncryptedSmsEvents(path)
 	} else {
@@ -92,25 +190,15 @@ func updateHistory(path string) {
 	if err != nil {
 		log.Fatalf("Import failed: %v", err)
 	}
-	log.Printf("Successfully imported %d SMS events, starting merge...", len(events))
-	earliest := history.EventHistory[len(history.EventHistory)-1].Date
-	firstLater := -1
-	for index, event := range events {
-		if event.Date > earliest {
-			firstLater = index
-			break
-		}
-	}
-	if firstLater == -1 {
-		log.Fatalf("No events later than existing found to import")
-	}
-	log.Printf("Merging %d later events and uploading to AWS...", len(events)-firstLater)
-	history.EventHistory = append(history.EventHistory, events[firstLater:]...)
-	err = history.UploadSmsHistory(events)
+	log.Printf("Successfully imported %d SMS events, merging them into the history in AWS...", len(events))
+	added, err := history.MergeSmsHistory(events)
 	if err != nil {
 		log.Fatalf("Upload failed: %v", err)
 	}
-	log.Printf("Successfully uploaded the updated SMS history.")
+	if added == 0 {
+		log.Fatalf("No events that aren't already in the history found to import")
+	}
+	log.Printf("Successfully uploaded the updated SMS history with %d new events.", added)
 }
 
 func requestReport(id, path string) {
@@ -120,7 +208,7 @@ func requestReport(id, path string) {
 		if err != nil {
 			log.Fatalf("Failed to load existing history: %v", err)
 		}
-		earliest := history.EventHistory[len(history.EventHistory)-1].Date
+		earliest := history.LastEventDate(history.EventHistory)
 		log.Printf("Last SMS in history is dated %s", time.UnixMicro(earliest).Format(time.RFC1123))
 		log.Printf("Requesting a report for all days since then...")
 		id, err = history.RequestSmsReport(earliest)
@@ -129,19 +217,12 @@ func requestReport(id, path string) {
 		}
 	}
 	log.Printf("Waiting for report with id %s (^C to stop)...", id)
-	var url string
-	var err error
-	bar := progressbar.Default(-1, "Waiting for report")
-	for wait := false; url == "" && err == nil; wait = true {
-		if wait {
-			for i := 0; i < 20; i++ {
-				time.Sleep(time.Second / 4)
-				_ = bar.Add(1)
-			}
-		}
-		url, err = history.GetSmsReportDownloadUrl(id)
+	ctx, stop := interruptContext()
+	defer stop()
+	url, err := history.WaitForSmsReport(ctx, id)
+	if errors.Is(err, history.ReportFailed) {
+		log.Fatalf("The report won't be ready, request a new one: %v", err)
 	}
-	_ = bar.Close()
 	if err != nil {
 		log.Fatalf("Couldn't wait for report, try again with --download-report %s: %v", id, err)
 	}
@@ -0,0 +1,279 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// The scopes of Dialpad contacts: company contacts are shared by everyone,
+// while user and office contacts are private to their account.
+const (
+	CompanyScope = "company"
+	UserScope    = "user"
+	OfficeScope  = "office"
+)
+
+var (
+	AccountColumnNames          = append([]string{"Scope", "Owner", "Owner Name"}, ExportColumnNames...)
+	AccountDuplicateColumnNames = append([]string{"Group", "Score"}, AccountColumnNames...)
+)
+
+// An Account is a Dialpad user or office that has its own contacts.
+type Account struct {
+	Id    string
+	Name  string
+	Scope string
+}
+
+type office struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type officePage struct {
+	Cursor string   `json:"cursor"`
+	Items  []office `json:"items"`
+}
+
+// FetchOffices returns the accounts of the company's offices.
+//
+// (The accounts of the company's users come from [users.FetchDialpadUsers],
+// which can't be called from here.)
+func FetchOffices() ([]Account, error) {
+	var results []Account
+	key := storage.GetConfig().DialpadApiKey
+	baseUrl := fmt.Sprintf("%s/offices?limit=100&apikey=%s", DialpadApiRoot, key)
+	cursor := ""
+	for {
+		url := baseUrl
+		if cursor != "" {
+			url = fmt.Sprintf("%s&cursor=%s", url, cursor)
+		}
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Add("accept", "application/json")
+		resp, err := DialPadListClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("offices: %w", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("offices: %w", statusError(resp, body))
+		}
+		var result officePage
+		if err = json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("offices: %w", &RequestError{Class: ResponseError, Err: err})
+		}
+		for _, o := range result.Items {
+			results = append(results, Account{Id: o.Id, Name: o.Name, Scope: OfficeScope})
+		}
+		cursor = result.Cursor
+		if cursor == "" || len(result.Items) == 0 {
+			break
+		}
+	}
+	return results, nil
+}
+
+// ListAccountContacts downloads the company contacts and the private
+// contacts of each of the given accounts, tagging each entry with its
+// scope and owner.  Company contacts have no owner.
+//
+// Contacts that Dialpad lists in an account but that are really company
+// contacts are only returned once, as company contacts.  An account whose
+// contacts can't be downloaded is skipped, so the results are incomplete
+// whenever errs is non-nil.
+func ListAccountContacts(ctx context.Context, accounts []Account) (results []Entry, errs []error) {
+	company, errs := ListContactsContext(ctx, "", nil)
+	if errs != nil {
+		return nil, errs
+	}
+	shared := make(map[string]bool, len(company))
+	for _, entry := range company {
+		entry.Scope = CompanyScope
+		shared[entry.FullId] = true
+		results = append(results, entry)
+	}
+	for _, account := range accounts {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			return
+		}
+		entries, accountErrs := ListContactsContext(ctx, account.Id, nil)
+		if accountErrs != nil {
+			for _, err := range accountErrs {
+				errs = append(errs, fmt.Errorf("%s account %s (%s): %w", account.Scope, account.Id, account.Name, err))
+			}
+			continue
+		}
+		for _, entry := range entries {
+			if shared[entry.FullId] {
+				continue
+			}
+			entry.Scope, entry.Owner = account.Scope, account.Id
+			results = append(results, entry)
+		}
+	}
+	return
+}
+
+// FindCrossAccountDuplicates is [FindDuplicates] for contacts from several accounts,
+// returning only the groups that span more than one account (or the company
+// and an account): the same person stored in several people's lists.
+func FindCrossAccountDuplicates(entries []Entry, minScore int) []DuplicateGroup {
+	var results []DuplicateGroup
+	for _, group := range FindDuplicates(entries, minScore) {
+		owner := group.Members[0].Scope + "/" + group.Members[0].Owner
+		if slices.ContainsFunc(group.Members[1:], func(e Entry) bool { return e.Scope+"/"+e.Owner != owner }) {
+			results = append(results, group)
+		}
+	}
+	return results
+}
+
+// PlanPromotions decides which private contacts to promote to company contacts.
+//
+// A private contact with the same name and primary phone as a company contact
+// is skipped, since it's already shared.  Private contacts with the same name
+// and primary phone in several accounts are promoted once, with all their
+// phones and emails.  Each promoted contact keeps its UID (so it keeps its
+// creation date) unless that's already used by a company contact, in which
+// case it gets a new UID derived from its owner and ID.
+func PlanPromotions(private, company []Entry) (promote, skipped []Entry) {
+	sharedKeys := make(map[string]bool, len(company))
+	sharedUids := make(map[string]bool, len(company))
+	for _, entry := range company {
+		sharedKeys[nameAndPhoneKey(entry)] = true
+		sharedUids[entry.Uid] = true
+	}
+	groups := make(map[string][]Entry)
+	var keys []string
+	for _, entry := range private {
+		key := nameAndPhoneKey(entry)
+		if sharedKeys[key] {
+			skipped = append(skipped, entry)
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], entry)
+	}
+	for _, key := range keys {
+		members := groups[key]
+		entry := MergeInfo(members[0], members[1:])
+		entry.FullId, entry.Scope, entry.Owner, entry.Type = "", "", "", ""
+		if entry.Uid == "" || sharedUids[entry.Uid] {
+			entry.Uid = derivedUid(members[0].Owner + "\x00" + members[0].FullId)
+		}
+		sharedUids[entry.Uid] = true
+		promote = append(promote, entry)
+	}
+	return
+}
+
+// ExportAccountContacts writes a spreadsheet of contacts from several accounts,
+// as [ExportContacts] does but with columns for each contact's scope and owner.
+func ExportAccountContacts(entries []Entry, accounts []Account, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	defer writer.Flush()
+	if err = writer.Write(AccountColumnNames); err != nil {
+		log.Panicf("error writing record to csv: %v", err)
+	}
+	names := accountNames(accounts)
+	for _, entry := range entries {
+		if err = writer.Write(accountRecord(entry, names)); err != nil {
+			log.Panicf("error writing record to csv: %v", err)
+		}
+	}
+	return nil
+}
+
+// ExportAccountDuplicates writes the groups found by [FindCrossAccountDuplicates],
+// one row per member, with the scope and owner of each member.
+func ExportAccountDuplicates(groups []DuplicateGroup, accounts []Account, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	defer writer.Flush()
+	if err = writer.Write(AccountDuplicateColumnNames); err != nil {
+		log.Panicf("error writing record to csv: %v", err)
+	}
+	names := accountNames(accounts)
+	for i, group := range groups {
+		prefix := []string{strconv.Itoa(i + 1), strconv.Itoa(group.Score)}
+		for _, member := range group.Members {
+			if err = writer.Write(append(prefix, accountRecord(member, names)...)); err != nil {
+				log.Panicf("error writing record to csv: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ImportAccountContacts reads a spreadsheet in the format written by [ExportAccountContacts].
+func ImportAccountContacts(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := storage.BOMAwareCSVReader(f)
+	record, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkExportColumns(record, AccountColumnNames[:3]); err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		entry := recordEntry(record[3:])
+		entry.Scope, entry.Owner = record[0], record[1]
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func accountRecord(entry Entry, names map[string]string) []string {
+	return append([]string{entry.Scope, entry.Owner, names[entry.Owner]}, entryRecord(entry)...)
+}
+
+func accountNames(accounts []Account) map[string]string {
+	names := make(map[string]string, len(accounts))
+	for _, account := range accounts {
+		names[account.Id] = account.Name
+	}
+	return names
+}
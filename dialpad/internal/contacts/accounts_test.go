@@ -0,0 +1,113 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+func TestListAccountContacts(t *testing.T) {
+	if err := storage.PushConfig("ci"); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.PopConfig()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page entryPage
+		switch r.URL.Query().Get("accountId") {
+		case "":
+			page.Items = []Entry{{FullId: "shared_contact_a_uid_1"}}
+		case "u1":
+			page.Items = []Entry{{FullId: "shared_contact_a_uid_1"}, {FullId: "local_contact_b_uid_2"}}
+		case "o1":
+			page.Items = []Entry{{FullId: "local_contact_c_uid_3"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+	savedRoot, savedClient := DialpadApiRoot, DialPadListClient
+	DialpadApiRoot, DialPadListClient = server.URL, testClient()
+	defer func() { DialpadApiRoot, DialPadListClient = savedRoot, savedClient }()
+
+	accounts := []Account{
+		{Id: "u1", Name: "Ann Smith", Scope: UserScope},
+		{Id: "u2", Name: "Gone User", Scope: UserScope},
+		{Id: "o1", Name: "Main Office", Scope: OfficeScope},
+	}
+	entries, errs := ListAccountContacts(context.Background(), accounts)
+	if len(errs) != 1 {
+		t.Errorf("expected 1 error for the missing account, got %v", errs)
+	}
+	expected := []Entry{
+		{FullId: "shared_contact_a_uid_1", Uid: "1", Scope: CompanyScope},
+		{FullId: "local_contact_b_uid_2", Uid: "2", Scope: UserScope, Owner: "u1"},
+		{FullId: "local_contact_c_uid_3", Uid: "3", Scope: OfficeScope, Owner: "o1"},
+	}
+	if diff := deep.Equal(entries, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestPlanPromotions(t *testing.T) {
+	company := []Entry{
+		{FullId: "shared_contact_a_uid_1", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}},
+	}
+	private := []Entry{
+		{FullId: "local_b_uid_2", Uid: "2", FirstName: "ann", LastName: "smith", Phones: []string{"+15105551234"}, Scope: UserScope, Owner: "u1"},
+		{FullId: "local_c_uid_1", Uid: "1", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105554321"}, Scope: UserScope, Owner: "u1"},
+		{FullId: "local_d_uid_4", Uid: "4", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105554321"}, Emails: []string{"bob@example.com"}, Scope: OfficeScope, Owner: "o1"},
+	}
+	promote, skipped := PlanPromotions(private, company)
+	if len(skipped) != 1 || skipped[0].FullId != "local_b_uid_2" {
+		t.Errorf("skipped: %v", skipped)
+	}
+	if len(promote) != 1 {
+		t.Fatalf("expected 1 promotion, got %v", promote)
+	}
+	bob := promote[0]
+	if bob.FullId != "" || bob.Scope != "" || bob.Owner != "" {
+		t.Errorf("promoted contact is still private: %v", bob)
+	}
+	if bob.Uid == "1" || bob.Uid == "" {
+		t.Errorf("promoted contact reuses a company UID: %q", bob.Uid)
+	}
+	if diff := deep.Equal(bob.Emails, []string{"bob@example.com"}); diff != nil {
+		t.Errorf("promoted emails: %v", diff)
+	}
+}
+
+func TestExportImportAccountContacts(t *testing.T) {
+	entries := []Entry{
+		{FullId: "shared_contact_a_uid_1", Uid: "1", FirstName: "Ann", LastName: "Smith",
+			Phones: []string{"+15105551234"}, Emails: []string{""}, Scope: CompanyScope},
+		{FullId: "local_contact_b_uid_2", Uid: "2", FirstName: "Bob", LastName: "Jones",
+			Phones: []string{"+15105554321"}, Emails: []string{"bob@example.com"}, Scope: UserScope, Owner: "u1"},
+	}
+	accounts := []Account{{Id: "u1", Name: "Carol White", Scope: UserScope}}
+	path := filepath.Join(t.TempDir(), "accounts.csv")
+	if err := ExportAccountContacts(entries, accounts, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ImportAccountContacts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(loaded, entries); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// AuditLog is the append-only record of the changes our tools have made
+// to Dialpad contacts, kept in a stream.  The ID of the log is the account
+// whose contacts are changed, or "company" for the company contacts.
+type AuditLog string
+
+func (l AuditLog) StoragePrefix() string {
+	return "contact-audit:"
+}
+
+func (l AuditLog) StorageId() string {
+	return string(l)
+}
+
+var CompanyAuditLog = AuditLog("company")
+
+// An AuditRecord describes one change to a contact.
+//
+// Diff is the difference between the contact before and after the change,
+// one line per changed field or element (see auditDiff).  Hash is the [ContentHash] of the contact
+// after the change (empty for deletions), so later edits made in Dialpad
+// can be detected.  Operator is the login of the person who ran the tool,
+// Environment the configuration it used, and Command the command line.
+type AuditRecord struct {
+	Id          string
+	Time        time.Time
+	Uid         string
+	FullId      string
+	Action      string
+	Diff        []string
+	Hash        string
+	Operator    string
+	Environment string
+	Command     string
+}
+
+// auditIndex lists the IDs of the records of one contact in an audit log,
+// oldest first, so its history can be read without scanning the whole log.
+// Its ID is the log's ID and the contact's UID.
+type auditIndex string
+
+func (i auditIndex) StoragePrefix() string {
+	return "contact-audit-index:"
+}
+
+func (i auditIndex) StorageId() string {
+	return string(i)
+}
+
+// index returns the index of the log's records for the contact with the given UID.
+func (l AuditLog) index(uid string) auditIndex {
+	return auditIndex(string(l) + ":" + uid)
+}
+
+// auditor records the changes made by a command, when auditing is on.
+type auditor struct {
+	mu       sync.Mutex
+	append   func(AuditRecord) error
+	operator string
+	command  string
+	known    map[string]Entry
+}
+
+var currentAuditor *auditor
+
+// StartAudit turns on recording of every contact created, updated,
+// or deleted by [UpdateContact] and [DeleteContact] (and the functions
+// that use them), attributing the changes to the given command.
+func StartAudit(command string) {
+	operator := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		operator = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		operator += "@" + host
+	}
+	currentAuditor = &auditor{append: CompanyAuditLog.Append, operator: operator, command: command, known: make(map[string]Entry)}
+}
+
+// StopAudit turns off recording of contact changes.
+func StopAudit() {
+	currentAuditor = nil
+}
+
+// AuditBaseline remembers the current state of the given contacts, so that
+// changes to them are recorded as updates or deletions with a full diff.
+// Changes to other contacts are recorded as creations (for updates) or
+// against whatever was known when they were deleted.
+func AuditBaseline(entries []Entry) {
+	a := currentAuditor
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, entry := range entries {
+		a.known[entry.Uid] = entry.asStored()
+	}
+}
+
+// auditUpdate records that Dialpad stored the entry.
+func auditUpdate(stored Entry) {
+	a := currentAuditor
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	before, ok := a.known[stored.Uid]
+	a.known[stored.Uid] = stored.asStored()
+	a.mu.Unlock()
+	action := "update"
+	if !ok {
+		action = "create"
+		before = Entry{FullId: stored.FullId, Uid: stored.Uid}
+	}
+	a.record(action, stored, auditDiff(before, stored.asStored()), ContentHash(stored))
+}
+
+// auditDelete records that Dialpad deleted the entry.
+func auditDelete(deleted Entry) {
+	a := currentAuditor
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	before, ok := a.known[deleted.Uid]
+	delete(a.known, deleted.Uid)
+	a.mu.Unlock()
+	if !ok {
+		before = deleted.asStored()
+	}
+	a.record("delete", deleted, auditDiff(before, Entry{FullId: deleted.FullId, Uid: deleted.Uid}), "")
+}
+
+// auditDiff returns the differences between two versions of a contact, in
+// the form the deep package reports them, but without its limit on how many
+// are reported, so a record never leaves out part of a change.  Nil and empty
+// slices and maps are the same.
+func auditDiff(before, after Entry) (diff []string) {
+	b, a := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := 0; i < b.NumField(); i++ {
+		name, bf, af := b.Type().Field(i).Name, b.Field(i), a.Field(i)
+		switch bf.Kind() {
+		case reflect.Slice:
+			for j := 0; j < max(bf.Len(), af.Len()); j++ {
+				bv, av := "<no value>", "<no value>"
+				if j < bf.Len() {
+					bv = fmt.Sprint(bf.Index(j))
+				}
+				if j < af.Len() {
+					av = fmt.Sprint(af.Index(j))
+				}
+				if bv != av {
+					diff = append(diff, fmt.Sprintf("%s.slice[%d]: %s != %s", name, j, bv, av))
+				}
+			}
+		case reflect.Map:
+			var keys []string
+			for _, m := range []reflect.Value{bf, af} {
+				for _, k := range m.MapKeys() {
+					if !slices.Contains(keys, k.String()) {
+						keys = append(keys, k.String())
+					}
+				}
+			}
+			slices.Sort(keys)
+			for _, k := range keys {
+				bv, av := "<does not have key>", "<does not have key>"
+				if v := bf.MapIndex(reflect.ValueOf(k)); v.IsValid() {
+					bv = fmt.Sprint(v)
+				}
+				if v := af.MapIndex(reflect.ValueOf(k)); v.IsValid() {
+					av = fmt.Sprint(v)
+				}
+				if bv != av {
+					diff = append(diff, fmt.Sprintf("%s.map[%s]: %s != %s", name, k, bv, av))
+				}
+			}
+		default:
+			if !bf.Equal(af) {
+				diff = append(diff, fmt.Sprintf("%s: %v != %v", name, bf, af))
+			}
+		}
+	}
+	return
+}
+
+// record appends a record to the log.  Failures are reported but don't stop
+// the command, since the change has already been made in Dialpad.
+func (a *auditor) record(action string, entry Entry, diff []string, hash string) {
+	r := AuditRecord{
+		Uid:         entry.Uid,
+		FullId:      entry.FullId,
+		Action:      action,
+		Diff:        diff,
+		Hash:        hash,
+		Operator:    a.operator,
+		Environment: storage.GetConfig().Name,
+		Command:     a.command,
+	}
+	if err := a.append(r); err != nil {
+		log.Printf("Warning: couldn't record the %s of contact %s in the audit log: %v", action, entry.Uid, err)
+	}
+}
+
+// Append adds a record to the log, and to the index of the contact's records.
+// Its ID and time are assigned by the log.
+func (l AuditLog) Append(r AuditRecord) error {
+	diff, err := json.Marshal(r.Diff)
+	if err != nil {
+		return err
+	}
+	fields := map[string]string{
+		"uid":         r.Uid,
+		"id":          r.FullId,
+		"action":      r.Action,
+		"diff":        string(diff),
+		"hash":        r.Hash,
+		"operator":    r.Operator,
+		"environment": r.Environment,
+		"command":     r.Command,
+	}
+	id, err := storage.AddStreamEntry(context.Background(), l, fields)
+	if err != nil {
+		return err
+	}
+	return storage.PushRange(context.Background(), l.index(r.Uid), false, id)
+}
+
+// History returns the records of the changes to the contact with the given UID,
+// oldest first.  They are found using the contact's index, so the rest of the
+// log isn't read.
+func (l AuditLog) History(uid string) ([]AuditRecord, error) {
+	ctx := context.Background()
+	ids, err := storage.FetchRange(ctx, l.index(uid), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]AuditRecord, 0, len(ids))
+	for _, id := range ids {
+		entries, err := storage.FetchStreamRange(ctx, l, id, id, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("audit record %s of contact %s is missing from the log", id, uid)
+		}
+		r, err := auditRecord(entries[0])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func auditRecord(entry storage.StreamEntry) (AuditRecord, error) {
+	r := AuditRecord{
+		Id:          entry.Id,
+		Uid:         entry.Fields["uid"],
+		FullId:      entry.Fields["id"],
+		Action:      entry.Fields["action"],
+		Hash:        entry.Fields["hash"],
+		Operator:    entry.Fields["operator"],
+		Environment: entry.Fields["environment"],
+		Command:     entry.Fields["command"],
+	}
+	if err := json.Unmarshal([]byte(entry.Fields["diff"]), &r.Diff); err != nil {
+		return r, fmt.Errorf("audit record %s has an unreadable diff: %v", entry.Id, err)
+	}
+	// stream IDs start with the time the entry was added, in milliseconds
+	millis, _, _ := strings.Cut(entry.Id, "-")
+	if ms, err := strconv.ParseInt(millis, 10, 64); err == nil {
+		r.Time = time.UnixMilli(ms)
+	}
+	return r, nil
+}
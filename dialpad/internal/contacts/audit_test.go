@@ -0,0 +1,137 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+func TestAuditor(t *testing.T) {
+	var records []AuditRecord
+	currentAuditor = &auditor{
+		append:   func(r AuditRecord) error { records = append(records, r); return nil },
+		operator: "tester",
+		command:  "dialpad contacts test",
+		known:    make(map[string]Entry),
+	}
+	defer StopAudit()
+
+	ann := Entry{FullId: "shared_contact_a_uid_1", Uid: "1", FirstName: "Ann", Phones: []string{"+15105551234"}}
+	AuditBaseline([]Entry{ann})
+	changed := ann
+	changed.LastName = "Smith"
+	auditUpdate(changed)
+	bob := Entry{FullId: "shared_contact_a_uid_2", Uid: "2", FirstName: "Bob"}
+	auditUpdate(bob)
+	auditDelete(Entry{FullId: ann.FullId, Uid: ann.Uid})
+
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d: %v", len(records), records)
+	}
+	actions := []string{"update", "create", "delete"}
+	for i, r := range records {
+		if r.Action != actions[i] || r.Operator != "tester" || r.Command != "dialpad contacts test" {
+			t.Errorf("record %d is wrong: %+v", i, r)
+		}
+		if len(r.Diff) == 0 {
+			t.Errorf("record %d has no diff", i)
+		}
+	}
+	if records[0].Hash != ContentHash(changed) || records[1].Hash != ContentHash(bob) || records[2].Hash != "" {
+		t.Errorf("unexpected hashes: %q, %q, %q", records[0].Hash, records[1].Hash, records[2].Hash)
+	}
+	if len(records[0].Diff) != 1 {
+		t.Errorf("expected only the last name to change, got %v", records[0].Diff)
+	}
+	// the deletion is diffed against the updated contact, not the baseline
+	for _, line := range records[2].Diff {
+		if line == "LastName: Smith != " {
+			return
+		}
+	}
+	t.Errorf("expected the deletion to remove the new last name, got %v", records[2].Diff)
+}
+
+func TestAuditRecord(t *testing.T) {
+	entry := storage.StreamEntry{
+		Id: "1700000000123-0",
+		Fields: map[string]string{
+			"uid":         "1",
+			"id":          "shared_contact_a_uid_1",
+			"action":      "update",
+			"diff":        `["LastName:  != Smith"]`,
+			"hash":        "abc",
+			"operator":    "tester",
+			"environment": "development",
+			"command":     "dialpad contacts sync",
+		},
+	}
+	r, err := auditRecord(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Time.Equal(time.UnixMilli(1700000000123)) || r.Uid != "1" || len(r.Diff) != 1 || r.Environment != "development" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	entry.Fields["diff"] = "not json"
+	if _, err := auditRecord(entry); err == nil {
+		t.Errorf("expected an unreadable diff to fail")
+	}
+}
+
+func TestAuditDiff(t *testing.T) {
+	before := Entry{Uid: "1", FirstName: "Ann", Emails: []string{}}
+	after := Entry{Uid: "1", FirstName: "Ann", LastName: "Smith"}
+	for i := 0; i < 12; i++ {
+		after.Phones = append(after.Phones, fmt.Sprintf("+1510555%04d", i))
+	}
+	diff := auditDiff(before, after)
+	if len(diff) != 13 {
+		t.Fatalf("expected 13 differences, got %d: %v", len(diff), diff)
+	}
+	if diff[0] != "LastName:  != Smith" || diff[12] != "Phones.slice[11]: <no value> != +15105550011" {
+		t.Errorf("unexpected differences: %v", diff)
+	}
+	if diff := auditDiff(after, after); diff != nil {
+		t.Errorf("expected no differences, got %v", diff)
+	}
+}
+
+func TestAuditLogHistory(t *testing.T) {
+	ctx := context.Background()
+	log := AuditLog("test-" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	defer func() {
+		_ = storage.DeleteStorage(ctx, log)
+		_ = storage.DeleteStorage(ctx, log.index("1"))
+		_ = storage.DeleteStorage(ctx, log.index("2"))
+	}()
+	for _, r := range []AuditRecord{
+		{Uid: "1", Action: "create", Diff: []string{"FirstName:  != Ann"}},
+		{Uid: "2", Action: "create", Diff: []string{"FirstName:  != Bob"}},
+		{Uid: "1", Action: "delete", Diff: []string{"FirstName: Ann != "}},
+	} {
+		if err := log.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := log.History("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Action != "create" || records[1].Action != "delete" || records[1].Uid != "1" {
+		t.Errorf("unexpected history: %+v", records)
+	}
+	if records, err = log.History("3"); err != nil || len(records) != 0 {
+		t.Errorf("expected no history, got %v, %v", records, err)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// BulkAction is the kind of write done to each contact by [BulkWrite].
+type BulkAction string
+
+const (
+	BulkUpdate BulkAction = "update"
+	BulkDelete BulkAction = "delete"
+)
+
+// BulkWorkers is the number of concurrent requests made by [BulkWrite].
+//
+// The Dialpad clients' rate limiters are what keep the requests within
+// Dialpad's limits; the workers just keep enough requests in flight
+// that the limiters are never left waiting on a slow response.
+var BulkWorkers = 8
+
+// A BulkResult is the outcome of writing one contact.
+//
+// Status is the HTTP status of the last response, or zero if there was none
+// (because of a transport error, or because the run was cancelled before
+// the contact was written).
+type BulkResult struct {
+	Entry  Entry
+	Action BulkAction
+	Status int
+	Err    error
+}
+
+// BulkWrite updates or deletes the given contacts, concurrently, and returns
+// the result for each in the same order as the entries.
+//
+// If the context is cancelled, requests in flight are abandoned and the
+// remaining contacts are not written; their results carry the context's error.
+func BulkWrite(ctx context.Context, action BulkAction, entries []Entry) []BulkResult {
+	if len(entries) == 0 {
+		return nil
+	}
+	results := make([]BulkResult, len(entries))
+	bar := progressbar.Default(int64(len(entries)), bulkDescription(action))
+	defer bar.Close()
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for range min(BulkWorkers, len(entries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = bulkWriteOne(ctx, action, entries[i])
+				_ = bar.Add(1)
+			}
+		}()
+	}
+dispatch:
+	for i := range entries {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indices)
+	wg.Wait()
+	for i, result := range results {
+		if result.Action == "" {
+			results[i] = BulkResult{Entry: entries[i], Action: action, Err: ctx.Err()}
+		}
+	}
+	return results
+}
+
+func bulkDescription(action BulkAction) string {
+	if action == BulkDelete {
+		return "Deleting contacts"
+	}
+	return "Updating contacts"
+}
+
+func bulkWriteOne(ctx context.Context, action BulkAction, entry Entry) BulkResult {
+	var err error
+	switch action {
+	case BulkUpdate:
+		_, err = UpdateContactContext(ctx, entry)
+	case BulkDelete:
+		err = DeleteContactContext(ctx, entry)
+	}
+	return BulkResult{Entry: entry, Action: action, Status: StatusOf(err), Err: err}
+}
+
+// StatusOf returns the HTTP status implied by the error from a Dialpad request:
+// 200 if there was no error, the response status of a [RequestError],
+// and zero otherwise.
+func StatusOf(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var re *RequestError
+	if errors.As(err, &re) {
+		return re.StatusCode
+	}
+	return 0
+}
+
+// BulkErrors returns the errors of the failed results.
+func BulkErrors(results []BulkResult) (errs []error) {
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return
+}
+
+// BulkFailures returns the failed results.
+func BulkFailures(results []BulkResult) (failures []BulkResult) {
+	for _, result := range results {
+		if result.Err != nil {
+			failures = append(failures, result)
+		}
+	}
+	return
+}
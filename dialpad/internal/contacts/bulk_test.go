@@ -0,0 +1,98 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestBulkWrite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entry Entry
+		_ = json.NewDecoder(r.Body).Decode(&entry)
+		if entry.Uid == "2" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("bad contact"))
+			return
+		}
+		entry.FullId = "shared_contact_a_uid_" + entry.Uid
+		_ = json.NewEncoder(w).Encode(entry)
+	}))
+	defer server.Close()
+	savedRoot, savedClient := DialpadApiRoot, DialPadUpdateClient
+	DialpadApiRoot, DialPadUpdateClient = server.URL, testClient()
+	defer func() { DialpadApiRoot, DialPadUpdateClient = savedRoot, savedClient }()
+
+	entries := []Entry{{Uid: "1", FirstName: "Ann"}, {Uid: "2", FirstName: "Bob"}, {Uid: "3", FirstName: "Cal"}}
+	results := BulkWrite(context.Background(), BulkUpdate, entries)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Entry.Uid != entries[i].Uid || result.Action != BulkUpdate {
+			t.Errorf("result %d is out of order: %v", i, result)
+		}
+	}
+	if results[0].Status != 200 || results[0].Err != nil || results[2].Status != 200 {
+		t.Errorf("expected successes, got %v and %v", results[0], results[2])
+	}
+	if results[1].Status != 400 || results[1].Err == nil {
+		t.Errorf("expected a 400 failure, got %v", results[1])
+	}
+	if failures := BulkFailures(results); len(failures) != 1 || failures[0].Entry.Uid != "2" {
+		t.Errorf("unexpected failures: %v", failures)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range BulkWrite(ctx, BulkUpdate, entries) {
+		if !errors.Is(result.Err, context.Canceled) || result.Status != 0 {
+			t.Errorf("expected a cancelled result, got %v", result)
+		}
+	}
+}
+
+func TestExportImportBulkResults(t *testing.T) {
+	results := []BulkResult{
+		{Entry: Entry{Uid: "1", FirstName: "Ann", Phones: []string{"+15105551234"}}, Action: BulkUpdate, Status: 200},
+		{Entry: Entry{FullId: "a_uid_2", Uid: "2", LastName: "Jones"}, Action: BulkDelete, Status: 429, Err: errors.New("rate-limited error")},
+		{Entry: Entry{Uid: "3", FirstName: "Cal"}, Action: BulkUpdate, Err: context.Canceled},
+	}
+	path := filepath.Join(t.TempDir(), "bulk.results.csv")
+	if err := ExportBulkResults(results, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ImportBulkResults(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(results) {
+		t.Fatalf("expected %d results, got %d", len(results), len(loaded))
+	}
+	for i, result := range loaded {
+		if diff := deep.Equal(result.Entry, results[i].Entry); diff != nil {
+			t.Errorf("result %d entry: %v", i, diff)
+		}
+		if result.Action != results[i].Action || result.Status != results[i].Status {
+			t.Errorf("result %d: expected %v, got %v", i, results[i], result)
+		}
+		if (result.Err == nil) != (results[i].Err == nil) {
+			t.Errorf("result %d: expected error %v, got %v", i, results[i].Err, result.Err)
+		} else if result.Err != nil && !strings.Contains(result.Err.Error(), results[i].Err.Error()) {
+			t.Errorf("result %d: expected error %v, got %v", i, results[i].Err, result.Err)
+		}
+	}
+}
@@ -10,14 +10,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 
-	"golang.org/x/time/rate"
-
-	"github.com/schollz/progressbar/v3"
-
 	"github.com/clickonetwo/automations/dialpad/internal/storage"
 )
 
@@ -26,6 +23,8 @@ var (
 	DialPadListClient   = NewRLHTTPClient(12, 65)
 	DialPadUpdateClient = NewRLHTTPClient(100, 60)
 	DialPadDeleteClient = NewRLHTTPClient(20, 1)
+	DialPadGetClient    = NewRLHTTPClient(100, 60)
+	NotFound            = errors.New("not found")
 )
 
 type entryPage struct {
@@ -33,150 +32,119 @@ type entryPage struct {
 	Items  []Entry `json:"items"`
 }
 
+// ListContacts downloads the contacts in the given account, or the company
+// contacts if the account is empty.
+//
+// A page that can't be fetched (even after retries) stops the download, since
+// the next page can't be found without it, so the results are incomplete
+// whenever errs is non-nil.
 func ListContacts(accountId string) (results []Entry, errs []error) {
-	key := storage.GetConfig().DialpadApiKey
-	baseUrl := fmt.Sprintf("%s/contacts?limit=100&apikey=%s", DialpadApiRoot, key)
-	if accountId != "" {
-		baseUrl = fmt.Sprintf("%s&accountId=%s", baseUrl, accountId)
-	}
-	cursor := ""
-	bar := progressbar.Default(-1, "Downloading contacts")
-	defer bar.Close()
-	for {
-		if len(errs) > 5 {
-			panic(fmt.Errorf("too many errors fetching contacts: %v", errs))
-		}
-		url := baseUrl
-		if cursor != "" {
-			url = fmt.Sprintf("%s&cursor=%s", url, cursor)
-		}
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			panic(err)
-		}
-		req.Header.Add("accept", "application/json")
-		resp, err := DialPadListClient.Do(req)
-		if err != nil {
-			panic(err)
-		}
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if resp.StatusCode != 200 {
-			err := fmt.Errorf("status code: %d, body: %s", resp.StatusCode, body)
-			//if strings.Contains(string(body), "\"limit\"") {
-			//	time.Sleep(time.Second * 10)
-			//}
-			errs = append(errs, err)
-			continue
-		}
-		var result entryPage
-		err = json.Unmarshal(body, &result)
-		if err != nil {
-			panic(err)
-		}
-		if len(result.Items) == 0 {
-			break
-		}
-		_ = bar.Add(len(result.Items))
-		for _, entry := range result.Items {
-			if entry.FullId == "" {
-				err := fmt.Errorf("no contact ID: %v", entry)
-				errs = append(errs, err)
-				continue
-			}
-			entry.Uid, _ = ExtractUid(entry.FullId)
-			results = append(results, entry)
-		}
-		cursor = result.Cursor
-		if cursor == "" {
-			break
-		}
-	}
-	return
+	return ListContactsContext(context.Background(), accountId, nil)
 }
 
+// UpdateContacts creates or updates the given contacts, concurrently.
 func UpdateContacts(entries []Entry) (errs []error) {
+	return BulkErrors(BulkWrite(context.Background(), BulkUpdate, entries))
+}
+
+// UpdateContact creates or updates the Dialpad contact with the entry's UID.
+//
+// It returns the contact as stored by Dialpad.  If auditing is on
+// (see [StartAudit]), the change is recorded in the audit log.
+func UpdateContact(entry Entry) (Entry, error) {
+	return UpdateContactContext(context.Background(), entry)
+}
+
+// UpdateContactContext is [UpdateContact] with a context for cancellation.
+func UpdateContactContext(ctx context.Context, entry Entry) (Entry, error) {
 	key := storage.GetConfig().DialpadApiKey
 	url := fmt.Sprintf("%s/contacts?apikey=%s", DialpadApiRoot, key)
-	bar := progressbar.Default(int64(len(entries)))
-	defer bar.Close()
-	for _, entry := range entries {
-		body, err := json.Marshal(entry)
-		if err != nil {
-			panic(err)
-		}
-		req, _ := http.NewRequest("PUT", url, bytes.NewReader(body))
-		req.Header.Add("accept", "application/json")
-		req.Header.Add("content-type", "application/json")
-		resp, err := DialPadUpdateClient.Do(req)
-		if err != nil {
-			panic(err)
-		}
-		body, _ = io.ReadAll(resp.Body)
-		resp.Body.Close()
-		_ = bar.Add(1)
-		if resp.StatusCode != 200 {
-			err := fmt.Errorf("contact: %v, status code: %d, body: %s", entry, resp.StatusCode, body)
-			errs = append(errs, err)
-		}
+	body, err := json.Marshal(entry.asRequest())
+	if err != nil {
+		return Entry{}, fmt.Errorf("contact: %v, can't be encoded: %w", entry, err)
+	}
+	req, _ := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(body))
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", "application/json")
+	resp, err := DialPadUpdateClient.Do(req)
+	if err != nil {
+		return Entry{}, fmt.Errorf("contact: %v, %w", entry, err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return Entry{}, fmt.Errorf("contact: %v, %w", entry, statusError(resp, body))
 	}
-	return
+	var result Entry
+	if err = json.Unmarshal(body, &result); err != nil {
+		return Entry{}, fmt.Errorf("contact: %v, %w", entry, &RequestError{Class: ResponseError, Err: err})
+	}
+	if result.FullId != "" {
+		result.Uid, _ = ExtractUid(result.FullId)
+	}
+	auditUpdate(result)
+	return result, nil
 }
 
-func DeleteContacts(entries []Entry) (errs []error) {
+// GetContact fetches the Dialpad contact with the given full ID.
+//
+// If there is no such contact, the returned error is [NotFound].
+func GetContact(fullId string) (Entry, error) {
 	key := storage.GetConfig().DialpadApiKey
-	bar := progressbar.Default(int64(len(entries)))
-	defer bar.Close()
-	for _, entry := range entries {
-		if entry.FullId == "" {
-			err := fmt.Errorf("no full ID for contact: %v", entry)
-			errs = append(errs, err)
-			continue
-		}
-		url := fmt.Sprintf("%s/contacts/%s?apikey=%s", DialpadApiRoot, entry.FullId, key)
-		req, _ := http.NewRequest("DELETE", url, nil)
-		req.Header.Add("accept", "application/json")
-		resp, err := DialPadDeleteClient.Do(req)
-		if err != nil {
-			panic(err)
-		}
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		_ = bar.Add(1)
-		if resp.StatusCode != 200 {
-			err := fmt.Errorf("contact id: %v, status code: %d, body: %s", entry.Uid, resp.StatusCode, body)
-			errs = append(errs, err)
-		}
+	url := fmt.Sprintf("%s/contacts/%s?apikey=%s", DialpadApiRoot, fullId, key)
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Add("accept", "application/json")
+	resp, err := DialPadGetClient.Do(req)
+	if err != nil {
+		return Entry{}, fmt.Errorf("contact id: %v, %w", fullId, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return Entry{}, NotFound
+	}
+	if resp.StatusCode != 200 {
+		return Entry{}, fmt.Errorf("contact id: %v, %w", fullId, statusError(resp, body))
+	}
+	var result Entry
+	if err = json.Unmarshal(body, &result); err != nil {
+		return Entry{}, fmt.Errorf("contact id: %v, %w", fullId, &RequestError{Class: ResponseError, Err: err})
 	}
-	return
+	if result.FullId != "" {
+		result.Uid, _ = ExtractUid(result.FullId)
+	}
+	return result, nil
 }
 
-// RLHTTPClient is rate-limited HTTP Client
-//
-// code taken from [this blogpost](https://medium.com/mflow/rate-limiting-in-golang-http-client-a22fba15861a)
-type RLHTTPClient struct {
-	client  *http.Client
-	limiter *rate.Limiter
+// DeleteContacts deletes the given contacts, concurrently.
+func DeleteContacts(entries []Entry) (errs []error) {
+	return BulkErrors(BulkWrite(context.Background(), BulkDelete, entries))
 }
 
-func NewRLHTTPClient(calls, seconds int) *RLHTTPClient {
-	limit := rate.Limit(calls) / rate.Limit(seconds)
-	return &RLHTTPClient{
-		client:  http.DefaultClient,
-		limiter: rate.NewLimiter(limit, 1),
-	}
+// DeleteContact deletes the Dialpad contact with the entry's full ID.
+// If auditing is on (see [StartAudit]), the deletion is recorded in the audit log.
+func DeleteContact(entry Entry) error {
+	return DeleteContactContext(context.Background(), entry)
 }
 
-// Do dispatches the HTTP request to the network
-func (c *RLHTTPClient) Do(req *http.Request) (*http.Response, error) {
-	ctx := context.Background()
-	err := c.limiter.Wait(ctx) // This is a blocking call. Honors the rate limit
-	if err != nil {
-		return nil, err
+// DeleteContactContext is [DeleteContact] with a context for cancellation.
+func DeleteContactContext(ctx context.Context, entry Entry) error {
+	key := storage.GetConfig().DialpadApiKey
+	if entry.FullId == "" {
+		return fmt.Errorf("no full ID for contact: %v", entry)
 	}
-	resp, err := c.client.Do(req)
+	url := fmt.Sprintf("%s/contacts/%s?apikey=%s", DialpadApiRoot, entry.FullId, key)
+	req, _ := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	req.Header.Add("accept", "application/json")
+	resp, err := DialPadDeleteClient.Do(req)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("contact id: %v, %w", entry.Uid, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("contact id: %v, %w", entry.Uid, statusError(resp, body))
 	}
-	return resp, nil
+	auditDelete(entry)
+	return nil
 }
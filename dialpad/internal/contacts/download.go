@@ -0,0 +1,230 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/schollz/progressbar/v3"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// A DownloadCache is a local directory holding the progress of a contact download.
+//
+// Each downloaded page is saved, encrypted, in its own file, and a checkpoint
+// file records how many pages have been saved and the cursor of the next page.
+// An interrupted download can then be resumed where it stopped.
+type DownloadCache struct {
+	Dir string
+}
+
+// A downloadCheckpoint is the state of a download after its last saved page.
+type downloadCheckpoint struct {
+	AccountId string
+	Cursor    string
+	Pages     int
+}
+
+// NewDownloadCache returns the download cache for the given account
+// (or the company contacts, if the account is empty), which is kept
+// in the user's cache directory.
+func NewDownloadCache(accountId string) (*DownloadCache, error) {
+	root, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	name := "company"
+	if accountId != "" {
+		name = "account-" + accountId
+	}
+	return &DownloadCache{Dir: filepath.Join(root, "clickonetwo-dialpad", "contact-downloads", name)}, nil
+}
+
+func (c *DownloadCache) checkpointPath() string {
+	return filepath.Join(c.Dir, "checkpoint.gob.age")
+}
+
+func (c *DownloadCache) pagePath(page int) string {
+	return filepath.Join(c.Dir, fmt.Sprintf("page-%05d.gob.age", page))
+}
+
+// load returns the checkpoint and entries saved in the cache.
+// If nothing has been saved, the checkpoint is empty.
+func (c *DownloadCache) load(accountId string) (checkpoint downloadCheckpoint, entries []Entry, err error) {
+	err = storage.LoadEncryptedGob(c.checkpointPath(), &checkpoint)
+	if errors.Is(err, fs.ErrNotExist) {
+		return downloadCheckpoint{AccountId: accountId}, nil, nil
+	} else if err != nil {
+		return checkpoint, nil, fmt.Errorf("download checkpoint not readable: %w", err)
+	}
+	if checkpoint.AccountId != accountId {
+		return checkpoint, nil, fmt.Errorf("download cache is for account %q, not %q", checkpoint.AccountId, accountId)
+	}
+	for page := 1; page <= checkpoint.Pages; page++ {
+		var items []Entry
+		if err = storage.LoadEncryptedGob(c.pagePath(page), &items); err != nil {
+			return checkpoint, nil, fmt.Errorf("downloaded page %d not readable: %w", page, err)
+		}
+		entries = append(entries, items...)
+	}
+	return checkpoint, entries, nil
+}
+
+// save adds a page to the cache, and then moves the checkpoint past it.
+func (c *DownloadCache) save(checkpoint downloadCheckpoint, items []Entry) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	if err := storage.SaveEncryptedGob(c.pagePath(checkpoint.Pages), items); err != nil {
+		return err
+	}
+	// write the checkpoint under a temporary name, so it's never seen half-written
+	temp := c.checkpointPath() + ".tmp"
+	if err := storage.SaveEncryptedGob(temp, checkpoint); err != nil {
+		return err
+	}
+	return os.Rename(temp, c.checkpointPath())
+}
+
+// HasCheckpoint reports whether a checkpoint has been saved in the cache,
+// so that a download using it will resume rather than start over.
+func (c *DownloadCache) HasCheckpoint() bool {
+	_, err := os.Stat(c.checkpointPath())
+	return err == nil
+}
+
+// Clear removes everything from the cache.
+func (c *DownloadCache) Clear() error {
+	return os.RemoveAll(c.Dir)
+}
+
+// A DownloadStoppedError is the error that stopped a download before its
+// last page, so the results of the download are incomplete.
+type DownloadStoppedError struct {
+	Page int
+	Err  error
+}
+
+func (e *DownloadStoppedError) Error() string {
+	if e.Page == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("contacts page %d: %v", e.Page, e.Err)
+}
+
+func (e *DownloadStoppedError) Unwrap() error {
+	return e.Err
+}
+
+// DownloadStopped reports whether any of the errors from a download
+// stopped it before its last page.  Other errors, such as a contact
+// without an ID, leave the download complete.
+func DownloadStopped(errs []error) bool {
+	for _, err := range errs {
+		var se *DownloadStoppedError
+		if errors.As(err, &se) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListContactsContext is [ListContacts] with a context for cancellation
+// and an optional cache for checkpointing.
+//
+// If there is a cache, each page is saved to it as it's downloaded, and
+// the download starts after the last page saved in it, so an interrupted
+// download is resumed.  When the download completes, the cache is cleared.
+// (To start over, clear the cache before calling this.)
+func ListContactsContext(ctx context.Context, accountId string, cache *DownloadCache) (results []Entry, errs []error) {
+	var checkpoint downloadCheckpoint
+	if cache != nil {
+		var err error
+		if checkpoint, results, err = cache.load(accountId); err != nil {
+			return nil, []error{&DownloadStoppedError{Err: err}}
+		}
+	}
+	key := storage.GetConfig().DialpadApiKey
+	baseUrl := fmt.Sprintf("%s/contacts?limit=100&apikey=%s", DialpadApiRoot, key)
+	if accountId != "" {
+		baseUrl = fmt.Sprintf("%s&accountId=%s", baseUrl, accountId)
+	}
+	bar := progressbar.Default(-1, "Downloading contacts")
+	defer bar.Close()
+	_ = bar.Add(len(results))
+	if checkpoint.Pages > 0 && checkpoint.Cursor == "" {
+		// the cached download was complete, but wasn't cleared
+		return results, nil
+	}
+	for {
+		page := checkpoint.Pages + 1
+		url := baseUrl
+		if checkpoint.Cursor != "" {
+			url = fmt.Sprintf("%s&cursor=%s", url, checkpoint.Cursor)
+		}
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		req.Header.Add("accept", "application/json")
+		resp, err := DialPadListClient.Do(req)
+		if err != nil {
+			errs = append(errs, &DownloadStoppedError{Page: page, Err: err})
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			errs = append(errs, &DownloadStoppedError{Page: page, Err: statusError(resp, body)})
+			return
+		}
+		var result entryPage
+		if err = json.Unmarshal(body, &result); err != nil {
+			err = &RequestError{Class: ResponseError, Err: err}
+			errs = append(errs, &DownloadStoppedError{Page: page, Err: err})
+			return
+		}
+		_ = bar.Add(len(result.Items))
+		var items []Entry
+		for _, entry := range result.Items {
+			if entry.FullId == "" {
+				err := fmt.Errorf("no contact ID: %v", entry)
+				errs = append(errs, err)
+				continue
+			}
+			entry.Uid, _ = ExtractUid(entry.FullId)
+			items = append(items, entry)
+		}
+		results = append(results, items...)
+		checkpoint.Pages, checkpoint.Cursor = page, result.Cursor
+		if len(result.Items) == 0 {
+			checkpoint.Cursor = ""
+		}
+		if cache != nil {
+			if err := cache.save(checkpoint, items); err != nil {
+				err = fmt.Errorf("can't checkpoint: %w", err)
+				errs = append(errs, &DownloadStoppedError{Page: page, Err: err})
+				return
+			}
+		}
+		if checkpoint.Cursor == "" {
+			break
+		}
+	}
+	if cache != nil {
+		if err := cache.Clear(); err != nil {
+			errs = append(errs, fmt.Errorf("can't clear download cache: %w", err))
+		}
+	}
+	return
+}
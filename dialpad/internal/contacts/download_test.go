@@ -0,0 +1,99 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+func TestListContactsResume(t *testing.T) {
+	if err := storage.PushConfig("ci"); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.PopConfig()
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("cursor")
+		if cursor == "2" && failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var page entryPage
+		switch cursor {
+		case "":
+			page = entryPage{Cursor: "2", Items: []Entry{{FullId: "shared_contact_a_uid_1"}, {FullId: "shared_contact_a_uid_2"}}}
+		case "2":
+			page = entryPage{Cursor: "3", Items: []Entry{{FullId: "shared_contact_a_uid_3"}}}
+		case "3":
+			page = entryPage{Items: []Entry{{FullId: "shared_contact_a_uid_4"}}}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+	savedRoot, savedClient := DialpadApiRoot, DialPadListClient
+	DialpadApiRoot, DialPadListClient = server.URL, testClient()
+	defer func() { DialpadApiRoot, DialPadListClient = savedRoot, savedClient }()
+
+	cache := &DownloadCache{Dir: t.TempDir()}
+	entries, errs := ListContactsContext(context.Background(), "", cache)
+	if len(errs) != 1 || len(entries) != 2 {
+		t.Fatalf("expected 2 entries and 1 error, got %d and %v", len(entries), errs)
+	}
+	if !DownloadStopped(errs) || !cache.HasCheckpoint() {
+		t.Errorf("expected a stopped download with a checkpoint, got %v", errs)
+	}
+	if _, err := ListContactsContext(context.Background(), "other", cache); err == nil {
+		t.Errorf("expected an error resuming a different account")
+	}
+	failing = false
+	entries, errs = ListContactsContext(context.Background(), "", cache)
+	if errs != nil {
+		t.Fatalf("unexpected errors on resume: %v", errs)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries after resume, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.Uid != fmt.Sprint(i+1) {
+			t.Errorf("entry %d has uid %q", i, e.Uid)
+		}
+	}
+	if cache.HasCheckpoint() {
+		t.Errorf("expected no checkpoint after a completed download")
+	}
+	if _, err := os.Stat(cache.Dir); !os.IsNotExist(err) {
+		t.Errorf("expected the cache to be cleared, got %v", err)
+	}
+}
+
+func TestListContactsCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request after cancellation")
+	}))
+	defer server.Close()
+	savedRoot, savedClient := DialpadApiRoot, DialPadListClient
+	DialpadApiRoot, DialPadListClient = server.URL, testClient()
+	defer func() { DialpadApiRoot, DialPadListClient = savedRoot, savedClient }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	entries, errs := ListContactsContext(ctx, "", nil)
+	if len(entries) != 0 || len(errs) != 1 {
+		t.Errorf("expected a single error, got %v and %v", entries, errs)
+	}
+	if !DownloadStopped(errs) {
+		t.Errorf("expected a cancelled download to be stopped: %v", errs)
+	}
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/clickonetwo/automations/phonenum"
+)
+
+// The scores contributed by each kind of evidence that two entries are duplicates.
+// The score of a pair of entries is the sum of the scores of its evidence, capped at 100.
+var (
+	SharedPhoneScore = 50
+	SharedEmailScore = 40
+	SameNameScore    = 30
+	SimilarNameScore = 20
+)
+
+// A DuplicateGroup is a cluster of entries that are probably the same contact.
+//
+// The Score of a group is the score of the weakest link that joins its members,
+// so a group is only as believable as its least believable pair.  The Survivor
+// is the proposed merged record: it's the member with the most information
+// (ties broken by age), given the union of all the members' phones and emails.
+type DuplicateGroup struct {
+	Score    int
+	Members  []Entry
+	Survivor Entry
+}
+
+type duplicatePair struct {
+	left, right int
+	score       int
+}
+
+// FindDuplicates clusters the given entries into groups of probable duplicates.
+//
+// Two entries are candidates if they share any phone or email, or if their names
+// are near-identical: the same after ignoring case, accents, and the order of
+// first and last names, or within a small edit distance of each other.
+// Only pairs scoring at least minScore join entries into a group.
+// Groups are returned strongest first.
+func FindDuplicates(entries []Entry, minScore int) []DuplicateGroup {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = sortedNameKey(e)
+	}
+	candidates := make(map[[2]int]bool)
+	addCandidates := func(indexes []int) {
+		for i := 0; i < len(indexes); i++ {
+			for j := i + 1; j < len(indexes); j++ {
+				candidates[[2]int{indexes[i], indexes[j]}] = true
+			}
+		}
+	}
+	byPhone := make(map[string][]int)
+	byEmail := make(map[string][]int)
+	byVariant := make(map[string][]int)
+	for i, e := range entries {
+		for _, phone := range e.Phones {
+			if phone != "" {
+				byPhone[phone] = appendOnce(byPhone[phone], i)
+			}
+		}
+		for _, email := range e.Emails {
+			if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+				byEmail[email] = appendOnce(byEmail[email], i)
+			}
+		}
+		if names[i] != "" {
+			for _, v := range deletionVariants(names[i], nameDistanceLimit(names[i])) {
+				byVariant[v] = append(byVariant[v], i)
+			}
+		}
+	}
+	for _, indexes := range byPhone {
+		addCandidates(indexes)
+	}
+	for _, indexes := range byEmail {
+		addCandidates(indexes)
+	}
+	// names within edit distance k share a variant with at most k deletions
+	for _, indexes := range byVariant {
+		for i := 0; i < len(indexes); i++ {
+			for j := i + 1; j < len(indexes); j++ {
+				c := [2]int{indexes[i], indexes[j]}
+				if !candidates[c] && nameScore(names[c[0]], names[c[1]]) > 0 {
+					candidates[c] = true
+				}
+			}
+		}
+	}
+	var pairs []duplicatePair
+	for c := range candidates {
+		score := pairScore(entries[c[0]], entries[c[1]], names[c[0]], names[c[1]])
+		if score >= minScore {
+			pairs = append(pairs, duplicatePair{c[0], c[1], score})
+		}
+	}
+	// join the strongest pairs first, so each group's score is its weakest necessary link
+	slices.SortFunc(pairs, func(a, b duplicatePair) int {
+		if c := cmp.Compare(b.score, a.score); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.left, b.left); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.right, b.right)
+	})
+	parent := make([]int, len(entries))
+	score := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+		score[i] = 100
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for _, p := range pairs {
+		l, r := find(p.left), find(p.right)
+		if l == r {
+			continue
+		}
+		parent[r] = l
+		score[l] = min(score[l], score[r], p.score)
+	}
+	members := make(map[int][]Entry)
+	for i, e := range entries {
+		root := find(i)
+		members[root] = append(members[root], e)
+	}
+	var groups []DuplicateGroup
+	for root, es := range members {
+		if len(es) < 2 {
+			continue
+		}
+		groups = append(groups, DuplicateGroup{Score: score[root], Members: es, Survivor: proposeSurvivor(es)})
+	}
+	slices.SortFunc(groups, func(a, b DuplicateGroup) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Survivor.FullId, b.Survivor.FullId)
+	})
+	return groups
+}
+
+func pairScore(l, r Entry, ln, rn string) int {
+	score := 0
+	for _, phone := range l.Phones {
+		if phone != "" && slices.Contains(r.Phones, phone) {
+			score += SharedPhoneScore
+			break
+		}
+	}
+	for _, email := range l.Emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" && slices.ContainsFunc(r.Emails, func(s string) bool {
+			return strings.ToLower(strings.TrimSpace(s)) == email
+		}) {
+			score += SharedEmailScore
+			break
+		}
+	}
+	score += nameScore(ln, rn)
+	return min(score, 100)
+}
+
+// nameScore compares two sorted name keys and returns the score for their similarity.
+func nameScore(l, r string) int {
+	if l == "" || r == "" {
+		return 0
+	}
+	if l == r {
+		return SameNameScore
+	}
+	limit := min(nameDistanceLimit(l), nameDistanceLimit(r))
+	if EditDistance(l, r) <= limit {
+		return SimilarNameScore
+	}
+	return 0
+}
+
+// nameDistanceLimit is the edit distance within which names are considered similar.
+func nameDistanceLimit(name string) int {
+	if len([]rune(name)) > 8 {
+		return 2
+	}
+	return 1
+}
+
+// deletionVariants returns the distinct strings made by deleting
+// up to k runes from s, including s itself.
+func deletionVariants(s string, k int) []string {
+	seen := map[string]bool{s: true}
+	level := []string{s}
+	for ; k > 0; k-- {
+		var next []string
+		for _, v := range level {
+			r := []rune(v)
+			for i := range r {
+				d := string(r[:i]) + string(r[i+1:])
+				if !seen[d] {
+					seen[d] = true
+					next = append(next, d)
+				}
+			}
+		}
+		level = next
+	}
+	variants := make([]string, 0, len(seen))
+	for v := range seen {
+		variants = append(variants, v)
+	}
+	return variants
+}
+
+// sortedNameKey returns the normalized name of the entry with its words
+// in sorted order, so swapped first and last names give the same key.
+//
+// Entries whose first and last names are the same (because only one
+// was provided) are keyed by just that one name.
+func sortedNameKey(e Entry) string {
+	first, last := NormalizeName(e.FirstName), NormalizeName(e.LastName)
+	if first == last {
+		return first
+	}
+	words := strings.Fields(first + " " + last)
+	slices.Sort(words)
+	return strings.Join(words, " ")
+}
+
+// EditDistance returns the Levenshtein distance between two strings, counted in runes.
+func EditDistance(s, t string) int {
+	a, b := []rune(s), []rune(t)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// proposeSurvivor picks the group member with the most phones and emails
+// (the oldest if there's a tie) and gives it all the group's phones and emails.
+func proposeSurvivor(members []Entry) Entry {
+	best := members[0]
+	for _, m := range members[1:] {
+		mc, bc := infoCount(m), infoCount(best)
+		if mc > bc || (mc == bc && uidLess(m, best)) {
+			best = m
+		}
+	}
+	return MergeInfo(best, members)
+}
+
+// MergeInfo returns the survivor with the union of its phones and emails
+// and those of the others, in order, without duplicates or blanks.  Any
+// other fields the survivor leaves blank are filled in from the others.
+func MergeInfo(survivor Entry, others []Entry) Entry {
+	phones, emails := slices.Clone(survivor.Phones), slices.Clone(survivor.Emails)
+	survivor.Phones, survivor.Emails = nil, nil
+	for _, phone := range append(phones, allPhones(others)...) {
+		if phone != "" && !slices.Contains(survivor.Phones, phone) {
+			survivor.Phones = append(survivor.Phones, phone)
+		}
+	}
+	for _, email := range append(emails, allEmails(others)...) {
+		if email != "" && !slices.ContainsFunc(survivor.Emails, func(s string) bool {
+			return strings.EqualFold(s, email)
+		}) {
+			survivor.Emails = append(survivor.Emails, email)
+		}
+	}
+	survivor.PhoneExtensions = maps.Clone(survivor.PhoneExtensions)
+	for _, other := range others {
+		for phone, ext := range other.PhoneExtensions {
+			if _, ok := survivor.PhoneExtensions[phone]; !ok {
+				survivor.AddPhone(phonenum.Number{E164: phone, Extension: ext})
+			}
+		}
+		// company, job title, and so on are taken from the first that has them
+		survivor = survivor.withDialpadFields(other, false)
+	}
+	return survivor
+}
+
+func infoCount(e Entry) int {
+	count := 0
+	for _, p := range e.Phones {
+		if p != "" {
+			count++
+		}
+	}
+	for _, e := range e.Emails {
+		if e != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// uidLess compares the (numeric) creation stamps of two entries.
+func uidLess(l, r Entry) bool {
+	if len(l.Uid) != len(r.Uid) {
+		return len(l.Uid) < len(r.Uid)
+	}
+	return l.Uid < r.Uid
+}
+
+func allPhones(entries []Entry) (phones []string) {
+	for _, e := range entries {
+		phones = append(phones, e.Phones...)
+	}
+	return
+}
+
+func allEmails(entries []Entry) (emails []string) {
+	for _, e := range entries {
+		emails = append(emails, e.Emails...)
+	}
+	return
+}
+
+func appendOnce(indexes []int, i int) []int {
+	if len(indexes) > 0 && indexes[len(indexes)-1] == i {
+		return indexes
+	}
+	return append(indexes, i)
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	entries := []Entry{
+		{FullId: "1", Uid: "100", FirstName: "Maria", LastName: "García", Phones: []string{"+15105551234"}},
+		{FullId: "2", Uid: "200", FirstName: "garcia", LastName: "maria", Phones: []string{"+15105559999"}, Emails: []string{"m@example.com"}},
+		{FullId: "3", Uid: "300", FirstName: "Marie", LastName: "Garcia", Emails: []string{"M@example.com"}},
+		{FullId: "4", Uid: "400", FirstName: "Someone", LastName: "Else", Phones: []string{"+15105550000"}},
+		{FullId: "5", Uid: "500", FirstName: "Another", LastName: "Person", Phones: []string{"+15105551234"}},
+	}
+	groups := FindDuplicates(entries, SimilarNameScore)
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d: %v", len(groups), groups)
+	}
+	if len(groups[0].Members) != 4 {
+		t.Errorf("expected 4 members, got %v", groups[0].Members)
+	}
+	if groups[0].Score != SameNameScore {
+		t.Errorf("expected score %d, got %d", SameNameScore, groups[0].Score)
+	}
+	survivor := groups[0].Survivor
+	if survivor.FullId != "2" {
+		t.Errorf("expected survivor 2, got %v", survivor)
+	}
+	if diff := deep.Equal(survivor.Phones, []string{"+15105559999", "+15105551234"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(survivor.Emails, []string{"m@example.com"}); diff != nil {
+		t.Error(diff)
+	}
+	if groups = FindDuplicates(entries, SharedEmailScore); len(groups) != 2 {
+		t.Errorf("expected 2 groups, got %d: %v", len(groups), groups)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		s, t     string
+		expected int
+	}{
+		{"", "", 0},
+		{"maria", "marie", 1},
+		{"garcia", "garcía", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, c := range cases {
+		if d := EditDistance(c.s, c.t); d != c.expected {
+			t.Errorf("EditDistance(%q, %q) = %d, expected %d", c.s, c.t, d, c.expected)
+		}
+	}
+}
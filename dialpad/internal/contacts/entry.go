@@ -10,29 +10,135 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode"
 
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/go-test/deep"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/clickonetwo/automations/phonenum"
 )
 
 var (
 	UnknownName = "{unknown}"
 )
 
+// An Entry is a Dialpad contact.
+//
+// PhoneExtensions maps phones to their extensions, if they have them.
+// Dialpad doesn't store per-phone extensions, so they are never sent to it.
+// (Extension is the contact's own Dialpad extension, which Dialpad does store.)
+//
+// Owner is the ID of the user or office whose contact list the entry is in;
+// company contacts have none.  Scope says which kind of list that is, when
+// contacts are listed across accounts (see [ListAccountContacts]).
+// Type is "shared" or "local".  Dialpad sets both Owner and Type, so
+// neither is ever sent.
+//
+// UidDerived says the UID was derived from the names and phones, because
+// the source doesn't provide one (see [MatchDerivedUids]).
+//
+// The display name, primary phone, and primary email that Dialpad returns
+// are derived from the other fields, so they aren't kept.
 type Entry struct {
-	FullId    string   `json:"id,omitempty"`
-	Uid       string   `json:"uid"`
-	FirstName string   `json:"first_name"`
-	LastName  string   `json:"last_name"`
-	Phones    []string `json:"phones"`
-	Emails    []string `json:"emails"`
+	FullId          string            `json:"id,omitempty"`
+	Uid             string            `json:"uid"`
+	FirstName       string            `json:"first_name"`
+	LastName        string            `json:"last_name"`
+	Phones          []string          `json:"phones"`
+	Emails          []string          `json:"emails"`
+	CompanyName     string            `json:"company_name,omitempty"`
+	JobTitle        string            `json:"job_title,omitempty"`
+	Urls            []string          `json:"urls,omitempty"`
+	Extension       string            `json:"extension,omitempty"`
+	Owner           string            `json:"owner_id,omitempty"`
+	Type            string            `json:"type,omitempty"`
+	PhoneExtensions map[string]string `json:"-"`
+	Scope           string            `json:"-"`
+	UidDerived      bool              `json:"-"`
+}
+
+// AddPhone adds a phone number to the entry, unless it's already there,
+// and records its extension (if it has one).
+func (e *Entry) AddPhone(n phonenum.Number) {
+	if !slices.Contains(e.Phones, n.E164) {
+		e.Phones = append(e.Phones, n.E164)
+	}
+	if n.Extension != "" {
+		if e.PhoneExtensions == nil {
+			e.PhoneExtensions = make(map[string]string)
+		}
+		e.PhoneExtensions[n.E164] = n.Extension
+	}
 }
 
+// PhoneNumber returns one of the entry's phones with its extension.
+func (e Entry) PhoneNumber(phone string) phonenum.Number {
+	return phonenum.Number{E164: phone, Extension: e.PhoneExtensions[phone]}
+}
+
+// asStored returns the entry as Dialpad would store it, without
+// the fields that are only kept locally.
+func (e Entry) asStored() Entry {
+	e.PhoneExtensions, e.Scope = nil, ""
+	return e
+}
+
+// asRequest returns the entry as it's sent to Dialpad, without the
+// fields that only Dialpad sets.
+func (e Entry) asRequest() Entry {
+	e.Owner, e.Type = "", ""
+	return e
+}
+
+// withDialpadFields returns the local entry with any of the fields that
+// not every source keeps (company, job title, URLs, extension, and type)
+// that it leaves blank filled in from the Dialpad entry, so they
+// aren't lost when the local entry is uploaded.  If clearBlank is true,
+// the company, job title, and URLs are left blank, so they are cleared.
+func (e Entry) withDialpadFields(dialpad Entry, clearBlank bool) Entry {
+	if !clearBlank {
+		if e.CompanyName == "" {
+			e.CompanyName = dialpad.CompanyName
+		}
+		if e.JobTitle == "" {
+			e.JobTitle = dialpad.JobTitle
+		}
+		if len(e.Urls) == 0 {
+			e.Urls = dialpad.Urls
+		}
+	}
+	if e.Extension == "" {
+		e.Extension = dialpad.Extension
+	}
+	if e.Type == "" {
+		e.Type = dialpad.Type
+	}
+	return e
+}
+
+// A SearchEntry is a phone the user has texted with, and the name of its contact.
+//
+// Entries from a [SearchIndex] remember their normalized name, so searches
+// don't have to normalize it again.
 type SearchEntry struct {
-	FullName string
-	Phone    string
+	FullName   string `json:"name"`
+	Phone      string `json:"phone"`
+	Extension  string `json:"extension,omitempty"`
+	normalized string
+}
+
+// normalizedName returns the [NormalizeName] form of the entry's name.
+func (e SearchEntry) normalizedName() string {
+	if e.normalized != "" {
+		return e.normalized
+	}
+	return NormalizeName(e.FullName)
 }
 
 func SearchEntryCompare(e1, e2 SearchEntry) int {
@@ -56,8 +162,9 @@ func SelectEntriesByPhones(phones []string, entries []Entry) []SearchEntry {
 			if all.Contains(phone) {
 				found.Add(phone)
 				se := SearchEntry{
-					FullName: entry.FirstName + " " + entry.LastName,
-					Phone:    phone,
+					FullName:  entry.FirstName + " " + entry.LastName,
+					Phone:     phone,
+					Extension: entry.PhoneExtensions[phone],
 				}
 				results = append(results, se)
 				break
@@ -76,7 +183,13 @@ func SelectEntriesByPhones(phones []string, entries []Entry) []SearchEntry {
 	return results
 }
 
-func DiffEntries(dialpad, local []Entry) (update []Entry, create []Entry) {
+// DiffEntries returns the local entries that must be uploaded to make Dialpad
+// match them: those that differ from the Dialpad entry with the same UID, and
+// those that have no Dialpad entry.  Fields that a local entry leaves blank
+// but its Dialpad entry has (see [Entry.withDialpadFields]) are kept, unless
+// clearBlank is true, in which case a blank company, job title, or URLs
+// clears them.  Fields that only Dialpad sets (see [Entry.asRequest]) aren't compared.
+func DiffEntries(dialpad, local []Entry, clearBlank bool) (update []Entry, create []Entry) {
 	oldMap := make(map[string]Entry, len(dialpad))
 	for _, o := range dialpad {
 		oldMap[o.Uid] = o
@@ -85,13 +198,84 @@ func DiffEntries(dialpad, local []Entry) (update []Entry, create []Entry) {
 		o, ok := oldMap[n.Uid]
 		if !ok {
 			create = append(create, n)
-		} else if diff := deep.Equal(o, n); diff != nil {
+		} else if n = n.withDialpadFields(o, clearBlank); deep.Equal(o.asStored().asRequest(), n.asStored().asRequest()) != nil {
 			update = append(update, n)
 		}
 	}
 	return
 }
 
+// MatchDerivedUids gives each local entry whose UID was derived from its
+// names and phones the UID of the Dialpad contact it matches, so editing a
+// name or phone in the source doesn't turn the contact into a new one.
+//
+// An entry matches the Dialpad contact with its UID, else the Dialpad contact
+// with one of its phones, else the only Dialpad contact with its name.  Each
+// Dialpad contact is matched at most once, and not at all if a local entry
+// with a source UID has its UID.  It returns the number of entries matched.
+func MatchDerivedUids(local, dialpad []Entry) (matched int) {
+	claimed := make(map[string]bool, len(local))
+	for _, e := range local {
+		if !e.UidDerived {
+			claimed[e.Uid] = true
+		}
+	}
+	nameKey := func(e Entry) string {
+		if e.FirstName == "" && e.LastName == "" {
+			return ""
+		}
+		return strings.ToLower(e.FirstName) + "\x00" + strings.ToLower(e.LastName)
+	}
+	uids := make(map[string]bool, len(dialpad))
+	byPhone := make(map[string]string)
+	byName := make(map[string]string)
+	for _, d := range dialpad {
+		if d.Uid == "" {
+			continue
+		}
+		uids[d.Uid] = true
+		for _, p := range d.Phones {
+			if _, ok := byPhone[p]; !ok {
+				byPhone[p] = d.Uid
+			}
+		}
+		if key := nameKey(d); key != "" {
+			if _, ok := byName[key]; ok {
+				byName[key] = ""
+			} else {
+				byName[key] = d.Uid
+			}
+		}
+	}
+	claim := func(i int, uid string) {
+		local[i].Uid, local[i].UidDerived = uid, false
+		claimed[uid] = true
+		matched++
+	}
+	for i, e := range local {
+		if e.UidDerived && uids[e.Uid] && !claimed[e.Uid] {
+			claim(i, e.Uid)
+		}
+	}
+	for i, e := range local {
+		if !e.UidDerived {
+			continue
+		}
+		candidates := make([]string, 0, len(e.Phones)+1)
+		for _, p := range e.Phones {
+			candidates = append(candidates, byPhone[p])
+		}
+		candidates = append(candidates, byName[nameKey(e)])
+		for _, uid := range candidates {
+			if uid != "" && !claimed[uid] {
+				claim(i, uid)
+				break
+			}
+		}
+	}
+	return
+}
+
 func CompareById(left, right []Entry) (both, leftOnly, rightOnly []Entry, anomalies []Anomaly) {
 	leftMap := make(map[string]Entry, len(left))
 	for _, e := range left {
@@ -146,6 +330,93 @@ func FindOffsetDuplicates(left, right []Entry, offset int64) (leftDupes, rightDu
 	return
 }
 
+// CompareByNameAndPhone matches contacts in two lists by their normalized
+// full name and primary phone, ignoring their UIDs.
+//
+// Each matched pair is returned as a row of left ID, right ID, primary phone,
+// first name, and last name (in the format of [ExportUIDs]).  Contacts that
+// don't match are returned as left-only or right-only, and each pair of
+// unmatched contacts that share a primary phone but not a name is returned as
+// a conflict row of left ID, right ID, primary phone, left name, and right name.
+func CompareByNameAndPhone(left, right []Entry) (both [][]string, leftOnly, rightOnly []Entry, conflicts [][]string) {
+	rightMap := make(map[string][]Entry, len(right))
+	for _, r := range right {
+		if primaryPhone(r) == "" {
+			rightOnly = append(rightOnly, r)
+			continue
+		}
+		key := nameAndPhoneKey(r)
+		rightMap[key] = append(rightMap[key], r)
+	}
+	for _, l := range left {
+		if primaryPhone(l) == "" {
+			leftOnly = append(leftOnly, l)
+			continue
+		}
+		key := nameAndPhoneKey(l)
+		if rs := rightMap[key]; len(rs) > 0 {
+			r := rs[0]
+			rightMap[key] = rs[1:]
+			both = append(both, []string{l.FullId, r.FullId, l.Phones[0], l.FirstName, l.LastName})
+		} else {
+			leftOnly = append(leftOnly, l)
+		}
+	}
+	// collect the unmatched right entries in their original order
+	for _, r := range right {
+		if primaryPhone(r) == "" {
+			continue
+		}
+		key := nameAndPhoneKey(r)
+		if rs := rightMap[key]; len(rs) > 0 && rs[0].FullId == r.FullId {
+			rightOnly = append(rightOnly, r)
+			rightMap[key] = rs[1:]
+		}
+	}
+	telMap := make(map[string][]Entry, len(rightOnly))
+	for _, r := range rightOnly {
+		if phone := primaryPhone(r); phone != "" {
+			telMap[phone] = append(telMap[phone], r)
+		}
+	}
+	for _, l := range leftOnly {
+		if primaryPhone(l) == "" {
+			continue
+		}
+		for _, r := range telMap[l.Phones[0]] {
+			conflicts = append(conflicts, []string{
+				l.FullId, r.FullId, l.Phones[0], l.FirstName + " " + l.LastName, r.FirstName + " " + r.LastName,
+			})
+		}
+	}
+	return
+}
+
+func nameAndPhoneKey(e Entry) string {
+	return NormalizeName(e.FirstName+" "+e.LastName) + "|" + primaryPhone(e)
+}
+
+// primaryPhone returns the first phone of the entry, or "" if it has none.
+//
+// Entries loaded from a spreadsheet with no phones have a single empty phone.
+func primaryPhone(e Entry) string {
+	if len(e.Phones) == 0 {
+		return ""
+	}
+	return e.Phones[0]
+}
+
+// NormalizeName returns a form of the name suitable for matching:
+// it is lower-cased, stripped of accents, and has its whitespace collapsed.
+func NormalizeName(name string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(t, name)
+	if err != nil {
+		stripped = name
+	}
+	return strings.Join(strings.Fields(strings.ToLower(stripped)), " ")
+}
+
 func FindWithoutPhones(entries []Entry) []Entry {
 	results := make([]Entry, 0)
 	for _, entry := range entries {
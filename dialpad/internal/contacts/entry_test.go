@@ -0,0 +1,143 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestCompareByNameAndPhone(t *testing.T) {
+	left := []Entry{
+		{FullId: "l1", FirstName: "José", LastName: "Pérez", Phones: []string{"+15105551234"}},
+		{FullId: "l2", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105554321"}},
+		{FullId: "l3", FirstName: "No", LastName: "Phone", Phones: []string{""}},
+	}
+	right := []Entry{
+		{FullId: "r1", FirstName: "jose", LastName: " perez ", Phones: []string{"+15105551234"}},
+		{FullId: "r2", FirstName: "Anne", LastName: "Smith", Phones: []string{"+15105554321"}},
+		{FullId: "r3", FirstName: "Other", LastName: "Person", Phones: []string{"+15105559999"}},
+	}
+	both, leftOnly, rightOnly, conflicts := CompareByNameAndPhone(left, right)
+	if diff := deep.Equal(both, [][]string{{"l1", "r1", "+15105551234", "José", "Pérez"}}); diff != nil {
+		t.Errorf("both: %v", diff)
+	}
+	if len(leftOnly) != 2 || leftOnly[0].FullId != "l2" || leftOnly[1].FullId != "l3" {
+		t.Errorf("left only: %v", leftOnly)
+	}
+	if len(rightOnly) != 2 || rightOnly[0].FullId != "r2" || rightOnly[1].FullId != "r3" {
+		t.Errorf("right only: %v", rightOnly)
+	}
+	expected := [][]string{{"l2", "r2", "+15105554321", "Ann Smith", "Anne Smith"}}
+	if diff := deep.Equal(conflicts, expected); diff != nil {
+		t.Errorf("conflicts: %v", diff)
+	}
+}
+
+func TestDiffEntriesIgnoresExtensions(t *testing.T) {
+	dialpad := []Entry{
+		{FullId: "d1", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}},
+	}
+	local := []Entry{
+		{FullId: "d1", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"},
+			PhoneExtensions: map[string]string{"+15105551234": "12"}},
+		{Uid: "2", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105554321"}},
+	}
+	update, create := DiffEntries(dialpad, local, false)
+	if len(update) != 0 {
+		t.Errorf("update: %v", update)
+	}
+	if len(create) != 1 || create[0].Uid != "2" {
+		t.Errorf("create: %v", create)
+	}
+}
+
+func TestDiffEntriesKeepsDialpadFields(t *testing.T) {
+	dialpad := []Entry{
+		{FullId: "d1", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"},
+			CompanyName: "Acme", JobTitle: "Advocate", Owner: "5551234", Type: "shared"},
+		{FullId: "d2", Uid: "2", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105554321"},
+			CompanyName: "Acme"},
+	}
+	local := []Entry{
+		{FullId: "d1", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}},
+		{FullId: "d2", Uid: "2", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105554321"},
+			CompanyName: "Widgets", Urls: []string{"https://example.com/bob"}},
+	}
+	update, create := DiffEntries(dialpad, local, false)
+	if len(create) != 0 {
+		t.Errorf("create: %v", create)
+	}
+	if len(update) != 1 || update[0].Uid != "2" {
+		t.Fatalf("update: %v", update)
+	}
+	if update[0].CompanyName != "Widgets" || len(update[0].Urls) != 1 {
+		t.Errorf("expected the local fields to win, got %v", update[0])
+	}
+	if body, _ := json.Marshal(dialpad[0].asRequest()); strings.Contains(string(body), `"type"`) || strings.Contains(string(body), `"owner_id"`) {
+		t.Errorf("expected the type and owner not to be sent, got %s", body)
+	}
+}
+
+func TestDiffEntriesClearsBlankFields(t *testing.T) {
+	dialpad := []Entry{
+		{FullId: "d1", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"},
+			CompanyName: "Acme", JobTitle: "Advocate", Urls: []string{"https://acme.com"}, Type: "shared"},
+	}
+	local := []Entry{
+		{FullId: "d1", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}},
+	}
+	if update, _ := DiffEntries(dialpad, local, false); len(update) != 0 {
+		t.Errorf("expected blank fields to be kept, got %v", update)
+	}
+	update, _ := DiffEntries(dialpad, local, true)
+	if len(update) != 1 || update[0].CompanyName != "" || update[0].JobTitle != "" || update[0].Urls != nil {
+		t.Errorf("expected blank fields to be cleared, got %v", update)
+	}
+	if update[0].Type != "shared" {
+		t.Errorf("expected the type to be kept, got %v", update[0])
+	}
+}
+
+func TestMatchDerivedUids(t *testing.T) {
+	dialpad := []Entry{
+		{Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}},
+		{Uid: "2", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105559999"}},
+		{Uid: "3", FirstName: "Cat", LastName: "Brown", Phones: []string{"+15105557777"}},
+		{Uid: "4", FirstName: "Dan", LastName: "Green", Phones: []string{"+15105556666"}},
+		{Uid: "5", FirstName: "Dan", LastName: "Green", Phones: []string{"+15105555555"}},
+	}
+	local := []Entry{
+		// renamed, so matched by phone
+		{Uid: "101", FirstName: "Ann", LastName: "Smyth", Phones: []string{"+15105551234"}, UidDerived: true},
+		// new phone, so matched by name
+		{Uid: "102", FirstName: "bob", LastName: "jones", Phones: []string{"+15105550000"}, UidDerived: true},
+		// its Dialpad contact has a source UID
+		{Uid: "3", FirstName: "Cat", LastName: "Brown", Phones: []string{"+15105557777"}},
+		{Uid: "103", FirstName: "Cat", LastName: "Brown", Phones: []string{"+15105557777"}, UidDerived: true},
+		// the name is ambiguous
+		{Uid: "104", FirstName: "Dan", LastName: "Green", Phones: []string{"+15105554444"}, UidDerived: true},
+		// unchanged, so matched by UID
+		{Uid: "5", FirstName: "Dan", LastName: "Green", Phones: []string{"+15105555555"}, UidDerived: true},
+	}
+	if matched := MatchDerivedUids(local, dialpad); matched != 3 {
+		t.Errorf("expected 3 matches, got %d", matched)
+	}
+	var uids []string
+	for _, e := range local {
+		uids = append(uids, e.Uid)
+	}
+	if diff := deep.Equal(uids, []string{"1", "2", "3", "103", "104", "5"}); diff != nil {
+		t.Error(diff)
+	}
+	if local[0].UidDerived || !local[3].UidDerived {
+		t.Errorf("expected matched entries to lose their derived flag: %v", local)
+	}
+}
@@ -0,0 +1,356 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A Filter selects entries by a boolean expression over their fields, such as
+//
+//	last_name = "" and phone ~ "^\+52" and created < 2023-01-01
+//
+// A comparison is a field, an operator, and a value.  The operators are
+// = and != (equality), ~ and !~ (regular expression match), and, for the
+// created field only, <, <=, >, and >=.  Comparisons can be combined with
+// and, or, not, and parentheses; and binds more tightly than or.
+//
+// Values are quoted with double or single quotes (inside which \" or \'
+// and \\ are the only escapes, so regular expressions can be written as
+// usual), or are bare words such as dates.
+//
+// The fields are listed in [FilterFields].  For fields with several values
+// (phones, emails, and URLs), a comparison is true if it's true of any
+// of the values, and != and !~ are true if = and ~ are true of none of
+// them.  A contact with no values is treated as having a single empty one,
+// so phone = "" selects the contacts without phones.
+//
+// The created field is the contact's UID read as a Unix time, which is how
+// UIDs are assigned to contacts from the inquiry spreadsheets.  Its values
+// are dates (2006-01-02, in local time) or RFC 3339 times, and contacts whose
+// UIDs aren't times (such as those derived from vCards) never match it.
+type Filter struct {
+	source string
+	root   filterNode
+}
+
+// FilterFields are the fields a [Filter] can compare, and their values in an entry.
+var FilterFields = map[string]func(Entry) []string{
+	"id":         func(e Entry) []string { return []string{e.FullId} },
+	"uid":        func(e Entry) []string { return []string{e.Uid} },
+	"first_name": func(e Entry) []string { return []string{e.FirstName} },
+	"last_name":  func(e Entry) []string { return []string{e.LastName} },
+	"name":       func(e Entry) []string { return []string{strings.TrimSpace(e.FirstName + " " + e.LastName)} },
+	"phone":      func(e Entry) []string { return nonBlank(e.Phones) },
+	"email":      func(e Entry) []string { return nonBlank(e.Emails) },
+	"company":    func(e Entry) []string { return []string{e.CompanyName} },
+	"job_title":  func(e Entry) []string { return []string{e.JobTitle} },
+	"url":        func(e Entry) []string { return nonBlank(e.Urls) },
+	"extension":  func(e Entry) []string { return []string{e.Extension} },
+	"owner":      func(e Entry) []string { return []string{e.Owner} },
+	"type":       func(e Entry) []string { return []string{e.Type} },
+}
+
+// latestCreation is the latest time a UID can be and still be read as
+// a creation time.  Derived UIDs are much larger.
+var latestCreation = time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+// ParseFilter compiles a filter expression.
+func ParseFilter(expr string) (*Filter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != endToken {
+		return nil, fmt.Errorf("at position %d: unexpected %q", t.pos+1, t.text)
+	}
+	return &Filter{source: expr, root: root}, nil
+}
+
+// Match tells whether the entry satisfies the filter.
+func (f *Filter) Match(e Entry) bool {
+	return f.root.match(e)
+}
+
+func (f *Filter) String() string {
+	return f.source
+}
+
+// FilterEntries returns the entries that satisfy the filter, in order.
+func FilterEntries(entries []Entry, f *Filter) (results []Entry) {
+	for _, e := range entries {
+		if f.Match(e) {
+			results = append(results, e)
+		}
+	}
+	return
+}
+
+// EntryCreated returns the creation time of the entry, if its UID is one.
+func EntryCreated(e Entry) (time.Time, bool) {
+	secs, err := strconv.ParseInt(e.Uid, 10, 64)
+	if err != nil || secs <= 0 || secs >= latestCreation {
+		return time.Time{}, false
+	}
+	return time.Unix(secs, 0), true
+}
+
+type filterNode interface {
+	match(e Entry) bool
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) match(e Entry) bool { return n.left.match(e) && n.right.match(e) }
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) match(e Entry) bool { return n.left.match(e) || n.right.match(e) }
+
+type notNode struct{ inner filterNode }
+
+func (n notNode) match(e Entry) bool { return !n.inner.match(e) }
+
+// compareNode is a comparison of a (possibly many-valued) field with a value.
+type compareNode struct {
+	values  func(Entry) []string
+	negated bool
+	test    func(string) bool
+}
+
+func (n compareNode) match(e Entry) bool {
+	values := n.values(e)
+	if len(values) == 0 {
+		values = []string{""}
+	}
+	for _, v := range values {
+		if n.test(v) {
+			return !n.negated
+		}
+	}
+	return n.negated
+}
+
+// createdNode is a comparison of the entry's creation time with a time.
+type createdNode struct {
+	op   string
+	when time.Time
+}
+
+func (n createdNode) match(e Entry) bool {
+	created, ok := EntryCreated(e)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return created.Before(n.when)
+	case "<=":
+		return !created.After(n.when)
+	case ">":
+		return created.After(n.when)
+	default:
+		return !created.Before(n.when)
+	}
+}
+
+type tokenKind int
+
+const (
+	endToken tokenKind = iota
+	wordToken
+	stringToken
+	opToken
+	parenToken
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lexFilter splits a filter expression into tokens.
+func lexFilter(expr string) (tokens []filterToken, err error) {
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, filterToken{parenToken, string(c), i})
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			start := i
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("at position %d: unterminated string", start+1)
+				}
+				if runes[i] == c {
+					i++
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == c || runes[i+1] == '\\') {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			tokens = append(tokens, filterToken{stringToken, b.String(), start})
+		case strings.ContainsRune("=!~<>", c):
+			op := string(c)
+			if i+1 < len(runes) && (c == '!' || c == '<' || c == '>') && strings.ContainsRune("=~", runes[i+1]) {
+				op += string(runes[i+1])
+			}
+			if op == "!" || op == "<~" || op == ">~" {
+				return nil, fmt.Errorf("at position %d: unknown operator %q", i+1, op)
+			}
+			tokens = append(tokens, filterToken{opToken, op, i})
+			i += len(op)
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()\"'=!~<>", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{wordToken, string(runes[start:i]), start})
+		}
+	}
+	return append(tokens, filterToken{endToken, "end of expression", len(runes)}), nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	next   int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.next]
+}
+
+func (p *filterParser) take() filterToken {
+	t := p.tokens[p.next]
+	if t.kind != endToken {
+		p.next++
+	}
+	return t
+}
+
+// isKeyword tells whether the next token is the given keyword (in any case).
+func (p *filterParser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == wordToken && strings.EqualFold(t.text, word)
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	left, err := p.and()
+	for err == nil && p.isKeyword("or") {
+		p.take()
+		var right filterNode
+		if right, err = p.and(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	left, err := p.unary()
+	for err == nil && p.isKeyword("and") {
+		p.take()
+		var right filterNode
+		if right, err = p.unary(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) unary() (filterNode, error) {
+	if p.isKeyword("not") {
+		p.take()
+		inner, err := p.unary()
+		return notNode{inner}, err
+	}
+	if t := p.peek(); t.kind == parenToken && t.text == "(" {
+		p.take()
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.take(); t.kind != parenToken || t.text != ")" {
+			return nil, fmt.Errorf("at position %d: expected \")\" but found %q", t.pos+1, t.text)
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (filterNode, error) {
+	field := p.take()
+	if field.kind != wordToken {
+		return nil, fmt.Errorf("at position %d: expected a field name but found %q", field.pos+1, field.text)
+	}
+	name := strings.ToLower(field.text)
+	op := p.take()
+	if op.kind != opToken {
+		return nil, fmt.Errorf("at position %d: expected an operator after %q but found %q", op.pos+1, field.text, op.text)
+	}
+	value := p.take()
+	if value.kind != wordToken && value.kind != stringToken {
+		return nil, fmt.Errorf("at position %d: expected a value after %q but found %q", value.pos+1, op.text, value.text)
+	}
+	if name == "created" {
+		if !strings.ContainsAny(op.text[:1], "<>") {
+			return nil, fmt.Errorf("at position %d: created can only be compared with <, <=, >, or >=", op.pos+1)
+		}
+		when, err := parseFilterTime(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("at position %d: %v", value.pos+1, err)
+		}
+		return createdNode{op.text, when}, nil
+	}
+	values, ok := FilterFields[name]
+	if !ok {
+		return nil, fmt.Errorf("at position %d: unknown field %q", field.pos+1, field.text)
+	}
+	node := compareNode{values: values, negated: strings.HasPrefix(op.text, "!")}
+	switch op.text {
+	case "=", "!=":
+		node.test = func(v string) bool { return v == value.text }
+	case "~", "!~":
+		re, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("at position %d: invalid regular expression: %v", value.pos+1, err)
+		}
+		node.test = re.MatchString
+	default:
+		return nil, fmt.Errorf("at position %d: %s can only be compared with =, !=, ~, or !~", op.pos+1, field.text)
+	}
+	return node, nil
+}
+
+// parseFilterTime reads a date (in local time) or an RFC 3339 time.
+func parseFilterTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date (2006-01-02) or time (2006-01-02T15:04:05Z)", s)
+}
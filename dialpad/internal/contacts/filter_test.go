@@ -0,0 +1,79 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestFilterEntries(t *testing.T) {
+	created := func(date string) string {
+		when, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+		return fmt.Sprint(when.Unix())
+	}
+	entries := []Entry{
+		{Uid: created("2022-06-01"), FirstName: "Ana", Phones: []string{"+525512345678"}},
+		{Uid: created("2023-06-01"), FirstName: "Beto", Phones: []string{"+525587654321"}},
+		{Uid: created("2022-06-01"), FirstName: "Cara", LastName: "Diaz", Phones: []string{"+525500000000"}},
+		{Uid: derivedUid("vcard"), FirstName: "Dan", Phones: []string{"+15105551234"}, Emails: []string{"dan@example.com"}},
+		{Uid: created("2021-01-01"), FirstName: "Eve", Phones: []string{""}, CompanyName: "Acme"},
+	}
+	firstNames := func(entries []Entry) (names []string) {
+		for _, e := range entries {
+			names = append(names, e.FirstName)
+		}
+		return
+	}
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{`last_name = "" and phone ~ "^\+52" and created < 2023-01-01`, []string{"Ana"}},
+		{`phone = ""`, []string{"Eve"}},
+		{`phone != ""`, []string{"Ana", "Beto", "Cara", "Dan"}},
+		{`created >= 2022-06-01`, []string{"Ana", "Beto", "Cara"}},
+		{`not created < 2030-01-01`, []string{"Dan"}},
+		{`email ~ '@example\.com$' or company = 'Acme'`, []string{"Dan", "Eve"}},
+		{`NAME = "Cara Diaz" OR (first_name ~ "^B" AND NOT phone !~ "8765")`, []string{"Beto", "Cara"}},
+		{`first_name = "Zed"`, nil},
+	}
+	for _, test := range tests {
+		f, err := ParseFilter(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if diff := deep.Equal(firstNames(FilterEntries(entries, f)), test.expected); diff != nil {
+			t.Errorf("%s: %v", test.expr, diff)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`phone`,
+		`phone ~`,
+		`phone < "5"`,
+		`created = 2023-01-01`,
+		`created < yesterday`,
+		`color = "red"`,
+		`phone ~ "("`,
+		`name = "Ann`,
+		`(name = "Ann"`,
+		`name = "Ann" name = "Bob"`,
+		`name ! "Ann"`,
+	} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("expected %q not to parse", expr)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// gramLength is the length of the n-grams in a [SearchIndex].
+const gramLength = 3
+
+// A SearchIndex answers the questions asked by the search pages without
+// scanning all the contacts: which contacts have a given phone, and which
+// phones might match a query.
+//
+// It's built once, when the contacts are loaded, and is never changed,
+// so it can be shared by concurrent requests.
+type SearchIndex struct {
+	entries    []Entry
+	names      []string
+	byPhone    map[string][]int
+	nameGrams  map[string][]string
+	digitGrams map[string][]string
+}
+
+// NewSearchIndex indexes the given entries.
+func NewSearchIndex(entries []Entry) *SearchIndex {
+	x := &SearchIndex{
+		entries:    entries,
+		names:      make([]string, len(entries)),
+		byPhone:    make(map[string][]int),
+		nameGrams:  make(map[string][]string),
+		digitGrams: make(map[string][]string),
+	}
+	for i, entry := range entries {
+		x.names[i] = NormalizeName(entry.FirstName + " " + entry.LastName)
+		nameGrams := grams(x.names[i])
+		for _, phone := range entry.Phones {
+			if phone == "" {
+				continue
+			}
+			if postings := x.byPhone[phone]; len(postings) == 0 || postings[len(postings)-1] != i {
+				x.byPhone[phone] = append(postings, i)
+			}
+			for _, gram := range nameGrams {
+				addPosting(x.nameGrams, gram, phone)
+			}
+			for _, gram := range grams(phone) {
+				addPosting(x.digitGrams, gram, phone)
+			}
+		}
+	}
+	return x
+}
+
+// Entries is [SelectEntriesByPhones] for the indexed entries: it returns
+// a search entry for each contact with one of the phones (using the first
+// of its phones that's in the set), followed by a search entry with an
+// unknown name for each other phone.
+func (x *SearchIndex) Entries(phones []string) []SearchEntry {
+	all := make(map[string]bool, len(phones))
+	var indexes []int
+	for _, phone := range phones {
+		all[phone] = true
+		indexes = append(indexes, x.byPhone[phone]...)
+	}
+	slices.Sort(indexes)
+	indexes = slices.Compact(indexes)
+	var results []SearchEntry
+	found := make(map[string]bool, len(phones))
+	for _, i := range indexes {
+		entry := x.entries[i]
+		for _, phone := range entry.Phones {
+			if all[phone] {
+				found[phone] = true
+				results = append(results, SearchEntry{
+					FullName:   entry.FirstName + " " + entry.LastName,
+					Phone:      phone,
+					Extension:  entry.PhoneExtensions[phone],
+					normalized: x.names[i],
+				})
+				break
+			}
+		}
+	}
+	for _, phone := range phones {
+		if strings.HasPrefix(phone, "+") && !found[phone] {
+			results = append(results, SearchEntry{FullName: UnknownName, Phone: phone})
+		}
+	}
+	return results
+}
+
+// Candidates returns the indexed phones whose contacts might match the query,
+// either by [RankSearchEntries] or by [FilterSearchEntries].  Every phone
+// that does match is a candidate, but not every candidate matches.
+//
+// If the query is too short to use the index, ok is false, and every
+// phone must be treated as a candidate.  Phones that aren't indexed
+// (because no contact has them) are never candidates, but they may
+// still match by name (as unknown contacts).
+func (x *SearchIndex) Candidates(query string) (phones map[string]bool, ok bool) {
+	name := NormalizeName(query)
+	digits := nonDigitsOnly.ReplaceAllString(query, "")
+	if utf8.RuneCountInString(name) < gramLength || (digits != "" && len(digits) < gramLength) {
+		return nil, false
+	}
+	phones = make(map[string]bool)
+	for _, phone := range intersectPostings(x.nameGrams, grams(name)) {
+		phones[phone] = true
+	}
+	if digits != "" {
+		for _, phone := range intersectPostings(x.digitGrams, grams(digits)) {
+			phones[phone] = true
+		}
+	}
+	return phones, true
+}
+
+// Has reports whether any indexed contact has the phone.
+func (x *SearchIndex) Has(phone string) bool {
+	return len(x.byPhone[phone]) > 0
+}
+
+// grams returns the distinct n-grams of s, or s itself if it's shorter than an n-gram.
+func grams(s string) []string {
+	runes := []rune(s)
+	if len(runes) <= gramLength {
+		return []string{s}
+	}
+	var results []string
+	for i := 0; i+gramLength <= len(runes); i++ {
+		gram := string(runes[i : i+gramLength])
+		if !slices.Contains(results, gram) {
+			results = append(results, gram)
+		}
+	}
+	return results
+}
+
+func addPosting(index map[string][]string, gram, phone string) {
+	if postings := index[gram]; len(postings) == 0 || postings[len(postings)-1] != phone {
+		index[gram] = append(postings, phone)
+	}
+}
+
+// intersectPostings returns the phones that are in the postings of all the grams.
+func intersectPostings(index map[string][]string, grams []string) []string {
+	slices.SortFunc(grams, func(a, b string) int { return len(index[a]) - len(index[b]) })
+	results := index[grams[0]]
+	for _, gram := range grams[1:] {
+		if len(results) == 0 {
+			break
+		}
+		postings := make(map[string]bool, len(index[gram]))
+		for _, phone := range index[gram] {
+			postings[phone] = true
+		}
+		results = slices.DeleteFunc(slices.Clone(results), func(phone string) bool { return !postings[phone] })
+	}
+	return results
+}
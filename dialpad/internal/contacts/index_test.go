@@ -0,0 +1,141 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+var (
+	syntheticFirstNames = []string{"Ann", "José", "María", "Wei", "Fatima", "Olu", "Priya", "Dmitri", "Aiyana", "Ngozi", "Tomás", "Kenji"}
+	syntheticLastNames  = []string{"Smith", "Pérez", "García", "Chen", "Okafor", "Nguyen", "Khan", "Ivanova", "Brown", "Lee", "Annan", "Silva"}
+)
+
+// syntheticEntries returns n contacts with realistic names and phones,
+// some of which share phones, and all the phones in use.
+func syntheticEntries(rng *rand.Rand, n int) (entries []Entry, phones []string) {
+	for i := 0; i < n; i++ {
+		entry := Entry{
+			FullId:    fmt.Sprintf("shared_contact_a_uid_%d", i+1),
+			Uid:       fmt.Sprint(i + 1),
+			FirstName: syntheticFirstNames[rng.IntN(len(syntheticFirstNames))] + fmt.Sprint(rng.IntN(100)),
+			LastName:  syntheticLastNames[rng.IntN(len(syntheticLastNames))],
+		}
+		for j := 0; j < 1+rng.IntN(3); j++ {
+			var phone string
+			if len(phones) > 0 && rng.IntN(20) == 0 {
+				phone = phones[rng.IntN(len(phones))]
+			} else {
+				phone = fmt.Sprintf("+1%d%03d%04d", 200+rng.IntN(800), 200+rng.IntN(800), rng.IntN(10000))
+				phones = append(phones, phone)
+			}
+			if !slices.Contains(entry.Phones, phone) {
+				entry.Phones = append(entry.Phones, phone)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// readerPhones picks n of the phones (plus a few that aren't in any contact).
+func readerPhones(rng *rand.Rand, phones []string, n int) []string {
+	var picked []string
+	for _, i := range rng.Perm(len(phones))[:n] {
+		picked = append(picked, phones[i])
+	}
+	for i := 0; i < n/10; i++ {
+		picked = append(picked, fmt.Sprintf("+1415555%04d", i))
+	}
+	return picked
+}
+
+var syntheticQueries = []string{"", "a", "an", "ann", "annan", "jose", "josé pérez", "garc", "5", "55", "555", "415", "(415) 555", "ann 510", "kenji4", "zzz"}
+
+func TestSearchIndexEntries(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	entries, phones := syntheticEntries(rng, 2000)
+	x := NewSearchIndex(entries)
+	for i := 0; i < 20; i++ {
+		reader := readerPhones(rng, phones, 100)
+		if diff := deep.Equal(x.Entries(reader), SelectEntriesByPhones(reader, entries)); diff != nil {
+			t.Fatalf("reader %d: %v", i, diff)
+		}
+	}
+}
+
+func TestSearchIndexCandidates(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	entries, phones := syntheticEntries(rng, 2000)
+	x := NewSearchIndex(entries)
+	all := x.Entries(phones)
+	now := time.Now()
+	for _, query := range syntheticQueries {
+		candidates, ok := x.Candidates(query)
+		if !ok {
+			continue
+		}
+		matches := FilterSearchEntries(query, all)
+		for _, ranked := range RankSearchEntries(query, all, nil, now) {
+			matches = append(matches, ranked.SearchEntry)
+		}
+		for _, match := range matches {
+			if !candidates[match.Phone] {
+				t.Errorf("%q: %v matches but isn't a candidate", query, match)
+			}
+		}
+	}
+	if _, ok := x.Candidates("an"); ok {
+		t.Errorf("expected a two-letter query not to use the index")
+	}
+	if _, ok := x.Candidates("ann 5"); ok {
+		t.Errorf("expected a one-digit query not to use the index")
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	entries, phones := syntheticEntries(rng, 50000)
+	reader := readerPhones(rng, phones, 2000)
+	now := time.Now()
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			query := syntheticQueries[i%len(syntheticQueries)]
+			found := SelectEntriesByPhones(reader, entries)
+			_ = RankSearchEntries(query, found, nil, now)
+		}
+	})
+	x := NewSearchIndex(entries)
+	readerSet := make(map[string]bool, len(reader))
+	for _, phone := range reader {
+		readerSet[phone] = true
+	}
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			query := syntheticQueries[i%len(syntheticQueries)]
+			candidates, ok := x.Candidates(query)
+			var phones []string
+			for _, phone := range reader {
+				if !ok || candidates[phone] || !x.Has(phone) {
+					phones = append(phones, phone)
+				}
+			}
+			_ = RankSearchEntries(query, x.Entries(phones), nil, now)
+		}
+	})
+	b.Run("build", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = NewSearchIndex(entries)
+		}
+	})
+}
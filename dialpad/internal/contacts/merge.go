@@ -0,0 +1,121 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"fmt"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// A MergeGroup is one group of a merge plan: the surviving contact
+// and the other contacts that are to be merged into it.
+type MergeGroup struct {
+	Group    string
+	Survivor Entry
+	Others   []Entry
+}
+
+// A MergeRecord is the undo journal entry for one merge.
+//
+// Before and Deleted are the contacts as they were in Dialpad before
+// the merge, and After is the survivor as it was updated by the merge.
+type MergeRecord struct {
+	Group   string
+	Before  Entry
+	After   Entry
+	Deleted []Entry
+}
+
+// PlanMerges matches the groups of a merge plan against the current Dialpad
+// contacts, and returns a journal record for each group that can be merged.
+//
+// The survivor keeps the name given to it in the plan, and gets the union of
+// the phones and emails of all the group members (both as planned and as they
+// are in Dialpad).  Groups whose members are no longer in Dialpad are skipped
+// with an error.
+func PlanMerges(plan []MergeGroup, current []Entry) (records []MergeRecord, errs []error) {
+	byId := make(map[string]Entry, len(current))
+	for _, e := range current {
+		byId[e.FullId] = e
+	}
+	for _, group := range plan {
+		before, ok := byId[group.Survivor.FullId]
+		if !ok {
+			errs = append(errs, fmt.Errorf("group %s: survivor %s is not in Dialpad", group.Group, group.Survivor.FullId))
+			continue
+		}
+		var deleted []Entry
+		for _, other := range group.Others {
+			if e, ok := byId[other.FullId]; !ok {
+				errs = append(errs, fmt.Errorf("group %s: contact %s is not in Dialpad", group.Group, other.FullId))
+			} else {
+				deleted = append(deleted, e)
+			}
+		}
+		if len(deleted) != len(group.Others) {
+			continue
+		}
+		after := before
+		after.FirstName, after.LastName = group.Survivor.FirstName, group.Survivor.LastName
+		after.Phones, after.Emails = group.Survivor.Phones, group.Survivor.Emails
+		after = MergeInfo(after, append([]Entry{before}, append(group.Others, deleted...)...))
+		records = append(records, MergeRecord{Group: group.Group, Before: before, After: after, Deleted: deleted})
+	}
+	return
+}
+
+// SaveMergeJournal saves the merge records, encrypted, to the given path.
+func SaveMergeJournal(records []MergeRecord, path string) error {
+	return storage.SaveEncryptedGob(path, records)
+}
+
+// LoadMergeJournal loads the merge records saved at the given path.
+func LoadMergeJournal(path string) ([]MergeRecord, error) {
+	var records []MergeRecord
+	if err := storage.LoadEncryptedGob(path, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// uploadable returns a copy of the entry suitable for sending to [UpdateContact].
+//
+// Dialpad contacts are created and updated by their UID, so the full ID is omitted.
+func uploadable(entry Entry) Entry {
+	entry.FullId = ""
+	return entry
+}
+
+// ExecuteMerge updates the survivor of the merge, and then deletes the others.
+//
+// If the survivor can't be updated, nothing is deleted.
+func ExecuteMerge(record MergeRecord) (errs []error) {
+	if _, err := UpdateContact(uploadable(record.After)); err != nil {
+		return []error{err}
+	}
+	for _, e := range record.Deleted {
+		if err := DeleteContact(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+// UndoMerge recreates the deleted contacts of the merge,
+// and then restores the survivor to its state before the merge.
+func UndoMerge(record MergeRecord) (errs []error) {
+	for _, e := range record.Deleted {
+		if _, err := UpdateContact(uploadable(e)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := UpdateContact(uploadable(record.Before)); err != nil {
+		errs = append(errs, err)
+	}
+	return
+}
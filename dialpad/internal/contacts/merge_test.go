@@ -0,0 +1,52 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestPlanMerges(t *testing.T) {
+	current := []Entry{
+		{FullId: "a_uid_1", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}},
+		{FullId: "a_uid_2", Uid: "2", FirstName: "Anne", LastName: "Smith", Phones: []string{"+15105559999"}, Emails: []string{"ann@example.com"}},
+		{FullId: "a_uid_3", Uid: "3", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105550000"}},
+	}
+	plan := []MergeGroup{
+		{
+			Group:    "1",
+			Survivor: Entry{FullId: "a_uid_1", Uid: "1", FirstName: "Anne", LastName: "Smith", Phones: []string{"+15105551234"}},
+			Others:   []Entry{{FullId: "a_uid_2", Uid: "2"}},
+		},
+		{
+			Group:    "2",
+			Survivor: Entry{FullId: "a_uid_3", Uid: "3"},
+			Others:   []Entry{{FullId: "a_uid_4", Uid: "4"}},
+		},
+	}
+	records, errs := PlanMerges(plan, current)
+	if len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %v", records)
+	}
+	expected := MergeRecord{
+		Group:  "1",
+		Before: current[0],
+		After: Entry{
+			FullId: "a_uid_1", Uid: "1", FirstName: "Anne", LastName: "Smith",
+			Phones: []string{"+15105551234", "+15105559999"}, Emails: []string{"ann@example.com"},
+		},
+		Deleted: []Entry{current[1]},
+	}
+	if diff := deep.Equal(records[0], expected); diff != nil {
+		t.Error(diff)
+	}
+}
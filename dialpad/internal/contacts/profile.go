@@ -0,0 +1,307 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A ColumnProfile maps the columns of a contacts spreadsheet to [Entry] fields.
+//
+// Names come from the FirstName and LastName columns or, if those are empty,
+// from the FullName column.  Every one of the Phones and Emails columns is used,
+// and each may hold several values.  Columns that aren't in the spreadsheet are
+// ignored, but it must have at least one name column and one phone column.
+//
+// If there is an Id column, each contact's UID is the source's own ID for it
+// in that column (or, if that isn't numeric, is derived from it).  Rows with
+// no ID fall back to the Date column: each contact's UID is its creation date
+// (as a Unix time) in that column, which is read using the first of the
+// DateFormats that fits (in the profile's TimeZone); rows with no date are
+// skipped.  UIDs must be unique, so the DateFormats need a resolution finer
+// than the rate at which contacts are created: the default profile's dates
+// are to the second.  Rows with neither get a UID derived from their names
+// and phones, which upload and sync replace with the UID of the matching
+// Dialpad contact (see [MatchDerivedUids]), if there is one.
+type ColumnProfile struct {
+	Name        string   `yaml:"name"`
+	Id          string   `yaml:"id"`
+	Date        string   `yaml:"date"`
+	DateFormats []string `yaml:"date_formats"`
+	TimeZone    string   `yaml:"time_zone"`
+	FirstName   string   `yaml:"first_name"`
+	LastName    string   `yaml:"last_name"`
+	FullName    string   `yaml:"full_name"`
+	Phones      []string `yaml:"phones"`
+	Emails      []string `yaml:"emails"`
+}
+
+var (
+	// DefaultProfile is the profile for our own contacts spreadsheets,
+	// which have the [ImportColumnNames].
+	DefaultProfile = ColumnProfile{
+		Name:        "dialpad",
+		Date:        "Creation Date",
+		DateFormats: []string{"01/02/2006 03:04:05 PM"},
+		TimeZone:    "America/Los_Angeles",
+		FirstName:   "First_Name",
+		LastName:    "Last_Name",
+		Phones:      []string{"Phones"},
+		Emails:      []string{"Email"},
+	}
+	// GoogleProfile is the profile for a Google Contacts CSV export.
+	GoogleProfile = ColumnProfile{
+		Name:      "google",
+		FirstName: "First Name",
+		LastName:  "Last Name",
+		Phones:    []string{"Phone 1 - Value", "Phone 2 - Value", "Phone 3 - Value", "Phone 4 - Value"},
+		Emails:    []string{"E-mail 1 - Value", "E-mail 2 - Value", "E-mail 3 - Value"},
+	}
+	// OutlookProfile is the profile for an Outlook contacts CSV export.
+	OutlookProfile = ColumnProfile{
+		Name:      "outlook",
+		FirstName: "First Name",
+		LastName:  "Last Name",
+		Phones: []string{
+			"Mobile Phone", "Primary Phone", "Home Phone", "Home Phone 2",
+			"Business Phone", "Business Phone 2", "Other Phone",
+		},
+		Emails: []string{"E-mail Address", "E-mail 2 Address", "E-mail 3 Address"},
+	}
+	// AirtableProfile is the profile for a CSV export of the Airtable master table.
+	// Its creation dates are only as precise as the field's format: the ISO
+	// format is to the millisecond, but the others are to the minute or the
+	// day, so contacts created in the same minute (or day) get the same UID
+	// and all but the first of them are reported as duplicates.  Export the
+	// field in the ISO format to avoid that.
+	AirtableProfile = ColumnProfile{
+		Name:        "airtable",
+		Date:        "Creation Date",
+		DateFormats: []string{"1/2/2006 3:04pm", "2006-01-02T15:04:05.000Z", "2006-01-02", "1/2/2006"},
+		TimeZone:    "America/Los_Angeles",
+		FullName:    "Name",
+		Phones:      []string{"Phone Number", "Outside of US Phone Number"},
+		Emails:      []string{"Email"},
+	}
+	builtinProfiles = []ColumnProfile{DefaultProfile, GoogleProfile, OutlookProfile, AirtableProfile}
+)
+
+// ProfileNames returns the names of the built-in profiles.
+func ProfileNames() (names []string) {
+	for _, p := range builtinProfiles {
+		names = append(names, p.Name)
+	}
+	return
+}
+
+// LookupProfile returns the built-in profile with the given name or, if the
+// name is the path of a YAML file, the custom profile in that file.
+func LookupProfile(name string) (ColumnProfile, error) {
+	if ext := strings.ToLower(filepath.Ext(name)); ext == ".yaml" || ext == ".yml" {
+		return LoadProfile(name)
+	}
+	for _, p := range builtinProfiles {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	return ColumnProfile{}, fmt.Errorf("unknown profile %q (known profiles are %s)", name, strings.Join(ProfileNames(), ", "))
+}
+
+// LoadProfile reads a custom profile from a YAML file, whose keys are the
+// yaml tags of the [ColumnProfile] fields.
+func LoadProfile(path string) (ColumnProfile, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return ColumnProfile{}, err
+	}
+	var p ColumnProfile
+	if err = yaml.Unmarshal(bytes, &p); err != nil {
+		return ColumnProfile{}, fmt.Errorf("profile %q not understood: %v", path, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if p.Date != "" && len(p.DateFormats) == 0 {
+		p.DateFormats = DefaultProfile.DateFormats
+	}
+	if p.Date != "" && p.TimeZone == "" {
+		p.TimeZone = DefaultProfile.TimeZone
+	}
+	if p.FirstName == "" && p.LastName == "" && p.FullName == "" {
+		return ColumnProfile{}, fmt.Errorf("profile %q has no name columns", path)
+	}
+	if len(p.Phones) == 0 {
+		return ColumnProfile{}, fmt.Errorf("profile %q has no phone columns", path)
+	}
+	return p, nil
+}
+
+// A columnMap locates the columns of a profile in a particular spreadsheet.
+// Columns that aren't in the spreadsheet have index -1.
+type columnMap struct {
+	profile  ColumnProfile
+	header   []string
+	location *time.Location
+	id       int
+	date     int
+	first    int
+	last     int
+	full     int
+	phones   []int
+	emails   []int
+}
+
+// mapColumns locates the profile's columns in a spreadsheet with the given header.
+func (p ColumnProfile) mapColumns(header []string) (*columnMap, error) {
+	find := func(name string) int {
+		if name == "" {
+			return -1
+		}
+		return slices.IndexFunc(header, func(h string) bool { return strings.TrimSpace(h) == name })
+	}
+	findAll := func(names []string) (indexes []int) {
+		for _, name := range names {
+			if i := find(name); i >= 0 {
+				indexes = append(indexes, i)
+			}
+		}
+		return
+	}
+	m := &columnMap{
+		profile: p,
+		header:  header,
+		id:      find(p.Id),
+		date:    find(p.Date),
+		first:   find(p.FirstName),
+		last:    find(p.LastName),
+		full:    find(p.FullName),
+		phones:  findAll(p.Phones),
+		emails:  findAll(p.Emails),
+	}
+	if p.Id != "" && m.id < 0 {
+		return nil, fmt.Errorf("no %q column for the %s profile in %v", p.Id, p.Name, header)
+	}
+	if p.Date != "" && m.date < 0 {
+		return nil, fmt.Errorf("no %q column for the %s profile in %v", p.Date, p.Name, header)
+	}
+	if m.first < 0 && m.last < 0 && m.full < 0 {
+		return nil, fmt.Errorf("no name columns for the %s profile in %v", p.Name, header)
+	}
+	if len(m.phones) == 0 {
+		return nil, fmt.Errorf("no phone columns for the %s profile in %v", p.Name, header)
+	}
+	if p.Date != "" {
+		loc, err := time.LoadLocation(p.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s has an invalid time zone: %v", p.Name, err)
+		}
+		m.location = loc
+	}
+	return m, nil
+}
+
+// cell returns the value in the given column of the record, or "" if there is none.
+func cell(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+// joinCells joins the values in the given columns, so they can be parsed as a list.
+// Google puts several values in one cell with a " ::: " separator.
+func joinCells(record []string, indexes []int) string {
+	var values []string
+	for _, i := range indexes {
+		values = append(values, strings.ReplaceAll(cell(record, i), ":::", ";"))
+	}
+	return strings.Join(values, ";")
+}
+
+// sourceUid returns the UID given by the source ID in the record, or "" if
+// there is no ID column or the ID is blank.
+func (m *columnMap) sourceUid(record []string) string {
+	id := strings.TrimSpace(cell(record, m.id))
+	switch {
+	case id == "":
+		return ""
+	case numericUid.MatchString(id):
+		return id
+	default:
+		return derivedUid(id)
+	}
+}
+
+// uid returns the UID given by the date in the record, or "" if the date is blank.
+func (m *columnMap) uid(record []string) (string, error) {
+	ts := strings.TrimSpace(cell(record, m.date))
+	if ts == "" {
+		return "", nil
+	}
+	var firstErr error
+	for _, layout := range m.profile.DateFormats {
+		t, err := time.ParseInLocation(layout, ts, m.location)
+		if err == nil {
+			return strconv.FormatInt(t.Unix(), 10), nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", fmt.Errorf("%v: %q", firstErr, ts)
+}
+
+// names returns the first and last names in the record,
+// using the full name column if the others are empty.
+func (m *columnMap) names(record []string) (first, last string) {
+	first, last = cell(record, m.first), cell(record, m.last)
+	if strings.TrimSpace(first) == "" && strings.TrimSpace(last) == "" {
+		first, last = splitFullName(cell(record, m.full))
+	}
+	return
+}
+
+// nameColumn returns the index and value of the first non-blank name column
+// in the record or, if they are all blank, of the first name column.
+func (m *columnMap) nameColumn(record []string) (int, string) {
+	columns := slices.DeleteFunc([]int{m.first, m.last, m.full}, func(i int) bool { return i < 0 })
+	for _, i := range columns {
+		if value := cell(record, i); strings.TrimSpace(value) != "" {
+			return i, value
+		}
+	}
+	return columns[0], ""
+}
+
+// field returns the header of the given column.
+func (m *columnMap) field(i int) string {
+	return strings.TrimSpace(cell(m.header, i))
+}
+
+// entryUid returns the UID derived from the entry's names and phones,
+// for contacts whose source has no ID or date for them.
+func entryUid(entry Entry) string {
+	return derivedUid(strings.Join(append([]string{entry.FirstName, entry.LastName}, entry.Phones...), "\x00"))
+}
+
+// derivedUid returns a numeric UID derived from the given key, for contacts
+// whose source doesn't provide one.  The same key always gets the same UID.
+func derivedUid(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return strconv.FormatUint(binary.BigEndian.Uint64(sum[:8])>>1, 10)
+}
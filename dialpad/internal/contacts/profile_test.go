@@ -0,0 +1,171 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseDefaultProfile(t *testing.T) {
+	path := writeTestFile(t, "contacts.csv",
+		"Email,Phones,Last_Name,First_Name,Creation Date,Notes\n"+
+			"ann@example.com,510-555-1234,Smith,Ann,11/01/2024 09:30:00 AM,extra\n"+
+			",510-555-9999,Jones,Bob,,no date\n",
+	)
+	entries, err := ParseContacts(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{{
+		Uid: "1730478600", FirstName: "Ann", LastName: "Smith",
+		Phones: []string{"+15105551234"}, Emails: []string{"ann@example.com"},
+	}}
+	if diff := deep.Equal(entries, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParseGoogleProfile(t *testing.T) {
+	path := writeTestFile(t, "google.csv",
+		"First Name,Middle Name,Last Name,E-mail 1 - Value,Phone 1 - Type,Phone 1 - Value,Phone 2 - Value\n"+
+			"Ann,,Smith,ann@example.com,Mobile,(510) 555-1234 ::: +44 20 7946 0958,415-555-9876\n",
+	)
+	if _, err := ParseContacts(path, false); err == nil {
+		t.Errorf("expected the default profile to reject a Google export")
+	}
+	profile, err := LookupProfile("Google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ParseProfileContacts(path, profile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %v", entries)
+	}
+	if diff := deep.Equal(entries[0].Phones, []string{"+15105551234", "+442079460958", "+14155559876"}); diff != nil {
+		t.Error(diff)
+	}
+	if !numericUid.MatchString(entries[0].Uid) {
+		t.Errorf("expected a derived numeric UID, got %q", entries[0].Uid)
+	}
+}
+
+func TestParseAirtableProfile(t *testing.T) {
+	path := writeTestFile(t, "master.csv",
+		"Name,Phone Number,Outside of US Phone Number,Email,Creation Date\n"+
+			"Ann Marie Smith,510-555-1234,,ann@example.com,11/1/2024 9:30am\n"+
+			"Bob,,+52 55 1234 5678,,2024-11-02\n",
+	)
+	profile, _ := LookupProfile("airtable")
+	entries, err := ParseProfileContacts(path, profile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Uid: "1730478600", FirstName: "Ann Marie", LastName: "Smith", Phones: []string{"+15105551234"}, Emails: []string{"ann@example.com"}},
+		{Uid: "1730530800", FirstName: "Bob", LastName: "Bob", Phones: []string{"+525512345678"}},
+	}
+	if diff := deep.Equal(entries, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := writeTestFile(t, "custom.yaml", `
+date: Added
+date_formats: ["2006-01-02"]
+time_zone: UTC
+full_name: Contact
+phones: [Cell, Work]
+emails: [Mail]
+`)
+	profile, err := LookupProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Name != "custom" {
+		t.Errorf("expected the profile to be named after its file, got %q", profile.Name)
+	}
+	csvPath := writeTestFile(t, "custom.csv", "Contact,Cell,Work,Mail,Added\nAnn Smith,5105551234,4155559876,ann@example.com,2024-11-01\n")
+	entries, err := ParseProfileContacts(csvPath, profile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{{
+		Uid: "1730419200", FirstName: "Ann", LastName: "Smith",
+		Phones: []string{"+15105551234", "+14155559876"}, Emails: []string{"ann@example.com"},
+	}}
+	if diff := deep.Equal(entries, expected); diff != nil {
+		t.Error(diff)
+	}
+	bad := writeTestFile(t, "bad.yaml", "emails: [Mail]\n")
+	if _, err := LookupProfile(bad); err == nil {
+		t.Errorf("expected an error for a profile without name or phone columns")
+	}
+}
+
+func TestParseIdColumnAndDuplicates(t *testing.T) {
+	path := writeTestFile(t, "ids.csv",
+		"Contact ID,Name,Phone,Created\n"+
+			"rec123,Ann Smith,510-555-1234,2024-11-01\n"+
+			",Bob Jones,510-555-9999,2024-11-01\n"+
+			"42,Cat Brown,510-555-7777,\n"+
+			"rec123,Ann Smyth,510-555-1234,\n",
+	)
+	profile := ColumnProfile{
+		Name: "ids", Id: "Contact ID", Date: "Created", DateFormats: []string{"2006-01-02"},
+		TimeZone: "UTC", FullName: "Name", Phones: []string{"Phone"},
+	}
+	entries, issues, err := ValidateProfileContacts(path, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Uid: derivedUid("rec123"), FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}},
+		{Uid: "1730419200", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105559999"}},
+		{Uid: "42", FirstName: "Cat", LastName: "Brown", Phones: []string{"+15105557777"}},
+	}
+	if diff := deep.Equal(entries, expected); diff != nil {
+		t.Error(diff)
+	}
+	if len(issues) != 1 || issues[0].Class != DuplicateUidIssue || issues[0].Row != 5 || !issues[0].Skipped {
+		t.Errorf("expected a duplicate UID issue for row 5, got %v", issues)
+	}
+}
+
+func TestParseDuplicateDates(t *testing.T) {
+	path := writeTestFile(t, "master.csv",
+		"Name,Phone Number,Creation Date\n"+
+			"Ann Smith,510-555-1234,11/1/2024 9:30am\n"+
+			"Bob Jones,510-555-9999,11/1/2024 9:30am\n",
+	)
+	profile, _ := LookupProfile("airtable")
+	entries, issues, err := ValidateProfileContacts(path, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].FirstName != "Ann" {
+		t.Errorf("expected only the first of the same-minute contacts, got %v", entries)
+	}
+	if len(issues) != 1 || issues[0].Class != DuplicateUidIssue || issues[0].Field != "Creation Date" {
+		t.Errorf("expected a duplicate UID issue on the date, got %v", issues)
+	}
+}
@@ -0,0 +1,278 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrorClass classifies a failed Dialpad request.
+type ErrorClass string
+
+const (
+	TransportError ErrorClass = "transport"
+	RateLimitError ErrorClass = "rate-limited"
+	ServerError    ErrorClass = "server"
+	ClientError    ErrorClass = "client"
+	ResponseError  ErrorClass = "bad response"
+	OtherError     ErrorClass = "other"
+)
+
+var errorClassOrder = []ErrorClass{TransportError, RateLimitError, ServerError, ClientError, ResponseError, OtherError}
+
+// A RequestError is a Dialpad request that failed, after any retries.
+//
+// StatusCode is zero if no response was received, and Attempts is zero
+// if the number of attempts isn't known.
+type RequestError struct {
+	Class      ErrorClass
+	StatusCode int
+	Attempts   int
+	Body       string
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	var msg string
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("%s error: status code: %d, body: %s", e.Class, e.StatusCode, e.Body)
+	} else {
+		msg = fmt.Sprintf("%s error: %v", e.Class, e.Err)
+	}
+	if e.Attempts > 1 {
+		msg = fmt.Sprintf("%s (after %d attempts)", msg, e.Attempts)
+	}
+	return msg
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// statusError is the error for a response with an unexpected status code.
+func statusError(resp *http.Response, body []byte) *RequestError {
+	class, _ := Classify(resp, nil)
+	if class == "" {
+		class = ClientError
+	}
+	return &RequestError{Class: class, StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// Classify returns the class of a failed request and whether it's worth retrying.
+//
+// It returns an empty class for responses that the caller should handle itself,
+// which are successes and client errors other than rate limiting.
+func Classify(resp *http.Response, err error) (class ErrorClass, retry bool) {
+	switch {
+	case err != nil:
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return TransportError, false
+		}
+		return TransportError, true
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return RateLimitError, true
+	case resp.StatusCode >= 500:
+		return ServerError, true
+	default:
+		return "", false
+	}
+}
+
+// ErrorSummary counts errors by class.
+type ErrorSummary map[ErrorClass]int
+
+// SummarizeErrors counts the given errors by class.
+//
+// Errors that don't wrap a [RequestError] are counted as [OtherError].
+func SummarizeErrors(errs []error) ErrorSummary {
+	summary := make(ErrorSummary)
+	for _, err := range errs {
+		var re *RequestError
+		if errors.As(err, &re) {
+			summary[re.Class]++
+		} else {
+			summary[OtherError]++
+		}
+	}
+	return summary
+}
+
+func (s ErrorSummary) String() string {
+	var parts []string
+	for _, class := range errorClassOrder {
+		if count := s[class]; count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count, class))
+		}
+	}
+	if len(parts) == 0 {
+		return "no errors"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// RLHTTPClient is rate-limited HTTP Client
+//
+// code taken from [this blogpost](https://medium.com/mflow/rate-limiting-in-golang-http-client-a22fba15861a)
+//
+// Requests that fail with a transport error, a rate limit, or a server error
+// are retried with exponential backoff and jitter, waiting at least as long as
+// the server asks in its Retry-After header.  Each rate-limited response halves
+// the client's rate, and each success raises it back toward its initial rate.
+type RLHTTPClient struct {
+	client      *http.Client
+	limiter     *rate.Limiter
+	ceiling     rate.Limit
+	mu          sync.Mutex
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+func NewRLHTTPClient(calls, seconds int) *RLHTTPClient {
+	limit := rate.Limit(calls) / rate.Limit(seconds)
+	return &RLHTTPClient{
+		client:      http.DefaultClient,
+		limiter:     rate.NewLimiter(limit, 1),
+		ceiling:     limit,
+		MaxAttempts: 5,
+		MinBackoff:  time.Second,
+		MaxBackoff:  time.Minute,
+	}
+}
+
+// Limit returns the client's current rate limit.
+func (c *RLHTTPClient) Limit() rate.Limit {
+	return c.limiter.Limit()
+}
+
+// Do dispatches the HTTP request to the network, retrying as needed.
+//
+// The request's context is honored both while waiting for the rate limit
+// and while backing off.  If the request fails for good, the response
+// has been closed and the returned error is a [*RequestError].
+func (c *RLHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		// This is a blocking call. Honors the rate limit
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, &RequestError{Class: TransportError, Attempts: attempt - 1, Err: err}
+		}
+		try := req
+		if attempt > 1 {
+			try = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, &RequestError{Class: TransportError, Attempts: attempt - 1, Err: err}
+				}
+				try.Body = body
+			}
+		}
+		resp, err := c.client.Do(try)
+		class, retry := Classify(resp, err)
+		if class == "" {
+			c.speedUp()
+			return resp, nil
+		}
+		var wait time.Duration
+		failure := &RequestError{Class: class, Attempts: attempt, Err: redactUrl(err)}
+		if resp != nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			failure.StatusCode, failure.Body = resp.StatusCode, string(body)
+			wait = RetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		if class == RateLimitError {
+			c.slowDown()
+		}
+		if !retry || attempt >= c.MaxAttempts {
+			return nil, failure
+		}
+		if backoff := c.backoff(attempt); backoff > wait {
+			wait = backoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			failure.Err = ctx.Err()
+			return nil, failure
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a jittered exponential delay before the given retry:
+// somewhere between half and all of MinBackoff doubled once per prior attempt,
+// but never more than MaxBackoff.
+func (c *RLHTTPClient) backoff(attempt int) time.Duration {
+	delay := c.MaxBackoff
+	if attempt < 32 {
+		delay = min(c.MinBackoff<<(attempt-1), c.MaxBackoff)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// slowDown halves the client's rate, down to a sixteenth of its initial rate.
+func (c *RLHTTPClient) slowDown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limiter.SetLimit(max(c.limiter.Limit()/2, c.ceiling/16))
+}
+
+// speedUp raises the client's rate by a tenth, up to its initial rate.
+func (c *RLHTTPClient) speedUp() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if limit := c.limiter.Limit(); limit < c.ceiling {
+		c.limiter.SetLimit(min(limit*1.1, c.ceiling))
+	}
+}
+
+// RetryAfter parses the value of a Retry-After header, which is either
+// a number of seconds or an HTTP date.  It returns zero if there's no
+// usable value.
+func RetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(when.Sub(now), 0)
+	}
+	return 0
+}
+
+// redactUrl removes the query (which holds the API key) from the URL of a transport error.
+func redactUrl(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		if u, perr := url.Parse(ue.URL); perr == nil {
+			u.RawQuery = ""
+			return &url.Error{Op: ue.Op, URL: u.String(), Err: ue.Err}
+		}
+	}
+	return err
+}
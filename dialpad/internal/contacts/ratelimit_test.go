@@ -0,0 +1,157 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testClient() *RLHTTPClient {
+	c := NewRLHTTPClient(1000, 1)
+	c.MaxAttempts = 3
+	c.MinBackoff = time.Millisecond
+	c.MaxBackoff = 4 * time.Millisecond
+	return c
+}
+
+func TestRLHTTPClientRetries(t *testing.T) {
+	statuses := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}
+	var calls int
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		status := statuses[calls]
+		calls++
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	c := testClient()
+	req, _ := http.NewRequest("PUT", server.URL, strings.NewReader("payload"))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Errorf("expected success on third call, got %d on call %d", resp.StatusCode, calls)
+	}
+	for i, body := range bodies {
+		if body != "payload" {
+			t.Errorf("call %d: body was %q", i+1, body)
+		}
+	}
+	if c.Limit() >= c.ceiling {
+		t.Errorf("expected rate to be lowered after a 429, got %v", c.Limit())
+	}
+}
+
+func TestRLHTTPClientGivesUp(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("down"))
+	}))
+	defer server.Close()
+	c := testClient()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	_, err := c.Do(req)
+	var re *RequestError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected a request error, got %v", err)
+	}
+	if re.Class != ServerError || re.StatusCode != http.StatusBadGateway || re.Attempts != 3 || re.Body != "down" {
+		t.Errorf("unexpected error: %#v", re)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestRLHTTPClientNoRetry(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	c := testClient()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || calls != 1 {
+		t.Errorf("expected one call returning 400, got %d after %d calls", resp.StatusCode, calls)
+	}
+}
+
+func TestRLHTTPClientCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	c := testClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	start := time.Now()
+	_, err := c.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("cancellation did not interrupt the Retry-After wait")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-90 * time.Second).Format(http.TimeFormat), 0},
+	}
+	for _, tc := range tests {
+		if got := RetryAfter(tc.value, now); got != tc.expected {
+			t.Errorf("RetryAfter(%q) = %v, expected %v", tc.value, got, tc.expected)
+		}
+	}
+}
+
+func TestSummarizeErrors(t *testing.T) {
+	errs := []error{
+		fmt.Errorf("contact id: 1, %w", &RequestError{Class: RateLimitError, StatusCode: 429}),
+		fmt.Errorf("contact id: 2, %w", &RequestError{Class: RateLimitError, StatusCode: 429}),
+		&RequestError{Class: ServerError, StatusCode: 500},
+		errors.New("no contact ID"),
+	}
+	expected := "2 rate-limited, 1 server, 1 other"
+	if got := SummarizeErrors(errs).String(); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
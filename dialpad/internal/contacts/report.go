@@ -0,0 +1,281 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// IssueClass classifies a problem found in a contacts spreadsheet.
+type IssueClass string
+
+const (
+	MissingDateIssue    IssueClass = "missing date"
+	InvalidDateIssue    IssueClass = "invalid date"
+	MissingNameIssue    IssueClass = "missing name"
+	TooShortIssue       IssueClass = "too short"
+	TooLongIssue        IssueClass = "too long"
+	UnknownCountryIssue IssueClass = "unknown country code"
+	BadPrefixIssue      IssueClass = "bad prefix"
+	NonGeographicIssue  IssueClass = "non-geographic area code"
+	InvalidPhoneIssue   IssueClass = "invalid phone"
+	NoValidPhoneIssue   IssueClass = "no valid phone"
+	InvalidEmailIssue   IssueClass = "invalid email"
+	DuplicateUidIssue   IssueClass = "duplicate uid"
+)
+
+var (
+	ReportColumnNames = []string{"Row", "Field", "Value", "Class", "Message", "Fix", "Skipped"}
+	// emailDomainFixes are common misspellings of email domains.
+	emailDomainFixes = map[string]string{
+		"gmial.com":   "gmail.com",
+		"gmai.com":    "gmail.com",
+		"gamil.com":   "gmail.com",
+		"gmail.co":    "gmail.com",
+		"gmail.con":   "gmail.com",
+		"gmail":       "gmail.com",
+		"hotmial.com": "hotmail.com",
+		"hotmail.co":  "hotmail.com",
+		"hotmail":     "hotmail.com",
+		"yahooo.com":  "yahoo.com",
+		"yaho.com":    "yahoo.com",
+		"yahoo.co":    "yahoo.com",
+		"yahoo":       "yahoo.com",
+		"outlok.com":  "outlook.com",
+		"outlook":     "outlook.com",
+		"icloud.co":   "icloud.com",
+		"icloud":      "icloud.com",
+	}
+)
+
+// A ValidationIssue is a problem with one value in a contacts spreadsheet.
+//
+// Row is the spreadsheet row (counting the header as row 1), Field is the
+// header of the value's column, and Value is the value as it appears there.
+// Fix is a suggested replacement for the value, if one can be derived.
+// Skipped tells whether the issue kept the row from being uploaded.
+type ValidationIssue struct {
+	Row     int        `json:"row"`
+	Field   string     `json:"field"`
+	Value   string     `json:"value"`
+	Class   IssueClass `json:"class"`
+	Message string     `json:"message"`
+	Fix     string     `json:"fix,omitempty"`
+	Skipped bool       `json:"skipped"`
+	column  int
+}
+
+// phoneIssue returns the issue for an invalid phone number.
+func phoneIssue(row int, field string, column int, value string, err error) ValidationIssue {
+	class := InvalidPhoneIssue
+	switch {
+	case errors.Is(err, TooFewDigits):
+		class = TooShortIssue
+	case errors.Is(err, TooManyDigits):
+		class = TooLongIssue
+	case errors.Is(err, UnknownCountryCode):
+		class = UnknownCountryIssue
+	case errors.Is(err, InvalidPrefix):
+		class = BadPrefixIssue
+	case errors.Is(err, NonGeographicAreaCode):
+		class = NonGeographicIssue
+	}
+	issue := ValidationIssue{Row: row, Field: field, column: column, Value: value, Class: class, Message: err.Error()}
+	issue.Fix = SuggestPhoneFix(value)
+	return issue
+}
+
+// emailIssue returns the issue for an invalid email.
+func emailIssue(row int, field string, column int, value string, err error) ValidationIssue {
+	issue := ValidationIssue{Row: row, Field: field, column: column, Value: value, Class: InvalidEmailIssue, Message: err.Error()}
+	issue.Fix = SuggestEmailFix(value)
+	return issue
+}
+
+// SuggestPhoneFix suggests a valid replacement for an invalid phone number,
+// or returns "" if there is none.
+//
+// The only fix it knows is for international numbers that were entered
+// without their leading '+', and so were taken to be North American
+// numbers with an invalid prefix.
+func SuggestPhoneFix(phone string) string {
+	if _, err := CanonicalizePhoneNumber(phone); !errors.Is(err, InvalidPrefix) {
+		return ""
+	}
+	if strings.HasPrefix(strings.TrimSpace(phone), "+") {
+		return ""
+	}
+	fixed, err := CanonicalizePhoneNumber("+" + nonDigitsOnly.ReplaceAllString(phone, ""))
+	if err != nil {
+		return ""
+	}
+	return fixed
+}
+
+// SuggestEmailFix suggests a valid replacement for an invalid email,
+// or returns "" if there is none.
+//
+// It removes stray spaces, replaces commas in the domain with periods,
+// removes a trailing period, and corrects common misspellings of domains.
+func SuggestEmailFix(email string) string {
+	fixed := strings.Join(strings.Fields(email), "")
+	fixed = strings.TrimRight(fixed, ".")
+	local, domain, found := strings.Cut(fixed, "@")
+	if !found || local == "" {
+		return ""
+	}
+	domain = strings.ToLower(strings.ReplaceAll(strings.TrimLeft(domain, "@"), ",", "."))
+	if correct, ok := emailDomainFixes[domain]; ok {
+		domain = correct
+	}
+	fixed, err := CanonicalizeEmail(local + "@" + domain)
+	if err != nil || fixed == email {
+		return ""
+	}
+	return fixed
+}
+
+// ValidateProfileContacts reads a contacts spreadsheet whose columns are described
+// by the profile, and returns both the valid contacts and the issues found.
+//
+// If the path has a vCard extension, the contacts are read with [ParseVCards],
+// and no issues are returned.
+func ValidateProfileContacts(path string, profile ColumnProfile) ([]Entry, []ValidationIssue, error) {
+	if IsVCardPath(path) {
+		entries, err := ParseVCards(path, false)
+		return entries, nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	reader := storage.BOMAwareCSVReader(f)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, err := profile.mapColumns(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, issues := parseRecords(reader, columns)
+	return entries, issues, nil
+}
+
+// LogValidationIssues logs the issues with invalid dates, names, and phones.
+// Invalid emails are left out, since the contacts are uploaded anyway,
+// as are rows that are simply missing a date, a name, or phones.
+func LogValidationIssues(issues []ValidationIssue) {
+	for _, issue := range issues {
+		switch {
+		case issue.Class == InvalidEmailIssue, issue.Class == MissingDateIssue, issue.Class == NoValidPhoneIssue:
+			continue
+		case issue.Class == MissingNameIssue && issue.Value == "":
+			continue
+		}
+		action := "Ignoring value"
+		if issue.Skipped {
+			action = "Skipping row"
+		}
+		msg := fmt.Sprintf("%s %d (%s %q): %s: %s", action, issue.Row, issue.Field, issue.Value, issue.Class, issue.Message)
+		if issue.Fix != "" {
+			msg += fmt.Sprintf(" (suggest %q)", issue.Fix)
+		}
+		log.Print(msg)
+	}
+}
+
+// ExportValidationReport writes the issues to the given path, as JSON if the
+// path has a ".json" extension and as CSV otherwise.
+func ExportValidationReport(issues []ValidationIssue, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		if issues == nil {
+			issues = []ValidationIssue{}
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(issues)
+	}
+	writer := csv.NewWriter(f)
+	defer writer.Flush()
+	if err = writer.Write(ReportColumnNames); err != nil {
+		log.Panicf("error writing record to csv: %v", err)
+	}
+	for _, issue := range issues {
+		record := []string{
+			strconv.Itoa(issue.Row), issue.Field, issue.Value, string(issue.Class),
+			issue.Message, issue.Fix, strconv.FormatBool(issue.Skipped),
+		}
+		if err = writer.Write(record); err != nil {
+			log.Panicf("error writing record to csv: %v", err)
+		}
+	}
+	return nil
+}
+
+// ApplyFixes copies the spreadsheet at path to fixedPath, replacing each
+// value that has an issue with a suggested fix.  It returns the number of
+// values that were fixed.
+func ApplyFixes(path string, issues []ValidationIssue, fixedPath string) (int, error) {
+	fixes := make(map[int][]ValidationIssue)
+	for _, issue := range issues {
+		if issue.Fix != "" {
+			fixes[issue.Row] = append(fixes[issue.Row], issue)
+		}
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.Create(fixedPath)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	reader := storage.BOMAwareCSVReader(in)
+	reader.FieldsPerRecord = -1
+	writer := csv.NewWriter(out)
+	defer writer.Flush()
+	count := 0
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return count, fmt.Errorf("row %d: %v", row, err)
+		}
+		for _, issue := range fixes[row] {
+			if issue.column < len(record) && strings.Contains(record[issue.column], issue.Value) {
+				record[issue.column] = strings.Replace(record[issue.column], issue.Value, issue.Fix, 1)
+				count++
+			}
+		}
+		if err = writer.Write(record); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestSuggestFixes(t *testing.T) {
+	phones := map[string]string{
+		"49 30 123456":    "+4930123456",
+		"510-555-123":     "",
+		"+1 510 123 4567": "",
+		"+49 30 123456":   "",
+		"(500) 555-1234":  "",
+	}
+	for phone, expected := range phones {
+		if fix := SuggestPhoneFix(phone); fix != expected {
+			t.Errorf("SuggestPhoneFix(%q) = %q, expected %q", phone, fix, expected)
+		}
+	}
+	emails := map[string]string{
+		"bob@@gmail.com.": "bob@gmail.com",
+		"bob@gmial,com.":  "bob@gmail.com",
+		"bob@yahoo.":      "bob@yahoo.com",
+		"@example.com":    "",
+		"no-at-sign":      "",
+	}
+	for email, expected := range emails {
+		if fix := SuggestEmailFix(email); fix != expected {
+			t.Errorf("SuggestEmailFix(%q) = %q, expected %q", email, fix, expected)
+		}
+	}
+}
+
+func TestValidationReport(t *testing.T) {
+	path := writeTestFile(t, "contacts.csv",
+		"Creation Date,First_Name,Last_Name,Phones,Email\n"+
+			"11/01/2024 09:30:00 AM,Ann,Smith,49 30 123456,ann@@example.com\n"+
+			"11/01/2024 09:31:00 AM,Bob,Jones,510-555-1234;(500) 555-1234,\n"+
+			"11/01/2024 09:32:00 AM,,,510-555-4321,\n"+
+			"yesterday,Cat,Brown,510-555-1111,\n"+
+			",,,,\n",
+	)
+	entries, issues, err := ValidateProfileContacts(path, DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].FirstName != "Bob" {
+		t.Fatalf("expected only Bob to be valid, got %v", entries)
+	}
+	type summary struct {
+		Row     int
+		Field   string
+		Class   IssueClass
+		Fix     string
+		Skipped bool
+	}
+	var got []summary
+	for _, issue := range issues {
+		got = append(got, summary{issue.Row, issue.Field, issue.Class, issue.Fix, issue.Skipped})
+	}
+	expected := []summary{
+		{2, "Phones", BadPrefixIssue, "+4930123456", true},
+		{3, "Phones", NonGeographicIssue, "", false},
+		{4, "First_Name", MissingNameIssue, "", true},
+		{5, "Creation Date", InvalidDateIssue, "", true},
+	}
+	if diff := deep.Equal(got, expected); diff != nil {
+		t.Error(diff)
+	}
+
+	jsonPath := filepath.Join(t.TempDir(), "report.json")
+	if err = ExportValidationReport(issues, jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []ValidationIssue
+	if err = json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(issues) || decoded[0].Value != "49 30 123456" {
+		t.Errorf("unexpected JSON report: %s", bytes)
+	}
+
+	fixedPath := filepath.Join(t.TempDir(), "contacts.fixed.csv")
+	count, err := ApplyFixes(path, issues, fixedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 fix, got %d", count)
+	}
+	entries, err = ParseContacts(fixedPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Phones[0] != "+4930123456" {
+		t.Errorf("unexpected entries after fixes: %v", entries)
+	}
+}
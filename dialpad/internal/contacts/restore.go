@@ -0,0 +1,44 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"slices"
+)
+
+// PlanRestore compares a snapshot with the current contacts, and returns the
+// snapshot contacts that have been deleted since (to be recreated) and those
+// that have been changed since (to be reverted).
+//
+// If only is non-empty, just the contacts with those UIDs are considered.
+// Contacts created since the snapshot are never touched.
+func PlanRestore(snapshot, current []Entry, only []string) (recreate, revert []Entry) {
+	byUid := make(map[string]Entry, len(current))
+	for _, e := range current {
+		byUid[e.Uid] = e
+	}
+	for _, e := range snapshot {
+		if len(only) > 0 && !slices.Contains(only, e.Uid) {
+			continue
+		}
+		if c, ok := byUid[e.Uid]; !ok {
+			recreate = append(recreate, e)
+		} else if ContentHash(c) != ContentHash(e) {
+			revert = append(revert, e)
+		}
+	}
+	return
+}
+
+// RestoreContacts recreates or reverts the given snapshot contacts.
+func RestoreContacts(entries []Entry) []error {
+	uploads := make([]Entry, len(entries))
+	for i, e := range entries {
+		uploads[i] = uploadable(e)
+	}
+	return UpdateContacts(uploads)
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestPlanRestore(t *testing.T) {
+	snapshot := []Entry{
+		{Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}},
+		{Uid: "2", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105550000"}},
+		{Uid: "3", FirstName: "Cal", LastName: "Brown", Phones: []string{"+15105557777"}},
+	}
+	current := []Entry{
+		{FullId: "a_uid_1", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}},
+		{FullId: "a_uid_3", Uid: "3", FirstName: "Cal", LastName: "Browne", Phones: []string{"+15105557777"}},
+		{FullId: "a_uid_4", Uid: "4", FirstName: "Dee", LastName: "White"},
+	}
+	recreate, revert := PlanRestore(snapshot, current, nil)
+	if diff := deep.Equal(recreate, []Entry{snapshot[1]}); diff != nil {
+		t.Errorf("recreate: %v", diff)
+	}
+	if diff := deep.Equal(revert, []Entry{snapshot[2]}); diff != nil {
+		t.Errorf("revert: %v", diff)
+	}
+	recreate, revert = PlanRestore(snapshot, current, []string{"3"})
+	if len(recreate) != 0 || len(revert) != 1 {
+		t.Errorf("expected only the reverted contact, got %v and %v", recreate, revert)
+	}
+}
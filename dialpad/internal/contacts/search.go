@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// The scores contributed by each kind of match between a search query and
+// an entry.  Only the best name match and the best phone match count.
+var (
+	NamePrefixScore     = 100
+	WordPrefixScore     = 80
+	NameSubstringScore  = 50
+	PhonePrefixScore    = 70
+	PhoneSubstringScore = 60
+)
+
+// The boosts given to entries that were in touch recently, by how long ago.
+var RecencyBoosts = []struct {
+	Within time.Duration
+	Boost  int
+}{
+	{7 * 24 * time.Hour, 30},
+	{30 * 24 * time.Hour, 20},
+	{90 * 24 * time.Hour, 10},
+}
+
+// MinPhoneQueryDigits is the fewest digits a query must have to match phones.
+var MinPhoneQueryDigits = 3
+
+// A RankedEntry is a search result: an entry with its score
+// and the time of its last interaction (in UnixMicro), if known.
+type RankedEntry struct {
+	SearchEntry
+	Score       int   `json:"score"`
+	LastContact int64 `json:"last_contact,omitempty"`
+}
+
+// RankSearchEntries returns the entries that match the query, best first.
+//
+// Names match if the query is a prefix of the whole name, a prefix of one
+// of its words, or a substring of it, ignoring case and accents.  Phones
+// match if the query's digits (there must be at least [MinPhoneQueryDigits])
+// start the national number or appear anywhere in the phone.  Entries with
+// a recent interaction (according to lastContact, which maps phones to times
+// in UnixMicro) are boosted by [RecencyBoosts].  An empty query matches
+// every entry, so they are ranked by recency alone.
+func RankSearchEntries(query string, entries []SearchEntry, lastContact map[string]int64, now time.Time) []RankedEntry {
+	name := NormalizeName(query)
+	digits := nonDigitsOnly.ReplaceAllString(query, "")
+	if len(digits) < MinPhoneQueryDigits {
+		digits = ""
+	}
+	var results []RankedEntry
+	for _, entry := range entries {
+		score := 0
+		if name != "" {
+			score = nameMatchScore(name, entry.normalizedName())
+			score += phoneMatchScore(digits, entry.Phone)
+			if score == 0 {
+				continue
+			}
+		}
+		last := lastContact[entry.Phone]
+		if last != 0 {
+			age := now.Sub(time.UnixMicro(last))
+			for _, r := range RecencyBoosts {
+				if age < r.Within {
+					score += r.Boost
+					break
+				}
+			}
+		}
+		results = append(results, RankedEntry{SearchEntry: entry, Score: score, LastContact: last})
+	}
+	slices.SortStableFunc(results, func(a, b RankedEntry) int {
+		if a.Score != b.Score {
+			return b.Score - a.Score
+		}
+		if a.LastContact != b.LastContact {
+			if a.LastContact > b.LastContact {
+				return -1
+			}
+			return 1
+		}
+		return SearchEntryCompare(a.SearchEntry, b.SearchEntry)
+	})
+	return results
+}
+
+// PageSearchEntries returns the given page of ranked entries.
+func PageSearchEntries(entries []RankedEntry, offset, limit int) []RankedEntry {
+	if offset >= len(entries) {
+		return []RankedEntry{}
+	}
+	return entries[offset:min(offset+limit, len(entries))]
+}
+
+func nameMatchScore(query, name string) int {
+	switch {
+	case strings.HasPrefix(name, query):
+		return NamePrefixScore
+	case strings.Contains(name, " "+query):
+		return WordPrefixScore
+	case strings.Contains(name, query):
+		return NameSubstringScore
+	}
+	return 0
+}
+
+func phoneMatchScore(digits, phone string) int {
+	if digits == "" {
+		return 0
+	}
+	national := strings.TrimPrefix(phone, "+")
+	if strings.HasPrefix(national, "1") && len(national) == 11 {
+		national = national[1:]
+	}
+	switch {
+	case strings.HasPrefix(national, digits):
+		return PhonePrefixScore
+	case strings.Contains(phone, digits):
+		return PhoneSubstringScore
+	}
+	return 0
+}
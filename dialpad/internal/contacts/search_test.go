@@ -0,0 +1,75 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRankSearchEntries(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	entries := []SearchEntry{
+		{FullName: "Ann Smith", Phone: "+15105551234"},
+		{FullName: "Joann Lee", Phone: "+14155550510"},
+		{FullName: "Pat Annan", Phone: "+14155559876"},
+		{FullName: "José Ángel", Phone: "+442079460958"},
+		{FullName: UnknownName, Phone: "+15105550000"},
+	}
+	lastContact := map[string]int64{
+		"+14155559876": now.Add(-24 * time.Hour).UnixMicro(),
+		"+15105551234": now.Add(-365 * 24 * time.Hour).UnixMicro(),
+	}
+	names := func(results []RankedEntry) (names []string) {
+		for _, r := range results {
+			names = append(names, r.FullName)
+		}
+		return
+	}
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		// a recent word prefix, then an old whole-name prefix, then a substring
+		{"ann", []string{"Pat Annan", "Ann Smith", "Joann Lee"}},
+		{"angel", []string{"José Ángel"}},
+		// national number prefix beats a substring elsewhere in the phone
+		{"510", []string{"Ann Smith", UnknownName, "Joann Lee"}},
+		{"(510) 555-12", []string{"Ann Smith"}},
+		// too few digits to match phones
+		{"51", nil},
+		// an empty query ranks everything by recency
+		{"", []string{"Pat Annan", "Ann Smith", "Joann Lee", "José Ángel", UnknownName}},
+	}
+	for _, test := range tests {
+		results := RankSearchEntries(test.query, entries, lastContact, now)
+		got := names(results)
+		if len(got) != len(test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.query, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%q: expected %v, got %v", test.query, test.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestPageSearchEntries(t *testing.T) {
+	ranked := make([]RankedEntry, 5)
+	if page := PageSearchEntries(ranked, 0, 2); len(page) != 2 {
+		t.Errorf("first page has %d entries", len(page))
+	}
+	if page := PageSearchEntries(ranked, 4, 2); len(page) != 1 {
+		t.Errorf("last page has %d entries", len(page))
+	}
+	if page := PageSearchEntries(ranked, 6, 2); page == nil || len(page) != 0 {
+		t.Errorf("page past the end is %v", page)
+	}
+}
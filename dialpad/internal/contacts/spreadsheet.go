@@ -8,10 +8,13 @@ package contacts
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	"filippo.io/age"
@@ -19,30 +22,51 @@ import (
 	"github.com/schollz/progressbar/v3"
 
 	"github.com/clickonetwo/automations/dialpad/internal/storage"
+	"github.com/clickonetwo/automations/phonenum"
 )
 
 var (
-	ImportColumnNames  = []string{"Creation Date", "First_Name", "Last_Name", "Phones", "Email"}
-	ExportColumnNames  = []string{"Dialpad UID", "Creation Stamp", "First Name", "Last Name", "Phones", "Emails"}
-	AnomalyColumnNames = []string{"Creation Stamp", "First Name Diff", "Last Name Diff", "Phones Diff", "Emails Diff"}
-	UidColumnNames     = []string{"Left ID", "Right ID", "Primary Phone", "First Name", "Last Name"}
+	ImportColumnNames     = []string{"Creation Date", "First_Name", "Last_Name", "Phones", "Email"}
+	ExportColumnNames     = append(LegacyExportColumnNames, "Company", "Job Title", "URLs", "Extension", "Owner ID", "Type")
+	AnomalyColumnNames    = []string{"Creation Stamp", "First Name Diff", "Last Name Diff", "Phones Diff", "Emails Diff", "Other Diffs"}
+	UidColumnNames        = []string{"Left ID", "Right ID", "Primary Phone", "First Name", "Last Name"}
+	ConflictColumnNames   = []string{"Left ID", "Right ID", "Primary Phone", "Left Name", "Right Name"}
+	DuplicateColumnNames  = append([]string{"Group", "Score", "Keep"}, ExportColumnNames...)
+	BulkResultColumnNames = append([]string{"Action", "Status", "Error"}, ExportColumnNames...)
 )
 
+// LegacyExportColumnNames are the columns of spreadsheets exported before
+// entries had the full Dialpad schema.  They are still accepted on import.
+var LegacyExportColumnNames = []string{"Dialpad UID", "Creation Stamp", "First Name", "Last Name", "Phones", "Emails"}
+
+// ParseContacts reads a spreadsheet of contacts to be uploaded, and returns
+// the valid ones.  If the path has a vCard extension, it's read with [ParseVCards].
 func ParseContacts(path string, showErrors bool) ([]Entry, error) {
-	f, err := os.Open(path)
+	return ParseProfileContacts(path, DefaultProfile, showErrors)
+}
+
+// ParseProfileContacts is [ParseContacts] for a spreadsheet whose columns
+// are described by the given profile.
+func ParseProfileContacts(path string, profile ColumnProfile, showErrors bool) ([]Entry, error) {
+	if IsVCardPath(path) {
+		return ParseVCards(path, showErrors)
+	}
+	entries, issues, err := ValidateProfileContacts(path, profile)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	reader := storage.BOMAwareCSVReader(f)
-	record, err := reader.Read()
-	if diff := deep.Equal(record, ImportColumnNames); diff != nil {
-		return nil, fmt.Errorf("unexpected column names: %v", record)
+	if showErrors {
+		LogValidationIssues(issues)
 	}
-	return parseRecords(reader, showErrors), nil
+	return entries, nil
 }
 
+// ImportContacts reads a spreadsheet of Dialpad contacts in the format written
+// by [ExportContacts].  If the path has a vCard extension, it's read with [ImportVCards].
 func ImportContacts(path string) ([]Entry, error) {
+	if IsVCardPath(path) {
+		return ImportVCards(path)
+	}
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -50,8 +74,11 @@ func ImportContacts(path string) ([]Entry, error) {
 	defer f.Close()
 	reader := storage.BOMAwareCSVReader(f)
 	record, err := reader.Read()
-	if diff := deep.Equal(record, ExportColumnNames); diff != nil {
-		return nil, fmt.Errorf("unexpected column names: %v", record)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkExportColumns(record, nil); err != nil {
+		return nil, err
 	}
 	return loadRecords(reader)
 }
@@ -72,13 +99,21 @@ func ImportEncryptedContacts(path string) ([]Entry, error) {
 	}
 	reader := storage.BOMAwareCSVReader(df)
 	record, err := reader.Read()
-	if diff := deep.Equal(record, ExportColumnNames); diff != nil {
-		return nil, fmt.Errorf("unexpected column names: %v", record)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkExportColumns(record, nil); err != nil {
+		return nil, err
 	}
 	return loadRecords(reader)
 }
 
+// ExportContacts writes a spreadsheet of contacts.  If the path has
+// a vCard extension, the contacts are written with [ExportVCards].
 func ExportContacts(entries []Entry, path string) error {
+	if IsVCardPath(path) {
+		return ExportVCards(entries, path)
+	}
 	f, err := os.Create(path)
 	if err != nil {
 		return err
@@ -90,15 +125,37 @@ func ExportContacts(entries []Entry, path string) error {
 		log.Panicf("error writing record to csv: %v", err)
 	}
 	for _, entry := range entries {
-		phones := strings.Join(entry.Phones, ";")
-		emails := strings.Join(entry.Emails, ";")
-		if err = writer.Write([]string{entry.FullId, entry.Uid, entry.FirstName, entry.LastName, phones, emails}); err != nil {
+		if err = writer.Write(entryRecord(entry)); err != nil {
 			log.Panicf("error writing record to csv: %v", err)
 		}
 	}
 	return nil
 }
 
+// entryRecord returns the export spreadsheet columns for an entry.
+func entryRecord(entry Entry) []string {
+	phones := strings.Join(phoneCells(entry), ";")
+	emails := strings.Join(entry.Emails, ";")
+	urls := strings.Join(entry.Urls, ";")
+	return []string{
+		entry.FullId, entry.Uid, entry.FirstName, entry.LastName, phones, emails,
+		entry.CompanyName, entry.JobTitle, urls, entry.Extension, entry.Owner, entry.Type,
+	}
+}
+
+// checkExportColumns checks that the header row of a spreadsheet is the
+// given prefix followed by the export columns, either the current ones
+// or the legacy ones.  (The csv reader makes sure that every other row
+// has as many columns as the header.)
+func checkExportColumns(record, prefix []string) error {
+	for _, columns := range [][]string{ExportColumnNames, LegacyExportColumnNames} {
+		if deep.Equal(record, append(slices.Clone(prefix), columns...)) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected column names: %v", record)
+}
+
 func ExportUIDs(entries [][]string, path string) error {
 	f, err := os.Create(path)
 	if err != nil {
@@ -118,6 +175,136 @@ func ExportUIDs(entries [][]string, path string) error {
 	return nil
 }
 
+func ExportConflicts(conflicts [][]string, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	defer writer.Flush()
+	if err = writer.Write(ConflictColumnNames); err != nil {
+		log.Panicf("error writing record to csv: %v", err)
+	}
+	for _, conflict := range conflicts {
+		if err = writer.Write(conflict); err != nil {
+			log.Panicf("error writing record to csv: %v", err)
+		}
+	}
+	return nil
+}
+
+// ExportDuplicates writes a review spreadsheet of duplicate groups.
+//
+// Each group starts with a "yes" row holding its proposed survivor,
+// followed by "no" rows for the other members, which would be merged
+// into the survivor and then deleted.
+func ExportDuplicates(groups []DuplicateGroup, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	defer writer.Flush()
+	if err = writer.Write(DuplicateColumnNames); err != nil {
+		log.Panicf("error writing record to csv: %v", err)
+	}
+	for i, group := range groups {
+		prefix := []string{strconv.Itoa(i + 1), strconv.Itoa(group.Score)}
+		if err = writer.Write(append(prefix, append([]string{"yes"}, entryRecord(group.Survivor)...)...)); err != nil {
+			log.Panicf("error writing record to csv: %v", err)
+		}
+		for _, member := range group.Members {
+			if member.FullId == group.Survivor.FullId {
+				continue
+			}
+			if err = writer.Write(append(prefix, append([]string{"no"}, entryRecord(member)...)...)); err != nil {
+				log.Panicf("error writing record to csv: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ExportBulkResults writes a spreadsheet of the results of a bulk write.
+//
+// Each row holds the action, status, and error (if any) of one contact,
+// followed by the contact itself, so that the failed rows can be resubmitted.
+func ExportBulkResults(results []BulkResult, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	defer writer.Flush()
+	if err = writer.Write(BulkResultColumnNames); err != nil {
+		log.Panicf("error writing record to csv: %v", err)
+	}
+	for _, result := range results {
+		var status, msg string
+		if result.Status != 0 {
+			status = strconv.Itoa(result.Status)
+		}
+		if result.Err != nil {
+			msg = result.Err.Error()
+		}
+		prefix := []string{string(result.Action), status, msg}
+		if err = writer.Write(append(prefix, entryRecord(result.Entry)...)); err != nil {
+			log.Panicf("error writing record to csv: %v", err)
+		}
+	}
+	return nil
+}
+
+// ImportBulkResults reads a spreadsheet in the format written by [ExportBulkResults].
+func ImportBulkResults(path string) ([]BulkResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := storage.BOMAwareCSVReader(f)
+	record, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkExportColumns(record, BulkResultColumnNames[:3]); err != nil {
+		return nil, err
+	}
+	width := len(record)
+	var results []BulkResult
+	for row := 2; ; row++ {
+		record, err = reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		if len(record) != width {
+			return nil, fmt.Errorf("row %d: expected %d fields, got %d", row, width, len(record))
+		}
+		result := BulkResult{Action: BulkAction(record[0])}
+		if result.Action != BulkUpdate && result.Action != BulkDelete {
+			return nil, fmt.Errorf("row %d: unknown action %q", row, record[0])
+		}
+		if record[1] != "" {
+			if result.Status, err = strconv.Atoi(record[1]); err != nil {
+				return nil, fmt.Errorf("row %d: invalid status %q", row, record[1])
+			}
+		}
+		if record[2] != "" {
+			result.Err = errors.New(record[2])
+		}
+		result.Entry = recordEntry(record[3:])
+		result.Entry.Phones, result.Entry.Emails = nonBlank(result.Entry.Phones), nonBlank(result.Entry.Emails)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 func ExportAnomalies(anomalies []Anomaly, path string) error {
 	f, err := os.Create(path)
 	if err != nil {
@@ -131,7 +318,7 @@ func ExportAnomalies(anomalies []Anomaly, path string) error {
 	}
 	for _, anomaly := range anomalies {
 		var fd, ld string
-		var pd, ed []string
+		var pd, ed, od []string
 		for _, d := range anomaly.Diff {
 			if strings.HasPrefix(d, "FirstName: ") {
 				fd = d[len("FirstName: "):]
@@ -142,22 +329,26 @@ func ExportAnomalies(anomalies []Anomaly, path string) error {
 			} else if strings.HasPrefix(d, "Emails.slice") {
 				ed = append(ed, d[len("Emails.slice"):])
 			} else {
-				log.Panicf("Diff entry not understood: %v", d)
+				od = append(od, d)
 			}
 		}
 		phones := strings.Join(pd, ";")
 		emails := strings.Join(ed, ";")
-		if err = writer.Write([]string{anomaly.Uid, fd, ld, phones, emails}); err != nil {
+		others := strings.Join(od, ";")
+		if err = writer.Write([]string{anomaly.Uid, fd, ld, phones, emails, others}); err != nil {
 			log.Panicf("error writing record to csv: %v", err)
 		}
 	}
 	return nil
 }
 
-func parseRecords(reader *csv.Reader, showErrors bool) []Entry {
-	var result []Entry
-	var errs []error
+// parseRecords reads the contacts in the records, and returns the valid ones
+// along with the issues found in the invalid ones.  Entirely blank rows,
+// and rows with a blank date (when there's a date column), are skipped quietly.
+// Rows whose UID is the same as an earlier row's are skipped as duplicates.
+func parseRecords(reader *csv.Reader, columns *columnMap) (result []Entry, issues []ValidationIssue) {
 	var row = 1
+	seen := make(map[string]int)
 	bar := progressbar.Default(-1, "Validating entries")
 	defer bar.Close()
 	for {
@@ -169,56 +360,84 @@ func parseRecords(reader *csv.Reader, showErrors bool) []Entry {
 		} else if err != nil {
 			log.Panicf("error reading record from csv: %v", err)
 		}
-		if len(record) != len(ImportColumnNames) {
-			if showErrors {
-				log.Printf("Skipping row %d: too few fields (%d)", row, len(record))
-			}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
 			continue
 		}
-		var entry Entry
-		if entry.Uid, err = ParseDate(record[0]); err != nil {
-			if showErrors {
-				log.Printf("Skipping row %d: invalid date: %v", row, err)
+		issue := func(column int, class IssueClass, value string, msg string) ValidationIssue {
+			return ValidationIssue{
+				Row: row, Field: columns.field(column), column: column,
+				Value: value, Class: class, Message: msg, Skipped: true,
 			}
-			continue
 		}
-		if entry.Uid == "" {
-			// silently skip blanks
-			continue
-		}
-		if entry.FirstName, entry.LastName, err = ParseNames(record[1], record[2]); err != nil {
-			if showErrors {
-				log.Printf("Skipping row %d: invalid name: %v", row, err)
+		var entry Entry
+		uidColumn := columns.id
+		if entry.Uid = columns.sourceUid(record); entry.Uid == "" && columns.date >= 0 {
+			uidColumn = columns.date
+			if entry.Uid, err = columns.uid(record); err != nil {
+				issues = append(issues, issue(columns.date, InvalidDateIssue, cell(record, columns.date), err.Error()))
+				continue
+			}
+			if entry.Uid == "" {
+				issues = append(issues, issue(columns.date, MissingDateIssue, "", "no creation date"))
+				continue
 			}
+		}
+		first, last := columns.names(record)
+		if entry.FirstName, entry.LastName, err = ParseNames(first, last); err != nil {
+			column, value := columns.nameColumn(record)
+			issues = append(issues, issue(column, MissingNameIssue, value, err.Error()))
 			continue
 		}
 		if entry.FirstName == "" && entry.LastName == "" {
-			// silently skip blanks
+			column, _ := columns.nameColumn(record)
+			issues = append(issues, issue(column, MissingNameIssue, "", "no first or last name"))
 			continue
 		}
-		entry.Phones, errs = ParsePhones(record[3])
-		if len(errs) > 0 {
-			if showErrors {
-				for i, e := range errs {
-					log.Printf(
-						"Ignoring %sphone in row %d (%s %s): %v",
-						ordinal(i+1, len(errs)), row, entry.FirstName, entry.LastName, e,
-					)
+		var phoneIssues []ValidationIssue
+		for _, i := range columns.phones {
+			for _, c := range SplitPhones(strings.ReplaceAll(cell(record, i), ":::", ";")) {
+				if phone, err := ParsePhoneNumber(c); err == nil {
+					entry.AddPhone(phone)
+				} else if !errors.Is(err, NoContent) {
+					phoneIssues = append(phoneIssues, phoneIssue(row, columns.field(i), i, c, err))
 				}
 			}
 		}
 		if len(entry.Phones) == 0 {
-			// silently skip entries with no valid phones
+			if len(phoneIssues) == 0 {
+				issues = append(issues, issue(columns.phones[0], NoValidPhoneIssue, "", "no phone numbers"))
+				continue
+			}
+			for i := range phoneIssues {
+				phoneIssues[i].Skipped = true
+			}
+		}
+		issues = append(issues, phoneIssues...)
+		if len(entry.Phones) == 0 {
 			continue
 		}
-		if entry.Emails, errs = ParseEmails(record[4]); len(errs) > 0 {
-			if showErrors {
-				// No one cares about email errors
+		for _, i := range columns.emails {
+			for _, c := range SplitEmails(strings.ReplaceAll(cell(record, i), ":::", ";")) {
+				if email, err := CanonicalizeEmail(c); err == nil {
+					entry.Emails = append(entry.Emails, email)
+				} else if !errors.Is(err, NoContent) {
+					issues = append(issues, emailIssue(row, columns.field(i), i, c, err))
+				}
 			}
 		}
+		if entry.Uid == "" {
+			entry.Uid, entry.UidDerived = entryUid(entry), true
+			uidColumn, _ = columns.nameColumn(record)
+		}
+		if first, ok := seen[entry.Uid]; ok {
+			msg := fmt.Sprintf("UID %s is the same as row %d's", entry.Uid, first)
+			issues = append(issues, issue(uidColumn, DuplicateUidIssue, cell(record, uidColumn), msg))
+			continue
+		}
+		seen[entry.Uid] = row
 		result = append(result, entry)
 	}
-	return result
+	return
 }
 
 func loadRecords(reader *csv.Reader) ([]Entry, error) {
@@ -236,17 +455,10 @@ func loadRecords(reader *csv.Reader) ([]Entry, error) {
 		if err != nil {
 			log.Panicf("error reading record from csv: %v", err)
 		}
-		if len(record) != len(ExportColumnNames) {
+		if len(record) != len(ExportColumnNames) && len(record) != len(LegacyExportColumnNames) {
 			log.Panicf("row %d: expected %d fields, got %d", row, len(ExportColumnNames), len(record))
 		}
-		entry := Entry{
-			FullId:    record[0],
-			Uid:       record[1],
-			FirstName: record[2],
-			LastName:  record[3],
-			Phones:    strings.Split(record[4], ";"),
-			Emails:    strings.Split(record[5], ";"),
-		}
+		entry := recordEntry(record)
 		if entry.FullId == "" {
 			return nil, fmt.Errorf("no full id found in row %d", row)
 		}
@@ -255,21 +467,102 @@ func loadRecords(reader *csv.Reader) ([]Entry, error) {
 	return result, nil
 }
 
-func ordinal(i int, max int) string {
-	if max == i {
-		if i == 1 {
-			return ""
-		}
-		return "last "
-	}
-	switch i {
-	case 1:
-		return "first "
-	case 2:
-		return "second "
-	case 3:
-		return "third "
-	default:
-		return fmt.Sprintf("%dth ", i)
+// recordEntry returns the entry for a row of the export spreadsheet,
+// which may be in the legacy format.
+func recordEntry(record []string) Entry {
+	entry := Entry{
+		FullId:    record[0],
+		Uid:       record[1],
+		FirstName: record[2],
+		LastName:  record[3],
+		Emails:    strings.Split(record[5], ";"),
+	}
+	for _, cell := range strings.Split(record[4], ";") {
+		phone, ext := phonenum.SplitExtension(cell)
+		entry.Phones = append(entry.Phones, phone)
+		if ext != "" {
+			entry.AddPhone(phonenum.Number{E164: phone, Extension: ext})
+		}
+	}
+	if len(record) >= len(ExportColumnNames) {
+		entry.CompanyName, entry.JobTitle = record[6], record[7]
+		if record[8] != "" {
+			entry.Urls = strings.Split(record[8], ";")
+		}
+		entry.Extension, entry.Owner, entry.Type = record[9], record[10], record[11]
+	}
+	return entry
+}
+
+// phoneCells returns the entry's phones as they're written in spreadsheets,
+// with any extension following the number as " x123".
+func phoneCells(entry Entry) []string {
+	cells := make([]string, len(entry.Phones))
+	for i, phone := range entry.Phones {
+		cells[i] = phone
+		if ext := entry.PhoneExtensions[phone]; ext != "" {
+			cells[i] = phone + " x" + ext
+		}
+	}
+	return cells
+}
+
+// ImportMergePlan reads a merge plan in the format written by [ExportDuplicates].
+//
+// Each group must have exactly one row marked "yes" in the Keep column,
+// and at least one other row. Rows that are marked neither "yes" nor "no"
+// are left out of the plan.
+func ImportMergePlan(path string) ([]MergeGroup, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := storage.BOMAwareCSVReader(f)
+	record, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkExportColumns(record, DuplicateColumnNames[:3]); err != nil {
+		return nil, err
+	}
+	var groups []MergeGroup
+	index := make(map[string]int)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		entry := recordEntry(record[3:])
+		if entry.FullId == "" {
+			return nil, fmt.Errorf("no full id found in row %d", row)
+		}
+		i, ok := index[record[0]]
+		if !ok {
+			i = len(groups)
+			index[record[0]] = i
+			groups = append(groups, MergeGroup{Group: record[0]})
+		}
+		switch strings.ToLower(strings.TrimSpace(record[2])) {
+		case "yes":
+			if groups[i].Survivor.FullId != "" {
+				return nil, fmt.Errorf("row %d: group %s has more than one survivor", row, record[0])
+			}
+			groups[i].Survivor = entry
+		case "no":
+			groups[i].Others = append(groups[i].Others, entry)
+		}
+	}
+	for _, group := range groups {
+		if group.Survivor.FullId == "" {
+			return nil, fmt.Errorf("group %s has no survivor", group.Group)
+		}
+		if len(group.Others) == 0 {
+			return nil, fmt.Errorf("group %s has nothing to merge", group.Group)
+		}
 	}
+	return groups, nil
 }
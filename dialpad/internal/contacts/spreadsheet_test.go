@@ -0,0 +1,77 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestExportImportContacts(t *testing.T) {
+	entries := []Entry{
+		{
+			FullId:      "shared_contact_a_uid_1700000000",
+			Uid:         "1700000000",
+			FirstName:   "Ann",
+			LastName:    "Smith",
+			Phones:      []string{"+15105551234"},
+			Emails:      []string{"ann@example.com"},
+			CompanyName: "Acme",
+			JobTitle:    "Advocate",
+			Urls:        []string{"https://example.com/ann", "https://example.org"},
+			Extension:   "1234",
+			Owner:       "5551234",
+			Type:        "local",
+		},
+		{
+			FullId:    "shared_contact_a_uid_1700000001",
+			Uid:       "1700000001",
+			FirstName: "Bob",
+			LastName:  "Jones",
+			Phones:    []string{"+14155559876"},
+			Emails:    []string{""},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "contacts.csv")
+	if err := ExportContacts(entries, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ImportContacts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(loaded, entries); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestImportLegacyContacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.csv")
+	content := "Dialpad UID,Creation Stamp,First Name,Last Name,Phones,Emails\n" +
+		"shared_contact_a_uid_1,1,Ann,Smith,+15105551234,ann@example.com\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ImportContacts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{{
+		FullId:    "shared_contact_a_uid_1",
+		Uid:       "1",
+		FirstName: "Ann",
+		LastName:  "Smith",
+		Phones:    []string{"+15105551234"},
+		Emails:    []string{"ann@example.com"},
+	}}
+	if diff := deep.Equal(loaded, expected); diff != nil {
+		t.Error(diff)
+	}
+}
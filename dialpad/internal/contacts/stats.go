@@ -0,0 +1,201 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/clickonetwo/automations/phonenum"
+)
+
+// UnknownStatKey is the key under which counts with no known value are kept.
+var UnknownStatKey = "unknown"
+
+// A StatCount is the number of contacts with some value.
+type StatCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// A NonCanonicalPhone is a contact phone that isn't in canonical form.
+// Canonical is the canonical form, if the phone is valid, and otherwise
+// Error says why it isn't.
+type NonCanonicalPhone struct {
+	Uid       string `json:"uid"`
+	Phone     string `json:"phone"`
+	Canonical string `json:"canonical,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// A SharedPhone is a phone that's in more than one contact, in canonical
+// form (if it's valid).
+type SharedPhone struct {
+	Phone string   `json:"phone"`
+	Uids  []string `json:"uids"`
+}
+
+// ContactStats is an overview of the quality of a contact list.
+//
+// ByCountryCode counts the contacts with a phone in each country, by calling
+// code of the canonical form of the phone (a contact with phones in several
+// countries counts in each of them).
+// ByCreationMonth counts the contacts created in each month, according to
+// their UIDs (see [EntryCreated]), oldest first.  Both are keyed
+// [UnknownStatKey] for contacts whose country or creation is unknown.
+type ContactStats struct {
+	Total           int                 `json:"total"`
+	WithoutPhone    int                 `json:"without_phone"`
+	WithoutEmail    int                 `json:"without_email"`
+	MultiplePhones  int                 `json:"multiple_phones"`
+	ByCountryCode   []StatCount         `json:"by_country_code"`
+	ByCreationMonth []StatCount         `json:"by_creation_month"`
+	NonCanonical    []NonCanonicalPhone `json:"non_canonical_phones"`
+	SharedPhones    []SharedPhone       `json:"shared_phones"`
+}
+
+// ComputeStats returns the statistics of the entries.
+func ComputeStats(entries []Entry) ContactStats {
+	stats := ContactStats{Total: len(entries), NonCanonical: []NonCanonicalPhone{}, SharedPhones: []SharedPhone{}}
+	countries := make(map[string]int)
+	months := make(map[string]int)
+	uidsByPhone := make(map[string][]string)
+	var phoneOrder []string
+	for _, e := range entries {
+		phones := nonBlank(e.Phones)
+		switch len(phones) {
+		case 0:
+			stats.WithoutPhone++
+		case 1:
+		default:
+			stats.MultiplePhones++
+		}
+		if len(nonBlank(e.Emails)) == 0 {
+			stats.WithoutEmail++
+		}
+		seen := make(map[string]bool)
+		for _, phone := range phones {
+			canonical, err := CanonicalizePhoneNumber(phone)
+			if err != nil {
+				stats.NonCanonical = append(stats.NonCanonical, NonCanonicalPhone{Uid: e.Uid, Phone: phone, Error: err.Error()})
+			} else if canonical != phone {
+				stats.NonCanonical = append(stats.NonCanonical, NonCanonicalPhone{Uid: e.Uid, Phone: phone, Canonical: canonical})
+			}
+			code := UnknownStatKey
+			if c, ok := phonenum.CountryOf(canonical); ok {
+				code = "+" + c.CallingCode
+			}
+			if !seen[code] {
+				seen[code] = true
+				countries[code]++
+			}
+			key := phone
+			if err == nil {
+				key = canonical
+			}
+			if _, ok := uidsByPhone[key]; !ok {
+				phoneOrder = append(phoneOrder, key)
+			}
+			if !slices.Contains(uidsByPhone[key], e.Uid) {
+				uidsByPhone[key] = append(uidsByPhone[key], e.Uid)
+			}
+		}
+		if created, ok := EntryCreated(e); ok {
+			months[created.Format("2006-01")]++
+		} else {
+			months[UnknownStatKey]++
+		}
+	}
+	for _, phone := range phoneOrder {
+		if uids := uidsByPhone[phone]; len(uids) > 1 {
+			stats.SharedPhones = append(stats.SharedPhones, SharedPhone{Phone: phone, Uids: uids})
+		}
+	}
+	stats.ByCountryCode = statCounts(countries, func(a, b StatCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	stats.ByCreationMonth = statCounts(months, func(a, b StatCount) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return stats
+}
+
+// statCounts returns the counts in the given order, with the unknown count last.
+func statCounts(counts map[string]int, compare func(a, b StatCount) int) []StatCount {
+	results := []StatCount{}
+	for key, count := range counts {
+		if key != UnknownStatKey {
+			results = append(results, StatCount{key, count})
+		}
+	}
+	slices.SortFunc(results, compare)
+	if count, ok := counts[UnknownStatKey]; ok {
+		results = append(results, StatCount{UnknownStatKey, count})
+	}
+	return results
+}
+
+// WriteText writes the statistics as a readable report.  At most limit
+// of the non-canonical and shared phones are listed (all if limit is 0).
+func (s ContactStats) WriteText(w io.Writer, limit int) error {
+	percent := func(n int) string {
+		if s.Total == 0 {
+			return "0%"
+		}
+		return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(s.Total))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Contacts: %d\n", s.Total)
+	fmt.Fprintf(&b, "Without a phone: %d (%s)\n", s.WithoutPhone, percent(s.WithoutPhone))
+	fmt.Fprintf(&b, "Without an email: %d (%s)\n", s.WithoutEmail, percent(s.WithoutEmail))
+	fmt.Fprintf(&b, "With more than one phone: %d (%s)\n", s.MultiplePhones, percent(s.MultiplePhones))
+	fmt.Fprintf(&b, "\nContacts by country code:\n")
+	for _, c := range s.ByCountryCode {
+		fmt.Fprintf(&b, "    %-8s %7d (%s)\n", c.Key, c.Count, percent(c.Count))
+	}
+	fmt.Fprintf(&b, "\nContacts by month created:\n")
+	for _, c := range s.ByCreationMonth {
+		fmt.Fprintf(&b, "    %-8s %7d %s\n", c.Key, c.Count, strings.Repeat("#", histogramWidth(c.Count, s.ByCreationMonth)))
+	}
+	fmt.Fprintf(&b, "\nNon-canonical phones: %d\n", len(s.NonCanonical))
+	for i, p := range s.NonCanonical {
+		if limit > 0 && i == limit {
+			fmt.Fprintf(&b, "    ... and %d more\n", len(s.NonCanonical)-limit)
+			break
+		}
+		if p.Error != "" {
+			fmt.Fprintf(&b, "    %s: %q is invalid: %s\n", p.Uid, p.Phone, p.Error)
+		} else {
+			fmt.Fprintf(&b, "    %s: %q should be %s\n", p.Uid, p.Phone, p.Canonical)
+		}
+	}
+	fmt.Fprintf(&b, "\nPhones shared by more than one contact: %d\n", len(s.SharedPhones))
+	for i, p := range s.SharedPhones {
+		if limit > 0 && i == limit {
+			fmt.Fprintf(&b, "    ... and %d more\n", len(s.SharedPhones)-limit)
+			break
+		}
+		fmt.Fprintf(&b, "    %s: %s\n", p.Phone, strings.Join(p.Uids, ", "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// histogramWidth scales a count to at most 50 columns, relative to the largest count.
+func histogramWidth(count int, counts []StatCount) int {
+	largest := slices.MaxFunc(counts, func(a, b StatCount) int { return cmp.Compare(a.Count, b.Count) }).Count
+	if largest == 0 {
+		return 0
+	}
+	return max(1, count*50/largest)
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestComputeStats(t *testing.T) {
+	created := func(date string) string {
+		when, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+		return fmt.Sprint(when.Unix())
+	}
+	entries := []Entry{
+		{Uid: created("2023-01-15"), Phones: []string{"+15105551234", "+525512345678"}, Emails: []string{"a@example.com"}},
+		{Uid: created("2023-01-20"), Phones: []string{"+15105551234"}},
+		{Uid: created("2023-03-01"), Phones: []string{""}, Emails: []string{""}},
+		{Uid: derivedUid("vcard"), Phones: []string{"(510) 555-9876", "+9991234"}, Emails: []string{"d@example.com"}},
+	}
+	stats := ComputeStats(entries)
+	if stats.Total != 4 || stats.WithoutPhone != 1 || stats.WithoutEmail != 2 || stats.MultiplePhones != 2 {
+		t.Errorf("unexpected totals: %+v", stats)
+	}
+	countries := []StatCount{{"+1", 3}, {"+52", 1}, {UnknownStatKey, 1}}
+	if diff := deep.Equal(stats.ByCountryCode, countries); diff != nil {
+		t.Errorf("by country code: %v", diff)
+	}
+	months := []StatCount{{"2023-01", 2}, {"2023-03", 1}, {UnknownStatKey, 1}}
+	if diff := deep.Equal(stats.ByCreationMonth, months); diff != nil {
+		t.Errorf("by creation month: %v", diff)
+	}
+	if len(stats.NonCanonical) != 2 || stats.NonCanonical[0].Canonical != "+15105559876" || stats.NonCanonical[1].Error == "" {
+		t.Errorf("non-canonical: %+v", stats.NonCanonical)
+	}
+	shared := []SharedPhone{{Phone: "+15105551234", Uids: []string{entries[0].Uid, entries[1].Uid}}}
+	if diff := deep.Equal(stats.SharedPhones, shared); diff != nil {
+		t.Errorf("shared phones: %v", diff)
+	}
+	var text strings.Builder
+	if err := stats.WriteText(&text, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "Contacts: 4\n") || !strings.Contains(text.String(), "... and 1 more") {
+		t.Errorf("unexpected text:\n%s", text.String())
+	}
+	if _, err := json.Marshal(stats); err != nil {
+		t.Error(err)
+	}
+}
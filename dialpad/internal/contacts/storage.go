@@ -8,75 +8,132 @@ package contacts
 
 import (
 	"context"
-	"encoding/gob"
-	"os"
-
-	"filippo.io/age"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/clickonetwo/automations/dialpad/internal/storage"
+	"github.com/clickonetwo/automations/phonenum"
 )
 
 var (
 	AllContactsFilename = "contacts.gob.age"
+	ExtensionsFilename  = "contact-extensions.gob.age"
+	SnapshotPrefix      = "contact-snapshots/"
+	SnapshotSuffix      = ".gob.age"
+	SnapshotIdFormat    = "20060102T150405.000000Z"
 )
 
 func UploadAllContacts(entries []Entry) error {
-	myself, err := age.ParseX25519Recipient(storage.GetConfig().AgePublicKey)
-	if err != nil {
-		return err
-	}
-	f, err := os.CreateTemp("", "gob-*.age")
-	if err != nil {
-		return err
-	}
-	defer os.Remove(f.Name())
-	defer f.Close()
-	encryptedWriter, err := age.Encrypt(f, myself)
-	if err != nil {
-		return err
-	}
-	encodedWriter := gob.NewEncoder(encryptedWriter)
-	err = encodedWriter.Encode(entries)
-	encryptedWriter.Close()
+	return uploadEntries(AllContactsFilename, entries)
+}
+
+func DownloadAllContacts() ([]Entry, error) {
+	return downloadEntries(AllContactsFilename)
+}
+
+// SaveExtensions remembers the extensions of the given entries' phones,
+// keyed by UID, since Dialpad doesn't store them.  The extensions of
+// other entries are left as they were.
+//
+// An entry without extensions forgets any saved for its UID, so entries
+// downloaded from Dialpad must have had [ApplyExtensions] done to them
+// before they are edited and saved again.
+func SaveExtensions(entries []Entry) error {
+	extensions, err := LoadExtensions()
 	if err != nil {
 		return err
 	}
-	_, err = f.Seek(0, 0)
-	if err != nil {
-		return err
+	for _, entry := range entries {
+		if len(entry.PhoneExtensions) > 0 {
+			extensions[entry.Uid] = entry.PhoneExtensions
+		} else {
+			delete(extensions, entry.Uid)
+		}
 	}
-	err = storage.S3PutBlob(context.Background(), AllContactsFilename, f)
-	return err
+	return storage.S3PutEncryptedGob(context.Background(), ExtensionsFilename, extensions)
 }
 
-func DownloadAllContacts() ([]Entry, error) {
-	f, err := os.CreateTemp("", "gob-*.age")
-	if err != nil {
+// LoadExtensions returns the extensions saved by [SaveExtensions]:
+// a map from UID to a map from phone to extension.
+func LoadExtensions() (map[string]map[string]string, error) {
+	extensions := make(map[string]map[string]string)
+	if err := storage.S3GetEncryptedGob(context.Background(), ExtensionsFilename, &extensions); err != nil && !storage.IsBlobNotFound(err) {
 		return nil, err
 	}
-	defer os.Remove(f.Name())
-	defer f.Close()
-	err = storage.S3GetBlob(context.Background(), AllContactsFilename, f)
-	if err != nil {
-		return nil, err
+	return extensions, nil
+}
+
+// ApplyExtensions fills in the extensions of entries downloaded from Dialpad,
+// for those of their phones that still have a saved extension.
+func ApplyExtensions(entries []Entry, extensions map[string]map[string]string) {
+	for i, entry := range entries {
+		for phone, ext := range extensions[entry.Uid] {
+			if slices.Contains(entry.Phones, phone) {
+				entries[i].AddPhone(phonenum.Number{E164: phone, Extension: ext})
+			}
+		}
 	}
-	_, err = f.Seek(0, 0)
-	if err != nil {
+}
+
+func uploadEntries(blobName string, entries []Entry) error {
+	return storage.S3PutEncryptedGob(context.Background(), blobName, entries)
+}
+
+func downloadEntries(blobName string) ([]Entry, error) {
+	var entries []Entry
+	if err := storage.S3GetEncryptedGob(context.Background(), blobName, &entries); err != nil {
 		return nil, err
 	}
-	myself, err := age.ParseX25519Identity(storage.GetConfig().AgeSecretKey)
-	if err != nil {
-		return nil, err
+	return entries, nil
+}
+
+// A Snapshot describes a saved copy of the Dialpad contacts.
+//
+// The ID of a snapshot is the UTC time it was taken, in [SnapshotIdFormat],
+// which is to the microsecond so that snapshots taken by commands run at
+// the same time don't overwrite each other.  (The IDs of older snapshots
+// are only to the second.)
+type Snapshot struct {
+	Id   string
+	Time time.Time
+	Size int64
+}
+
+// snapshotIdLayout parses snapshot IDs with or without fractional seconds,
+// since Go accepts a fraction after the seconds even if a layout has none.
+const snapshotIdLayout = "20060102T150405Z"
+
+// UploadSnapshot saves a timestamped snapshot of the contacts and returns its ID.
+func UploadSnapshot(entries []Entry) (string, error) {
+	id := time.Now().UTC().Format(SnapshotIdFormat)
+	if err := uploadEntries(SnapshotPrefix+id+SnapshotSuffix, entries); err != nil {
+		return "", err
 	}
-	gobStream, err := age.Decrypt(f, myself)
+	return id, nil
+}
+
+// DownloadSnapshot returns the contacts saved in the snapshot with the given ID.
+func DownloadSnapshot(id string) ([]Entry, error) {
+	return downloadEntries(SnapshotPrefix + id + SnapshotSuffix)
+}
+
+// ListSnapshots returns the saved snapshots, oldest first.
+func ListSnapshots() ([]Snapshot, error) {
+	blobs, err := storage.S3ListBlobs(context.Background(), SnapshotPrefix)
 	if err != nil {
 		return nil, err
 	}
-	var entries []Entry
-	dec := gob.NewDecoder(gobStream)
-	err = dec.Decode(&entries)
-	if err != nil {
-		return nil, err
+	var snapshots []Snapshot
+	for _, blob := range blobs {
+		id := strings.TrimSuffix(strings.TrimPrefix(blob.Name, SnapshotPrefix), SnapshotSuffix)
+		t, err := time.Parse(snapshotIdLayout, id)
+		if err != nil {
+			// not a snapshot
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Id: id, Time: t, Size: blob.Size})
 	}
-	return entries, nil
+	slices.SortFunc(snapshots, func(a, b Snapshot) int { return a.Time.Compare(b.Time) })
+	return snapshots, nil
 }
@@ -0,0 +1,26 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotIds(t *testing.T) {
+	taken := time.Date(2024, 11, 1, 16, 30, 0, 123456000, time.UTC)
+	id := taken.Format(SnapshotIdFormat)
+	if id != "20241101T163000.123456Z" {
+		t.Errorf("unexpected snapshot id %q", id)
+	}
+	if parsed, err := time.Parse(snapshotIdLayout, id); err != nil || !parsed.Equal(taken) {
+		t.Errorf("snapshot id %q parsed as %v, %v", id, parsed, err)
+	}
+	if parsed, err := time.Parse(snapshotIdLayout, "20241101T163000Z"); err != nil || !parsed.Equal(taken.Truncate(time.Second)) {
+		t.Errorf("older snapshot id parsed as %v, %v", parsed, err)
+	}
+}
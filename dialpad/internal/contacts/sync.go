@@ -0,0 +1,296 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/schollz/progressbar/v3"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// SyncState is the stored record of what was last pushed to a Dialpad contact list.
+//
+// It maps each contact's UID to its [SyncRecord].  The ID of the state is the
+// account whose contacts are synced, or "company" for the company contacts.
+type SyncState string
+
+func (s SyncState) StoragePrefix() string {
+	return "contact-sync:"
+}
+
+func (s SyncState) StorageId() string {
+	return string(s)
+}
+
+var CompanySyncState = SyncState("company")
+
+// A SyncRecord describes a synced contact.
+//
+// SourceHash is the content hash of the contact as it was pushed, and is used
+// to tell whether the source has changed since.  DialpadHash is the content hash
+// of the contact as Dialpad stored it, and is used to tell whether the contact
+// has been edited in Dialpad since.  (They differ when Dialpad normalizes content.)
+// Version is the version of [ContentHash] that made the hashes.
+type SyncRecord struct {
+	FullId      string `json:"id"`
+	SourceHash  string `json:"source"`
+	DialpadHash string `json:"dialpad"`
+	Version     int    `json:"version,omitempty"`
+}
+
+// contentHashVersion is the version of [ContentHash].  Version 1 left out
+// the company, job title, URLs, and extension when they were all blank,
+// so clearing them didn't change the hash.
+const contentHashVersion = 2
+
+// ContentHash returns a hash of the contact's content (but not its IDs,
+// owner, or type).
+func ContentHash(e Entry) string {
+	return hashContent(e.FirstName, e.LastName, nonBlank(e.Phones), nonBlank(e.Emails),
+		e.CompanyName, e.JobTitle, nonBlank(e.Urls), e.Extension)
+}
+
+// HashMatches tells whether the hash is the [ContentHash] of the contact,
+// either as it is now or as version 1 made it, which is how the hashes
+// in older audit records were made.
+func HashMatches(e Entry, hash string) bool {
+	if hash == ContentHash(e) {
+		return true
+	}
+	if e.CompanyName != "" || e.JobTitle != "" || len(nonBlank(e.Urls)) > 0 || e.Extension != "" {
+		return false
+	}
+	return hash == hashContent(e.FirstName, e.LastName, nonBlank(e.Phones), nonBlank(e.Emails))
+}
+
+func hashContent(content ...any) string {
+	bytes, err := json.Marshal(content)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// nonBlank returns the non-empty values, or nil if there are none.
+func nonBlank(vals []string) (results []string) {
+	for _, val := range vals {
+		if val != "" {
+			results = append(results, val)
+		}
+	}
+	return
+}
+
+// Fetch returns the stored records, by UID.
+func (s SyncState) Fetch() (map[string]SyncRecord, error) {
+	fields, err := storage.FetchMap(context.Background(), s)
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[string]SyncRecord, len(fields))
+	for uid, val := range fields {
+		var record SyncRecord
+		if err := json.Unmarshal([]byte(val), &record); err != nil {
+			return nil, fmt.Errorf("sync record for %s not understood: %v", uid, err)
+		}
+		records[uid] = record
+	}
+	return records, nil
+}
+
+// Record stores that the source entry was pushed to Dialpad, which stored it as stored.
+func (s SyncState) Record(source, stored Entry) error {
+	record := SyncRecord{
+		FullId: stored.FullId, SourceHash: ContentHash(source), DialpadHash: ContentHash(stored),
+		Version: contentHashVersion,
+	}
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return storage.StoreMapFields(context.Background(), s, map[string]string{source.Uid: string(bytes)})
+}
+
+// Forget removes the records of the given UIDs.
+func (s SyncState) Forget(uids ...string) error {
+	return storage.RemoveMapFields(context.Background(), s, uids...)
+}
+
+// Reset replaces all the stored records with records of the given Dialpad contacts,
+// as if each had been pushed exactly as it is.
+func (s SyncState) Reset(entries []Entry) error {
+	if err := storage.DeleteStorage(context.Background(), s); err != nil {
+		return err
+	}
+	fields := make(map[string]string, len(entries))
+	for _, e := range entries {
+		hash := ContentHash(e)
+		bytes, err := json.Marshal(SyncRecord{FullId: e.FullId, SourceHash: hash, DialpadHash: hash, Version: contentHashVersion})
+		if err != nil {
+			return err
+		}
+		fields[e.Uid] = string(bytes)
+	}
+	return storage.StoreMapFields(context.Background(), s, fields)
+}
+
+// Outdated tells whether any of the records were made with an earlier version
+// of [ContentHash], whose hashes can't be compared with the current ones,
+// so the state must be reset before syncing.
+func Outdated(records map[string]SyncRecord) bool {
+	for _, record := range records {
+		if record.Version < contentHashVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// A SyncPlan is what it takes to bring Dialpad up to date with a source list.
+//
+// Updated and deleted entries carry the full ID of their Dialpad contact.
+// Vanished are the UIDs of contacts that were to be deleted but are
+// already gone from Dialpad, so only their records need removing.
+type SyncPlan struct {
+	Create    []Entry
+	Update    []Entry
+	Delete    []Entry
+	Vanished  []string
+	Unchanged int
+}
+
+// PlanSync compares the source list against the records of what was last
+// pushed, without consulting Dialpad.  If prune is true, contacts that
+// were pushed but are no longer in the source are deleted.
+func PlanSync(source []Entry, records map[string]SyncRecord, prune bool) (plan SyncPlan) {
+	seen := make(map[string]bool, len(source))
+	for _, e := range source {
+		seen[e.Uid] = true
+		if record, ok := records[e.Uid]; !ok {
+			plan.Create = append(plan.Create, e)
+		} else if record.SourceHash != ContentHash(e) {
+			e.FullId = record.FullId
+			plan.Update = append(plan.Update, e)
+		} else {
+			plan.Unchanged++
+		}
+	}
+	if prune {
+		for uid, record := range records {
+			if !seen[uid] {
+				plan.Delete = append(plan.Delete, Entry{FullId: record.FullId, Uid: uid})
+			}
+		}
+		slices.SortFunc(plan.Delete, func(a, b Entry) int {
+			if uidLess(a, b) {
+				return -1
+			} else if uidLess(b, a) {
+				return 1
+			}
+			return 0
+		})
+	}
+	return
+}
+
+// A SyncConflict is a planned change to a contact that has been edited
+// (or deleted) in Dialpad since it was last pushed.
+type SyncConflict struct {
+	Planned Entry
+	Dialpad Entry // empty if the contact was deleted
+	Action  string
+}
+
+// FindConflicts fetches each contact the plan would update or delete,
+// and compares it with what was last pushed.
+//
+// Contacts the plan would delete that are already gone from Dialpad are moved
+// into the plan's Vanished list rather than being reported as conflicts.
+func FindConflicts(plan *SyncPlan, records map[string]SyncRecord) (conflicts []SyncConflict, errs []error) {
+	bar := progressbar.Default(int64(len(plan.Update)+len(plan.Delete)), "Checking for conflicts")
+	defer bar.Close()
+	for _, e := range plan.Update {
+		current, err := GetContact(e.FullId)
+		_ = bar.Add(1)
+		if errors.Is(err, NotFound) {
+			conflicts = append(conflicts, SyncConflict{Planned: e, Action: "update"})
+		} else if err != nil {
+			errs = append(errs, err)
+		} else if ContentHash(current) != records[e.Uid].DialpadHash {
+			conflicts = append(conflicts, SyncConflict{Planned: e, Dialpad: current, Action: "update"})
+		}
+	}
+	var remaining []Entry
+	for _, e := range plan.Delete {
+		current, err := GetContact(e.FullId)
+		_ = bar.Add(1)
+		if errors.Is(err, NotFound) {
+			plan.Vanished = append(plan.Vanished, e.Uid)
+			continue
+		}
+		remaining = append(remaining, e)
+		if err != nil {
+			errs = append(errs, err)
+		} else if ContentHash(current) != records[e.Uid].DialpadHash {
+			conflicts = append(conflicts, SyncConflict{Planned: e, Dialpad: current, Action: "delete"})
+		}
+	}
+	plan.Delete = remaining
+	return
+}
+
+// Exclude removes the conflicting changes from the plan.
+func (p *SyncPlan) Exclude(conflicts []SyncConflict) {
+	skip := make(map[string]bool, len(conflicts))
+	for _, c := range conflicts {
+		skip[c.Planned.Uid] = true
+	}
+	isSkipped := func(e Entry) bool { return skip[e.Uid] }
+	p.Update = slices.DeleteFunc(p.Update, isSkipped)
+	p.Delete = slices.DeleteFunc(p.Delete, isSkipped)
+}
+
+// ExecuteSync pushes the plan's changes to Dialpad, recording each one as it succeeds.
+func ExecuteSync(state SyncState, plan SyncPlan) (errs []error) {
+	if err := state.Forget(plan.Vanished...); err != nil {
+		return []error{err}
+	}
+	bar := progressbar.Default(int64(len(plan.Create)+len(plan.Update)+len(plan.Delete)), "Syncing contacts")
+	defer bar.Close()
+	for _, e := range append(slices.Clone(plan.Create), plan.Update...) {
+		stored, err := UpdateContact(uploadable(e))
+		_ = bar.Add(1)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err = state.Record(e, stored); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, e := range plan.Delete {
+		err := DeleteContact(e)
+		_ = bar.Add(1)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err = state.Forget(e.Uid); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
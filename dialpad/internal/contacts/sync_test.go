@@ -0,0 +1,76 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestPlanSync(t *testing.T) {
+	unchanged := Entry{Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}}
+	changed := Entry{Uid: "2", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105550000"}}
+	created := Entry{Uid: "3", FirstName: "Cat", LastName: "Brown", Phones: []string{"+15105559999"}}
+	records := map[string]SyncRecord{
+		"1": {FullId: "c_uid_1", SourceHash: ContentHash(unchanged)},
+		"2": {FullId: "c_uid_2", SourceHash: ContentHash(Entry{Uid: "2", FirstName: "Bob", LastName: "Jones"})},
+		"4": {FullId: "c_uid_4", SourceHash: "removed"},
+	}
+	source := []Entry{unchanged, changed, created}
+	plan := PlanSync(source, records, false)
+	expected := SyncPlan{
+		Create:    []Entry{created},
+		Update:    []Entry{{FullId: "c_uid_2", Uid: "2", FirstName: "Bob", LastName: "Jones", Phones: []string{"+15105550000"}}},
+		Unchanged: 1,
+	}
+	if diff := deep.Equal(plan, expected); diff != nil {
+		t.Error(diff)
+	}
+	plan = PlanSync(source, records, true)
+	if diff := deep.Equal(plan.Delete, []Entry{{FullId: "c_uid_4", Uid: "4"}}); diff != nil {
+		t.Error(diff)
+	}
+	plan.Exclude([]SyncConflict{{Planned: plan.Update[0]}, {Planned: plan.Delete[0]}})
+	if len(plan.Update) != 0 || len(plan.Delete) != 0 {
+		t.Errorf("expected conflicts to be excluded: %v", plan)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	e := Entry{FullId: "a", Uid: "1", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}, Emails: []string{""}}
+	f := Entry{FullId: "b", Uid: "2", FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}}
+	if ContentHash(e) != ContentHash(f) {
+		t.Errorf("expected IDs and blank emails to be ignored")
+	}
+	f.LastName = "Smyth"
+	if ContentHash(e) == ContentHash(f) {
+		t.Errorf("expected names to be hashed")
+	}
+}
+
+func TestContentHashClearedFields(t *testing.T) {
+	e := Entry{FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}, CompanyName: "Acme", Urls: []string{"https://acme.com"}}
+	f := Entry{FirstName: "Ann", LastName: "Smith", Phones: []string{"+15105551234"}}
+	hash := ContentHash(e)
+	if ContentHash(f) == hash {
+		t.Errorf("expected clearing the company and URLs to change the hash")
+	}
+	if HashMatches(f, hash) {
+		t.Errorf("expected the cleared contact not to match the old hash")
+	}
+	legacy := hashContent(f.FirstName, f.LastName, nonBlank(f.Phones), nonBlank(f.Emails))
+	if !HashMatches(f, legacy) || HashMatches(e, legacy) {
+		t.Errorf("expected only a contact without those fields to match its version 1 hash")
+	}
+	if !Outdated(map[string]SyncRecord{"1": {SourceHash: legacy}}) {
+		t.Errorf("expected an unversioned record to be outdated")
+	}
+	if Outdated(map[string]SyncRecord{"1": {SourceHash: hash, Version: contentHashVersion}}) {
+		t.Errorf("expected a current record not to be outdated")
+	}
+}
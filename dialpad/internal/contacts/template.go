@@ -12,6 +12,8 @@ import (
 	"net/url"
 	"slices"
 	"strings"
+
+	"github.com/clickonetwo/automations/phonenum"
 )
 
 func SearchForm(filter string, entries []SearchEntry) []byte {
@@ -56,17 +58,29 @@ func SearchForm(filter string, entries []SearchEntry) []byte {
 			padding-left: 10px;
 			padding-right: 10px;
 		}
+		#suggestions {
+			list-style: none;
+			margin: 0 auto;
+			padding: 0;
+			text-align: left;
+			max-width: 400px;
+		}
+		#suggestions li {
+			padding: 2px 10px;
+		}
 	</style>
 </head>
 `, titleFilter)
 	form := fmt.Sprintf(`
 <form action="/search" method="GET">
 	<label for="filter">Filter:</label>
-	<input type="text" id="filter" name="filter" value="%s" placeholder="name or phone" size="30"><br>
+	<input type="text" id="filter" name="filter" value="%s" placeholder="name or phone" size="30" autocomplete="off"><br>
+	<ul id="suggestions"></ul>
 	<button type="submit">Filter</button>
-</form>`, filter)
+</form>`, escFilter)
 	page := `<!DOCTYPE html><html>` + head + `<body>`
 	page += form
+	page += typeaheadScript
 	if len(entries) == 0 {
 		if filter != "" {
 			page += fmt.Sprintf(`<p class="message">You have no contacts that match %q</p>`, escFilter)
@@ -81,6 +95,60 @@ func SearchForm(filter string, entries []SearchEntry) []byte {
 	return []byte(page)
 }
 
+// typeaheadScript shows the best matches for the filter as it's typed,
+// using the JSON search API, so a contact can be picked without submitting.
+const typeaheadScript = `
+<script>
+(function () {
+	const input = document.getElementById("filter");
+	const list = document.getElementById("suggestions");
+	let timer = null;
+	let latest = "";
+	function historyLink(entry) {
+		let link = "/history?phone=" + encodeURIComponent(entry.phone) + "&name=" + encodeURIComponent(entry.name);
+		if (entry.extension) {
+			link += "&ext=" + encodeURIComponent(entry.extension);
+		}
+		return link;
+	}
+	function show(results) {
+		list.replaceChildren();
+		for (const entry of results) {
+			const item = document.createElement("li");
+			const anchor = document.createElement("a");
+			anchor.href = historyLink(entry);
+			anchor.textContent = entry.name + " (" + entry.phone + (entry.extension ? " x" + entry.extension : "") + ")";
+			item.appendChild(anchor);
+			list.appendChild(item);
+		}
+	}
+	async function suggest() {
+		const query = input.value.trim();
+		latest = query;
+		if (query === "") {
+			show([]);
+			return;
+		}
+		try {
+			const response = await fetch("/api/contacts/search?limit=10&q=" + encodeURIComponent(query));
+			if (!response.ok) {
+				return;
+			}
+			const body = await response.json();
+			if (body.query === latest) {
+				show(body.results);
+			}
+		} catch (e) {
+			// leave the suggestions as they were
+		}
+	}
+	input.addEventListener("input", function () {
+		clearTimeout(timer);
+		timer = setTimeout(suggest, 200);
+	});
+})();
+</script>`
+
 func searchTable(entries []SearchEntry) string {
 	slices.SortFunc(entries, SearchEntryCompare)
 	columns, width, rows := 4, 25, (len(entries)+3)/4
@@ -92,8 +160,12 @@ func searchTable(entries []SearchEntry) string {
 			if j < len(entries) {
 				entry := entries[j]
 				link := fmt.Sprintf(`/history?phone=%s&name=%s`, url.QueryEscape(entry.Phone), url.QueryEscape(entry.FullName))
+				if entry.Extension != "" {
+					link += "&ext=" + url.QueryEscape(entry.Extension)
+				}
 				name := fmt.Sprintf(`<a href="%s">%s</a>`, link, html.EscapeString(entry.FullName))
-				num := fmt.Sprintf(`<a href="%s">%s</a>`, link, FormatForHTML(entry.Phone))
+				number := phonenum.Number{E164: entry.Phone, Extension: entry.Extension}
+				num := fmt.Sprintf(`<a href="%s">%s</a>`, link, FormatNumberHTML(number))
 				col = fmt.Sprintf(`<td width="%d%%">%s<br />%s</td>`, width, name, num)
 			}
 			row += col
@@ -137,29 +209,14 @@ func ServerErrorForm(filter string) []byte {
 	return []byte(page)
 }
 
-// FormatForHTML takes an E.164 phone number and formats
-// it so it displays naturally in HTML.
-func FormatForHTML(phone string) string {
-	dash := "&#8209;" // non-breaking hyphen
-	if strings.HasPrefix(phone, "+1") {
-		// Zone 1
-		return fmt.Sprintf("(%s)&nbsp;%s%s%s", phone[2:5], phone[5:8], dash, phone[8:12])
-	} else {
-		// international, separate the country code
-		prefix := phone[:3]
-		suffix := phone[3:]
-		if !twoDigitCountryCodes.Contains(phone[1:3]) {
-			prefix = phone[:4]
-			suffix = phone[4:]
-		}
-		var suffixSuffix string
-		if len(suffix)%3 == 1 {
-			// put last 4 together
-			suffix, suffixSuffix = suffix[:len(suffix)-4], dash+suffix[len(suffix)-4:]
-		}
-		for i := len(suffix); i > 3; i = i - 3 {
-			suffix = suffix[0:i] + dash + suffix[i-3:i]
-		}
-		return prefix + dash + suffix + suffixSuffix
-	}
+// FormatPhoneHTML formats an E.164 phone number so it displays naturally in
+// HTML, grouped by country, with non-breaking spaces and hyphens.
+func FormatPhoneHTML(phone string) string {
+	return phonenum.FormatWith(phone, "&nbsp;", "&#8209;")
+}
+
+// FormatNumberHTML is [FormatPhoneHTML] for a phone number with an extension,
+// which follows it as "x123".
+func FormatNumberHTML(number phonenum.Number) string {
+	return number.FormatWith("&nbsp;", "&#8209;")
 }
@@ -14,110 +14,56 @@ import (
 	"strings"
 	"time"
 
-	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/clickonetwo/automations/phonenum"
 )
 
+// DefaultRegion is the region (an ISO 3166 code) assumed for phone numbers
+// that have no international prefix.  Use [SetDefaultRegion] to change it.
+var DefaultRegion = "US"
+
 var (
-	nonGeographicAreaCodes = mapset.NewSet(
-		"500", "511",
-		"521", "522", "523", "524", "525", "526", "527", "528", "529",
-		"532", "533", "535", "538",
-		"542", "543", "544", "545", "546", "547", "549",
-		"550", "552", "553", "554", "555", "556", "558",
-		"566", "569",
-		"576", "577", "578", "588", "589",
-	)
-	twoDigitCountryCodes = mapset.NewSet(
-		"20", "27", "30", "31", "32", "33", "34", "36", "39",
-		"40", "41", "43", "44", "45", "46", "47", "48", "49",
-		"51", "52", "53", "54", "55", "56", "57", "58",
-		"60", "61", "62", "63", "64", "65", "66",
-		"70", "71", "72", "73", "74", "75", "76", "77", "78", "79",
-		"81", "82", "84", "86", "87", "88",
-		"90", "91", "92", "93", "94", "95", "98",
-	)
-	NoContent     = errors.New("no content")
-	nonDigitsOnly = regexp.MustCompile(`\D+`)
+	NoContent             = phonenum.NoContent
+	TooFewDigits          = phonenum.TooFewDigits
+	TooManyDigits         = phonenum.TooManyDigits
+	InvalidPrefix         = phonenum.InvalidPrefix
+	NonGeographicAreaCode = phonenum.NonGeographicAreaCode
+	UnknownCountryCode    = phonenum.UnknownCountryCode
+	nonDigitsOnly         = regexp.MustCompile(`\D+`)
+	phoneSeparators       = regexp.MustCompile(`[,;/|]`)
+	commaPause            = regexp.MustCompile(`^\d{1,7}$`)
+	extensionParameter    = regexp.MustCompile(`(?i)^ext\s*=\s*\d{1,7}$`)
+	emailSeparators       = regexp.MustCompile(`[,;|]`)
 )
 
-// CanonicalizePhoneNumber validates a phone number and returns it in E.164 format.
-//
-// The canonicalization is intended to make the number acceptable to Dialpad, so
-// it's based on experience with what Dialpad will accept.  Here are the steps:
-//
-//  1. Non-numeric characters other than a leading '+' are removed.
-//  2. An initial '011' is replaced with '+'.
-//  3. An initial "+1" classifies a number as local (North American).
-//     Any other initial "+ digit" prefix means it's international.
-//  4. Numbers with no '+' and more than 10 digits must be international, so a '+' is prepended.
-//  5. Numbers with no '+' and 10 or fewer digits are assumed to be local, so a '+1' is prepended.
-//  6. If a local number has fewer than 10 digits after the +1, it's rejected.
-//  7. If a local number, after the area code, has a prefix starting with "0" or "1" (such as `510-123-4567`),
-//     it's rejected because North American prefixes can't start with either of those numbers.
-//     (This typically means it's an international number that has not been prefixed correctly with a '+'.)
-//  8. If a local number has one of the "non-geographic" (aka 5XX) area codes
-//     that are reserved for machine-to-machine communication,
-//     Dialpad will not accept it, so it is rejected.
-func CanonicalizePhoneNumber(phoneNumber string) (string, error) {
-	number := strings.TrimSpace(phoneNumber)
-	digits := nonDigitsOnly.ReplaceAllString(number, "")
-	if number[0] == '+' {
-		number = "+" + digits
-	} else if strings.HasPrefix(digits, "011") {
-		digits = digits[3:]
-		number = "+" + digits
-	} else {
-		number = digits
+// SetDefaultRegion sets the [DefaultRegion], which must have a country calling code.
+func SetDefaultRegion(region string) error {
+	if !phonenum.IsRegion(region) {
+		return fmt.Errorf("unknown region %q", region)
 	}
-	if digits == "" {
-		return "", NoContent
-	}
-	class := "unknown"
-	prefix := ""
-	if strings.HasPrefix(number, "+1") {
-		class = "local"
-		prefix = "+1"
-		digits = digits[1:]
-	} else if strings.HasPrefix(number, "+") {
-		class = "international"
-		prefix = "+"
-	} else if len(digits) > 10 {
-		class = "international"
-		prefix = "+"
-	} else {
-		class = "local"
-		prefix = "+1"
-	}
-	if class == "local" {
-		if len(digits) < 10 {
-			return "", fmt.Errorf("too few digits: %q", phoneNumber)
-		}
-		if digits[3] == '0' || digits[3] == '1' {
-			return "", fmt.Errorf("invalid prefix (starts with 0 or 1): %q", phoneNumber)
-		}
-		if nonGeographicAreaCodes.Contains(digits[0:3]) {
-			return "", fmt.Errorf("non-geographic area code: %q", phoneNumber)
-		}
-	}
-	return prefix + digits, nil
+	DefaultRegion = strings.ToUpper(region)
+	return nil
+}
+
+// CanonicalizePhoneNumber validates a phone number and returns it in E.164 format,
+// taking numbers without an international prefix to be in the [DefaultRegion].
+// Any extension is dropped.  See [phonenum.Canonicalize] for the rules.
+func CanonicalizePhoneNumber(phoneNumber string) (string, error) {
+	return phonenum.Canonicalize(phoneNumber, DefaultRegion)
+}
+
+// ParsePhoneNumber is [CanonicalizePhoneNumber] for a phone number that may
+// have an extension, which is kept.
+func ParsePhoneNumber(phoneNumber string) (phonenum.Number, error) {
+	return phonenum.Parse(phoneNumber, DefaultRegion)
 }
 
 // ParsePhones takes a sequence of phone numbers (separated by ',', ';', '/', or '|')
-// and returns a slice of the valid ones in canonical form.
+// and returns a slice of the valid ones in canonical form, with their extensions.
 //
 // It also returns a slice of errors, one for each of the non-valid phone numbers.
-func ParsePhones(phones string) (results []string, errs []error) {
-	phones = strings.TrimSpace(phones)
-	if phones == "" {
-		return nil, nil
-	}
-	re := regexp.MustCompile(`[,;/|]`)
-	candidates := re.Split(phones, -1)
-	for _, c := range candidates {
-		if strings.TrimSpace(c) == "" {
-			continue
-		}
-		if result, err := CanonicalizePhoneNumber(c); err != nil {
+func ParsePhones(phones string) (results []phonenum.Number, errs []error) {
+	for _, c := range SplitPhones(phones) {
+		if result, err := ParsePhoneNumber(c); err != nil {
 			if !errors.Is(err, NoContent) {
 				errs = append(errs, err)
 			}
@@ -128,6 +74,44 @@ func ParsePhones(phones string) (results []string, errs []error) {
 	return
 }
 
+// SplitPhones splits a sequence of phone numbers (separated by ',', ';', '/', or '|')
+// into the non-blank candidates, without validating them.
+//
+// Commas followed only by digits are pauses before an extension, and ";ext="
+// introduces an extension, so those stay with the number before them.
+func SplitPhones(phones string) (candidates []string) {
+	separators := phoneSeparators.FindAllStringIndex(phones, -1)
+	start, separator := 0, ""
+	for i := 0; i <= len(separators); i++ {
+		end := len(phones)
+		if i < len(separators) {
+			end = separators[i][0]
+		}
+		c := strings.TrimSpace(phones[start:end])
+		if n := len(candidates); c != "" && n > 0 &&
+			(separator == "," && commaPause.MatchString(c) || separator == ";" && extensionParameter.MatchString(c)) {
+			candidates[n-1] += separator + c
+		} else if c != "" {
+			candidates = append(candidates, c)
+		}
+		if i < len(separators) {
+			start, separator = separators[i][1], phones[separators[i][0]:separators[i][1]]
+		}
+	}
+	return
+}
+
+// SplitEmails splits a sequence of emails (separated by ',', ';', or '|')
+// into the non-blank candidates, without validating them.
+func SplitEmails(emails string) (candidates []string) {
+	for _, c := range emailSeparators.Split(emails, -1) {
+		if c = strings.TrimSpace(c); c != "" {
+			candidates = append(candidates, c)
+		}
+	}
+	return
+}
+
 // CanonicalizeEmail validates an email and returns it in canonical form.
 func CanonicalizeEmail(email string) (string, error) {
 	email = strings.TrimSpace(email)
@@ -146,13 +130,7 @@ func CanonicalizeEmail(email string) (string, error) {
 //
 // It also returns a slice of errors, one for each of the non-valid emails.
 func ParseEmails(emails string) (results []string, errs []error) {
-	if strings.TrimSpace(emails) == "" {
-		return nil, nil
-	}
-	re := regexp.MustCompile(`[,;|]`)
-	candidates := re.Split(emails, -1)
-	for _, c := range candidates {
-		c = strings.TrimSpace(c)
+	for _, c := range SplitEmails(emails) {
 		if result, err := CanonicalizeEmail(c); err != nil {
 			if !errors.Is(err, NoContent) {
 				errs = append(errs, err)
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/clickonetwo/automations/phonenum"
+	"github.com/clickonetwo/automations/phonenum/phonetest"
+)
+
+func TestCanonicalizePhoneNumber(t *testing.T) {
+	defer func() { DefaultRegion = "US" }()
+	for _, test := range phonetest.Load().Canonicalize {
+		if err := SetDefaultRegion(test.Region); err != nil {
+			t.Fatal(err)
+		}
+		result, err := CanonicalizePhoneNumber(test.Input)
+		if test.Error != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.Error) {
+				t.Errorf("%s %q: expected error %q, got %q (%v)", test.Region, test.Input, test.Error, result, err)
+			}
+		} else if err != nil || result != test.E164 {
+			t.Errorf("%s %q: expected %q, got %q (%v)", test.Region, test.Input, test.E164, result, err)
+		}
+	}
+	if err := SetDefaultRegion("ZZ"); err == nil {
+		t.Errorf("expected an error for an unknown region")
+	}
+}
+
+func TestFormatPhoneHTML(t *testing.T) {
+	if formatted := FormatPhoneHTML("+15105551234"); formatted != "(510)&nbsp;555&#8209;1234" {
+		t.Errorf("FormatPhoneHTML = %q", formatted)
+	}
+	if formatted := FormatPhoneHTML("+447700900123"); formatted != "+44&nbsp;7700&nbsp;900123" {
+		t.Errorf("FormatPhoneHTML = %q", formatted)
+	}
+}
+
+func TestParsePhones(t *testing.T) {
+	input := "510-555-1234,,12; +44 20 7946 0958;ext=204, 415-555-9876 / 12"
+	expected := []string{"510-555-1234,12", "+44 20 7946 0958;ext=204", "415-555-9876", "12"}
+	if diff := deep.Equal(SplitPhones(input), expected); diff != nil {
+		t.Errorf("SplitPhones: %v", diff)
+	}
+	numbers, errs := ParsePhones(input)
+	expectedNumbers := []phonenum.Number{
+		{E164: "+15105551234", Extension: "12"},
+		{E164: "+442079460958", Extension: "204"},
+		{E164: "+14155559876"},
+	}
+	if diff := deep.Equal(numbers, expectedNumbers); diff != nil {
+		t.Errorf("ParsePhones: %v", diff)
+	}
+	if len(errs) != 1 {
+		t.Errorf("ParsePhones errors: %v", errs)
+	}
+}
+
+func TestFormatNumberHTML(t *testing.T) {
+	number := phonenum.Number{E164: "+15105551234", Extension: "12"}
+	if formatted := FormatNumberHTML(number); formatted != "(510)&nbsp;555&#8209;1234&nbsp;x12" {
+		t.Errorf("FormatNumberHTML = %q", formatted)
+	}
+}
@@ -0,0 +1,492 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/clickonetwo/automations/phonenum"
+)
+
+// VCardIdProperty is the extension property that holds a contact's Dialpad ID
+// in the vCards we export, so they can be imported again as Dialpad contacts.
+var VCardIdProperty = "X-DIALPAD-ID"
+
+// The extension properties that hold the Dialpad fields that vCards
+// have no standard property for.
+var (
+	VCardExtensionProperty = "X-DIALPAD-EXTENSION"
+	VCardOwnerProperty     = "X-DIALPAD-OWNER"
+	VCardTypeProperty      = "X-DIALPAD-TYPE"
+)
+
+var numericUid = regexp.MustCompile(`\A[0-9]+\z`)
+
+// IsVCardPath tells whether the path names a vCard file, by its extension.
+func IsVCardPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".vcf" || ext == ".vcard"
+}
+
+// A vProperty is one content line of a vCard, after unfolding.
+type vProperty struct {
+	Name   string
+	Params map[string][]string
+	Value  string
+}
+
+// A vCard is the properties of one card, in order.
+type vCard []vProperty
+
+// get returns the properties of the card with the given (upper-case) name.
+func (c vCard) get(name string) (props []vProperty) {
+	for _, p := range c {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return
+}
+
+// first returns the value of the first property with the given name, or "" if there is none.
+func (c vCard) first(name string) string {
+	if props := c.get(name); len(props) > 0 {
+		return props[0].Value
+	}
+	return ""
+}
+
+// ParseVCards reads a file of vCards (version 3.0 or 4.0) and returns the
+// contacts in them that are valid for upload, just as [ParseContacts] does
+// for a spreadsheet.
+//
+// Names come from the N property, or from FN if there is no N; every TEL and
+// EMAIL property is used.  The contact's UID is taken from its UID property if
+// that's numeric, and otherwise derived from it, so the same card always gets
+// the same UID.  Cards with no UID get one derived from their names and phones
+// (see [MatchDerivedUids]).  Cards with the same UID as an earlier card are skipped.
+func ParseVCards(path string, showErrors bool) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cards, err := readVCards(f)
+	if err != nil {
+		return nil, err
+	}
+	var result []Entry
+	seen := make(map[string]int)
+	for i, card := range cards {
+		entry, errs := vCardEntry(card)
+		if showErrors {
+			for _, err := range errs {
+				log.Printf("Card %d (%s %s): %v", i+1, entry.FirstName, entry.LastName, err)
+			}
+		}
+		if entry.FirstName == "" && entry.LastName == "" {
+			if showErrors {
+				log.Printf("Skipping card %d: no name", i+1)
+			}
+			continue
+		}
+		if len(entry.Phones) == 0 {
+			if showErrors {
+				log.Printf("Skipping card %d (%s %s): no valid phones", i+1, entry.FirstName, entry.LastName)
+			}
+			continue
+		}
+		if first, ok := seen[entry.Uid]; ok {
+			if showErrors {
+				log.Printf("Skipping card %d (%s %s): same UID as card %d", i+1, entry.FirstName, entry.LastName, first)
+			}
+			continue
+		}
+		seen[entry.Uid] = i + 1
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// ImportVCards reads a file of vCards in the format written by [ExportVCards],
+// just as [ImportContacts] does for a spreadsheet.  Every card must have
+// a Dialpad ID.
+func ImportVCards(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cards, err := readVCards(f)
+	if err != nil {
+		return nil, err
+	}
+	var result []Entry
+	for i, card := range cards {
+		entry := Entry{FullId: card.first(VCardIdProperty), Uid: card.first("UID")}
+		if entry.FullId == "" {
+			return nil, fmt.Errorf("no %s found in card %d", VCardIdProperty, i+1)
+		}
+		if n := card.get("N"); len(n) > 0 {
+			parts := splitEscaped(n[0].Value, ';')
+			entry.LastName = unescapeValue(parts[0])
+			if len(parts) > 1 {
+				entry.FirstName = unescapeValue(parts[1])
+			}
+		}
+		for _, p := range card.get("TEL") {
+			phone, ext := phonenum.SplitExtension(strings.TrimPrefix(unescapeValue(p.Value), "tel:"))
+			entry.Phones = append(entry.Phones, phone)
+			if ext != "" {
+				entry.AddPhone(phonenum.Number{E164: phone, Extension: ext})
+			}
+		}
+		for _, p := range card.get("EMAIL") {
+			entry.Emails = append(entry.Emails, unescapeValue(p.Value))
+		}
+		setVCardFields(&entry, card)
+		entry.Extension = unescapeValue(card.first(VCardExtensionProperty))
+		entry.Owner = unescapeValue(card.first(VCardOwnerProperty))
+		entry.Type = unescapeValue(card.first(VCardTypeProperty))
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// vCardEntry validates the content of a card, returning its entry and
+// an error for each of its names, phones and emails that is invalid.
+func vCardEntry(card vCard) (entry Entry, errs []error) {
+	version := card.first("VERSION")
+	if version != "" && version != "3.0" && version != "4.0" {
+		errs = append(errs, fmt.Errorf("vCard version %s is not supported", version))
+	}
+	var first, last string
+	if n := card.get("N"); len(n) > 0 {
+		parts := splitEscaped(n[0].Value, ';')
+		last = unescapeValue(parts[0])
+		if len(parts) > 1 {
+			first = unescapeValue(parts[1])
+		}
+	}
+	if strings.TrimSpace(first) == "" && strings.TrimSpace(last) == "" {
+		first, last = splitFullName(unescapeValue(card.first("FN")))
+	}
+	var err error
+	if entry.FirstName, entry.LastName, err = ParseNames(first, last); err != nil {
+		errs = append(errs, err)
+	}
+	for _, p := range card.get("TEL") {
+		value := strings.TrimPrefix(unescapeValue(p.Value), "tel:")
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		if phone, err := ParsePhoneNumber(value); err == nil {
+			entry.AddPhone(phone)
+		} else if !errors.Is(err, NoContent) {
+			errs = append(errs, err)
+		}
+	}
+	for _, p := range card.get("EMAIL") {
+		if email, err := CanonicalizeEmail(unescapeValue(p.Value)); err == nil {
+			if !slices.Contains(entry.Emails, email) {
+				entry.Emails = append(entry.Emails, email)
+			}
+		} else if !errors.Is(err, NoContent) {
+			errs = append(errs, err)
+		}
+	}
+	setVCardFields(&entry, card)
+	entry.Uid, entry.UidDerived = vCardUid(card, entry)
+	return
+}
+
+// setVCardFields sets the entry's company, job title, and URLs from the
+// card's ORG, TITLE, and URL properties.  Only the organization name
+// (not its units) is used from ORG.
+func setVCardFields(entry *Entry, card vCard) {
+	if org := card.first("ORG"); org != "" {
+		entry.CompanyName = unescapeValue(splitEscaped(org, ';')[0])
+	}
+	entry.JobTitle = unescapeValue(card.first("TITLE"))
+	for _, p := range card.get("URL") {
+		if url := strings.TrimSpace(unescapeValue(p.Value)); url != "" {
+			entry.Urls = append(entry.Urls, url)
+		}
+	}
+}
+
+// splitFullName splits a formatted name into first and last names,
+// taking the last word as the last name.
+func splitFullName(name string) (first, last string) {
+	words := strings.Fields(name)
+	switch len(words) {
+	case 0:
+		return "", ""
+	case 1:
+		return words[0], ""
+	default:
+		return strings.Join(words[:len(words)-1], " "), words[len(words)-1]
+	}
+}
+
+// vCardUid returns the UID of the card, which must be numeric for Dialpad,
+// and whether it was derived from the entry's names and phones.
+func vCardUid(card vCard, entry Entry) (string, bool) {
+	uid := strings.TrimSpace(unescapeValue(card.first("UID")))
+	switch {
+	case numericUid.MatchString(uid):
+		return uid, false
+	case uid != "":
+		return derivedUid(uid), false
+	default:
+		return entryUid(entry), true
+	}
+}
+
+// readVCards reads all the cards in a vCard stream.
+func readVCards(r io.Reader) (cards []vCard, err error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+	var card vCard
+	inCard := false
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, err := parseContentLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VCARD"):
+			if inCard {
+				return nil, fmt.Errorf("line %d: BEGIN:VCARD inside a card", i+1)
+			}
+			inCard, card = true, nil
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VCARD"):
+			if !inCard {
+				return nil, fmt.Errorf("line %d: END:VCARD outside a card", i+1)
+			}
+			inCard = false
+			cards = append(cards, card)
+		case inCard:
+			card = append(card, prop)
+		default:
+			return nil, fmt.Errorf("line %d: content outside a card", i+1)
+		}
+	}
+	if inCard {
+		return nil, fmt.Errorf("the last card has no END:VCARD")
+	}
+	return cards, nil
+}
+
+// unfoldLines reads the lines of a vCard stream, joining continuation lines
+// (which start with a space or tab) to the lines they continue.
+func unfoldLines(r io.Reader) (lines []string, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+		} else {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseContentLine parses a line of the form [group.]NAME[;PARAM=value...]:value
+func parseContentLine(line string) (prop vProperty, err error) {
+	colon, quoted := -1, false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("no value in %q", line)
+	}
+	prop.Value = line[colon+1:]
+	parts := splitQuoted(line[:colon], ';')
+	name := parts[0]
+	if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+		name = name[dot+1:]
+	}
+	prop.Name = strings.ToUpper(name)
+	prop.Params = make(map[string][]string)
+	for _, param := range parts[1:] {
+		key, val, found := strings.Cut(param, "=")
+		key = strings.ToUpper(key)
+		if !found {
+			// a vCard 2.1-style bare type, such as TEL;CELL
+			key, val = "TYPE", param
+		}
+		for _, v := range splitQuoted(val, ',') {
+			prop.Params[key] = append(prop.Params[key], strings.Trim(v, `"`))
+		}
+	}
+	return prop, nil
+}
+
+// splitQuoted splits s on sep, except where sep is inside double quotes.
+func splitQuoted(s string, sep rune) (parts []string) {
+	start, quoted := 0, false
+	for i, c := range s {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == sep && !quoted {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitEscaped splits a structured value on sep, except where sep is escaped.
+// The parts are not unescaped.
+func splitEscaped(s string, sep byte) (parts []string) {
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == sep {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeValue removes the backslash escapes from a text value.
+func unescapeValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' || s[i] == 'N' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// escapeValue adds backslash escapes to a text value.
+func escapeValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\n", `\n`).Replace(s)
+}
+
+// ExportVCards writes the contacts as vCards (version 3.0), which can be
+// imported by most phones and email clients, and by [ImportVCards].
+func ExportVCards(entries []Entry, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := bufio.NewWriter(f)
+	for _, entry := range entries {
+		for _, line := range entryVCard(entry) {
+			if _, err = writer.WriteString(foldLine(line) + "\r\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Flush()
+}
+
+// entryVCard returns the (unfolded) content lines of the vCard for an entry.
+func entryVCard(entry Entry) []string {
+	lines := []string{"BEGIN:VCARD", "VERSION:3.0"}
+	if entry.Uid != "" {
+		lines = append(lines, "UID:"+escapeValue(entry.Uid))
+	}
+	if entry.FullId != "" {
+		lines = append(lines, VCardIdProperty+":"+escapeValue(entry.FullId))
+	}
+	lines = append(lines,
+		fmt.Sprintf("N:%s;%s;;;", escapeValue(entry.LastName), escapeValue(entry.FirstName)),
+		"FN:"+escapeValue(strings.TrimSpace(entry.FirstName+" "+entry.LastName)),
+	)
+	for _, phone := range nonBlank(phoneCells(entry)) {
+		lines = append(lines, "TEL;TYPE=VOICE:"+escapeValue(phone))
+	}
+	for _, email := range nonBlank(entry.Emails) {
+		lines = append(lines, "EMAIL;TYPE=INTERNET:"+escapeValue(email))
+	}
+	if entry.CompanyName != "" {
+		lines = append(lines, "ORG:"+escapeValue(entry.CompanyName))
+	}
+	if entry.JobTitle != "" {
+		lines = append(lines, "TITLE:"+escapeValue(entry.JobTitle))
+	}
+	for _, url := range nonBlank(entry.Urls) {
+		lines = append(lines, "URL:"+url)
+	}
+	for _, p := range []struct{ name, value string }{
+		{VCardExtensionProperty, entry.Extension},
+		{VCardOwnerProperty, entry.Owner},
+		{VCardTypeProperty, entry.Type},
+	} {
+		if p.value != "" {
+			lines = append(lines, p.name+":"+escapeValue(p.value))
+		}
+	}
+	return append(lines, "END:VCARD")
+}
+
+// foldLine folds a content line so no line is longer than 75 octets,
+// without splitting any UTF-8 characters.
+func foldLine(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+	var b strings.Builder
+	width := limit
+	for len(line) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		width = limit - 1 // continuation lines start with a space
+	}
+	b.WriteString(line)
+	return b.String()
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package contacts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var testVCards = strings.Join([]string{
+	"BEGIN:VCARD",
+	"VERSION:3.0",
+	"UID:1700000000",
+	"N:Smith;Ann;;;",
+	"FN:Ann Smith",
+	"item1.TEL;TYPE=CELL:(510) 555-1234",
+	"TEL;TYPE=HOME,VOICE:510.555.1234",
+	"TEL;TYPE=WORK:+44 20 7946 0",
+	" 958",
+	"EMAIL;TYPE=INTERNET:ann@example.com",
+	"EMAIL:not an email",
+	"END:VCARD",
+	"BEGIN:VCARD",
+	"VERSION:4.0",
+	"UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1",
+	"FN:José María García",
+	"TEL;VALUE=uri;TYPE=\"voice,cell\":tel:+1-415-555-9876",
+	"END:VCARD",
+	"BEGIN:VCARD",
+	"VERSION:4.0",
+	"FN:No Phone",
+	"EMAIL:nophone@example.com",
+	"END:VCARD",
+	"",
+}, "\r\n")
+
+func TestParseVCards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.vcf")
+	if err := os.WriteFile(path, []byte(testVCards), 0600); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ParseContacts(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+	expected := Entry{
+		Uid:       "1700000000",
+		FirstName: "Ann",
+		LastName:  "Smith",
+		Phones:    []string{"+15105551234", "+442079460958"},
+		Emails:    []string{"ann@example.com"},
+	}
+	if diff := deep.Equal(entries[0], expected); diff != nil {
+		t.Error(diff)
+	}
+	second := entries[1]
+	if second.FirstName != "José María" || second.LastName != "García" {
+		t.Errorf("unexpected names from FN: %q %q", second.FirstName, second.LastName)
+	}
+	if diff := deep.Equal(second.Phones, []string{"+14155559876"}); diff != nil {
+		t.Error(diff)
+	}
+	if !numericUid.MatchString(second.Uid) {
+		t.Errorf("expected a numeric UID, got %q", second.Uid)
+	}
+	again, _ := ParseContacts(path, false)
+	if again[1].Uid != second.Uid {
+		t.Errorf("derived UID is not stable: %q vs %q", again[1].Uid, second.Uid)
+	}
+}
+
+func TestExportImportVCards(t *testing.T) {
+	entries := []Entry{
+		{
+			FullId:          "shared_contact_a_uid_1700000000",
+			Uid:             "1700000000",
+			FirstName:       "Ann; \"Annie\"",
+			LastName:        "Smith, Jr.",
+			Phones:          []string{"+15105551234", "+442079460958"},
+			Emails:          []string{"ann@example.com"},
+			PhoneExtensions: map[string]string{"+442079460958": "204"},
+			CompanyName:     "Acme; Inc.",
+			JobTitle:        "Advocate",
+			Urls:            []string{"https://example.com/ann"},
+			Extension:       "1234",
+			Owner:           "5551234",
+			Type:            "local",
+		},
+		{
+			FullId:    "shared_contact_a_uid_1700000001",
+			Uid:       "1700000001",
+			FirstName: strings.Repeat("Ωmega", 20),
+			LastName:  "Long",
+			Phones:    []string{"+14155559876"},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "contacts.vcf")
+	if err := ExportContacts(entries, path); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(path)
+	for i, line := range strings.Split(string(content), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line %d is %d octets long", i+1, len(line))
+		}
+	}
+	loaded, err := ImportContacts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(loaded, entries); diff != nil {
+		t.Error(diff)
+	}
+}
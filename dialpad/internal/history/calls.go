@@ -0,0 +1,177 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package history
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"filippo.io/age"
+	"github.com/schollz/progressbar/v3"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// A CallRecord is one call made or received by a Dialpad user.
+//
+// ExternalNumber is the other party's phone, and InternalNumber the
+// Dialpad phone that was called or called from.  Duration is how long
+// the parties talked, which is zero for a missed call.
+type CallRecord struct {
+	Date           int64 // UnixMicro
+	CallId         string
+	Name           string
+	Email          string
+	TargetType     string
+	TargetId       int64
+	Direction      string
+	ExternalNumber string
+	InternalNumber string
+	Category       string
+	Duration       time.Duration
+	WasRecorded    bool
+	Voicemail      bool
+}
+
+func (r CallRecord) recordDate() int64 {
+	return r.Date
+}
+
+func (r CallRecord) recordId() string {
+	return r.CallId
+}
+
+// CallImportHeaders are the columns of a calls report that are imported.
+// Reports have other columns, and the columns can be in any order.
+var CallImportHeaders = []string{
+	"date_started", "call_id", "name", "email", "target_type", "target_id",
+	"direction", "external_number", "internal_number", "category",
+	"talk_duration", "was_recorded", "voicemail", "timezone",
+}
+
+// CallDurationUnit is the unit of the durations in a calls report.
+var CallDurationUnit = time.Minute
+
+func ImportCallRecords(path string) ([]CallRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseCallRecords(storage.BOMAwareCSVReader(f))
+}
+
+func ImportEncryptedCallRecords(path string) ([]CallRecord, error) {
+	id, err := age.ParseX25519Identity(storage.GetConfig().AgeSecretKey)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	df, err := age.Decrypt(f, id)
+	if err != nil {
+		return nil, err
+	}
+	return parseCallRecords(storage.BOMAwareCSVReader(df))
+}
+
+func parseCallRecords(reader *csv.Reader) ([]CallRecord, error) {
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("can't read column names: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range CallImportHeaders {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q in column names: %v", name, header)
+		}
+	}
+	var records []CallRecord
+	var row = 1
+	bar := progressbar.Default(-1, "Validating records")
+	defer bar.Close()
+	for {
+		row++
+		_ = bar.Add(1)
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("row %d can't be read: %v", row, err)
+		}
+		field := func(name string) string { return fields[columns[name]] }
+		if tz := field("timezone"); tz != "UTC" {
+			return nil, fmt.Errorf("row %d has an invalid timezone: %q", row, tz)
+		}
+		var record CallRecord
+		date, err := time.Parse("2006-01-02 15:04:05", field("date_started"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d has an invalid date (%s): %v", row, field("date_started"), err)
+		}
+		record.Date = date.UnixMicro()
+		record.CallId = field("call_id")
+		record.Name = field("name")
+		record.Email = field("email")
+		record.TargetType = field("target_type")
+		record.TargetId, _ = strconv.ParseInt(field("target_id"), 10, 64)
+		record.Direction = field("direction")
+		record.ExternalNumber = field("external_number")
+		record.InternalNumber = field("internal_number")
+		record.Category = field("category")
+		if d := field("talk_duration"); d != "" {
+			units, err := strconv.ParseFloat(d, 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d has an invalid duration (%s): %v", row, d, err)
+			}
+			record.Duration = time.Duration(units * float64(CallDurationUnit)).Round(time.Second)
+		}
+		if record.WasRecorded, err = parseReportFlag(field("was_recorded")); err != nil {
+			return nil, fmt.Errorf("row %d has an invalid recording flag: %v", row, err)
+		}
+		if record.Voicemail, err = parseReportFlag(field("voicemail")); err != nil {
+			return nil, fmt.Errorf("row %d has an invalid voicemail flag: %v", row, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// parseReportFlag reads a boolean column of a report, which is false if empty.
+func parseReportFlag(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+// SelectCallsByEmailPhone returns the calls of the user with the given email
+// with the given phone, in order.
+func SelectCallsByEmailPhone(email, phone string, calls []CallRecord) []CallRecord {
+	var cs []CallRecord
+	for _, call := range calls {
+		if call.Email == email && call.ExternalNumber == phone {
+			cs = append(cs, call)
+		}
+	}
+	return cs
+}
+
+// MergeCallRecords adds the calls that aren't already in the existing ones,
+// as [MergeSmsEvents] does for texts, identifying them by their call IDs.
+func MergeCallRecords(existing, added []CallRecord) ([]CallRecord, int) {
+	return mergeRecords(existing, added, func(a, b CallRecord) bool { return a == b })
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package history
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseCallRecords(t *testing.T) {
+	report := `call_id,date_started,extra,direction,external_number,internal_number,name,email,target_type,target_id,category,talk_duration,was_recorded,voicemail,timezone
+1,2024-01-02 03:04:05,x,inbound,+15105551234,+14155550000,Ann,ann@example.com,user,42,incoming,2.5,true,false,UTC
+2,2024-01-03 03:04:05,y,outbound,+15105551234,+14155550000,Ann,ann@example.com,user,42,outgoing,,,,UTC
+`
+	records, err := parseCallRecords(csv.NewReader(strings.NewReader(report)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []CallRecord{
+		{
+			Date: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMicro(), CallId: "1", Name: "Ann",
+			Email: "ann@example.com", TargetType: "user", TargetId: 42, Direction: "inbound",
+			ExternalNumber: "+15105551234", InternalNumber: "+14155550000", Category: "incoming",
+			Duration: 150 * time.Second, WasRecorded: true,
+		},
+		{
+			Date: time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC).UnixMicro(), CallId: "2", Name: "Ann",
+			Email: "ann@example.com", TargetType: "user", TargetId: 42, Direction: "outbound",
+			ExternalNumber: "+15105551234", InternalNumber: "+14155550000", Category: "outgoing",
+		},
+	}
+	if diff := deep.Equal(records, expected); diff != nil {
+		t.Error(diff)
+	}
+
+	bad := map[string]string{
+		"missing column":   "call_id,date_started\n1,2024-01-02 03:04:05\n",
+		"invalid timezone": strings.Replace(report, ",UTC\n", ",PST\n", 1),
+		"invalid duration": strings.Replace(report, ",2.5,", ",long,", 1),
+		"invalid flag":     strings.Replace(report, ",true,", ",maybe,", 1),
+	}
+	for name, report := range bad {
+		if _, err := parseCallRecords(csv.NewReader(strings.NewReader(report))); err == nil {
+			t.Errorf("expected a report with %s to fail", name)
+		}
+	}
+}
+
+func TestMergeCallRecords(t *testing.T) {
+	existing := []CallRecord{{Date: 1, CallId: "a"}, {Date: 3, CallId: "c"}}
+	added := []CallRecord{{Date: 2, CallId: "b"}, {Date: 3, CallId: "c", Voicemail: true}}
+	merged, count := MergeCallRecords(existing, added)
+	expected := []CallRecord{{Date: 1, CallId: "a"}, {Date: 2, CallId: "b"}, {Date: 3, CallId: "c"}}
+	if diff := deep.Equal(merged, expected); diff != nil {
+		t.Error(diff)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 call added, got %d", count)
+	}
+}
+
+func TestCallHistoryStorage(t *testing.T) {
+	useMemoryBlobs(t)
+	calls, err := DownloadCallHistory()
+	if err != nil || calls != nil {
+		t.Fatalf("expected no calls before any are stored, got %v (%v)", calls, err)
+	}
+	calls = []CallRecord{
+		{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).UnixMicro(), CallId: "1"},
+		{Date: time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC).UnixMicro(), CallId: "2"},
+	}
+	if err := UploadCallHistory(calls); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := DownloadCallHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(calls, downloaded); diff != nil {
+		t.Error(diff)
+	}
+	if _, err := DownloadSmsManifest(); err == nil {
+		t.Errorf("calls were stored with the SMS history")
+	}
+}
+
+func TestThreadTableWithCalls(t *testing.T) {
+	phone := "+15105551234"
+	events := []SmsEvent{
+		{Date: 1, FromPhone: phone, Text: "first text"},
+		{Date: 3, FromPhone: "+14155550000", ToPhones: []string{phone}, Text: "second text"},
+	}
+	calls := []CallRecord{
+		{Date: 2, Direction: "inbound", ExternalNumber: phone, Duration: 90 * time.Second},
+		{Date: 4, Direction: "outbound", ExternalNumber: phone, Voicemail: true, WasRecorded: true},
+	}
+	table := threadTable("Ann", phone, events, calls)
+	order := []string{"first text", "Call, 1m30s", "second text", "Voicemail (recorded)"}
+	last := -1
+	for _, s := range order {
+		i := strings.Index(table, s)
+		if i <= last {
+			t.Fatalf("expected %q after the previous rows in %s", s, table)
+		}
+		last = i
+	}
+	if page := string(RequestForm("Ann", phone, "", nil, calls)); strings.Contains(page, "no text or call history") {
+		t.Errorf("a phone with only calls has no history")
+	}
+	missed := CallRecord{Direction: "inbound", ExternalNumber: phone}
+	if desc := callDescription(missed); !strings.Contains(desc, "Missed call") {
+		t.Errorf("unexpected description of an unanswered inbound call: %s", desc)
+	}
+	missed.Direction = "outbound"
+	if desc := callDescription(missed); !strings.Contains(desc, "No answer") {
+		t.Errorf("unexpected description of an unanswered outbound call: %s", desc)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"slices"
 	"time"
 
 	"filippo.io/age"
@@ -22,6 +23,24 @@ import (
 	"github.com/clickonetwo/automations/dialpad/internal/storage"
 )
 
+// ReportTooRecent is the error returned by [RequestReport] when
+// there isn't enough time since the given date to report on.
+var ReportTooRecent = errors.New("can't report on less than two days")
+
+// ReportFailed is the error returned (wrapped) by [GetSmsReportDownloadUrl]
+// when Dialpad says that a requested report won't ever be ready.
+var ReportFailed = errors.New("report failed")
+
+// reportPending are the statuses of a requested report that isn't ready yet.
+var reportPending = []string{"", "pending", "queued", "processing"}
+
+// The stat types of the Dialpad reports on texts and calls.
+const (
+	SmsStatType  = "texts"
+	CallStatType = "calls"
+)
+
+// DownloadSmsReport downloads the report at url to path, encrypting it if asked.
 func DownloadSmsReport(url, path string, encrypt bool) error {
 	f, err := os.Create(path)
 	if err != nil {
@@ -38,7 +57,6 @@ func DownloadSmsReport(url, path string, encrypt bool) error {
 		if err != nil {
 			return err
 		}
-		defer w.Close()
 	}
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -49,10 +67,17 @@ func DownloadSmsReport(url, path string, encrypt bool) error {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("report download failed: status %s", resp.Status)
+	}
 	_, err = io.Copy(w, resp.Body)
 	if err != nil {
 		return err
 	}
+	if encrypt {
+		// flush the last chunk of the encrypted stream
+		return w.Close()
+	}
 	return nil
 }
 
@@ -69,18 +94,30 @@ type reportResponse struct {
 	RequestId      string `json:"request_id"`
 }
 
+// RequestSmsReport requests a report of the texts since fromDate.
 func RequestSmsReport(fromDate int64) (string, error) {
+	return RequestReport(SmsStatType, fromDate)
+}
+
+// RequestCallReport requests a report of the calls since fromDate.
+func RequestCallReport(fromDate int64) (string, error) {
+	return RequestReport(CallStatType, fromDate)
+}
+
+// RequestReport requests a report of the records of the given stat type
+// (in UnixMicro) since fromDate, and returns the ID of the request.
+func RequestReport(statType string, fromDate int64) (string, error) {
 	var usecPerDay int64 = 1_000_000 * 60 * 60 * 24
 	usec := time.Now().UnixMicro() - fromDate
 	if usec < 2*usecPerDay {
-		return "", errors.New("can't report on less than two days")
+		return "", ReportTooRecent
 	}
 	apiUrl := fmt.Sprintf("%s/stats?apikey=%s", contacts.DialpadApiRoot, storage.GetConfig().DialpadApiKey)
 	body, err := json.Marshal(reportRequest{
 		DaysAgoEarliest: (usec / usecPerDay) + 1,
 		DaysAgoLatest:   1,
 		ExportType:      "records",
-		StatType:        "texts",
+		StatType:        statType,
 		Timezone:        "UTC",
 	})
 	if err != nil {
@@ -114,6 +151,9 @@ type downloadResponse struct {
 	Status      string `json:"status"`
 }
 
+// GetSmsReportDownloadUrl returns the URL of a requested report, or an
+// empty URL if it isn't ready yet.  If the report has failed (or has a
+// status that isn't understood), the error wraps [ReportFailed].
 func GetSmsReportDownloadUrl(id string) (string, error) {
 	apiUrl := fmt.Sprintf("%s/stats/%s?apikey=%s", contacts.DialpadApiRoot, id, storage.GetConfig().DialpadApiKey)
 	req, err := http.NewRequest(http.MethodGet, apiUrl, nil)
@@ -134,8 +174,12 @@ func GetSmsReportDownloadUrl(id string) (string, error) {
 	if err = json.Unmarshal(body, &result); err != nil {
 		return "", fmt.Errorf("download response not understood: %v", err)
 	}
-	if result.Status != "complete" {
+	switch {
+	case result.Status == "complete" && result.DownloadUrl != "":
+		return result.DownloadUrl, nil
+	case slices.Contains(reportPending, result.Status):
 		return "", nil
+	default:
+		return "", fmt.Errorf("%w: report %s has status %q", ReportFailed, id, result.Status)
 	}
-	return result.DownloadUrl, nil
 }
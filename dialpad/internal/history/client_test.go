@@ -7,17 +7,105 @@
 package history
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
 )
 
 func TestDownloadAndEncryptSmsReport(t *testing.T) {
-	err := DownloadAndEncryptSmsReport("http://httpbin.org/get?this=is&a=test", "/tmp/test.json.age")
+	content := "date,message_id\n2024-01-01 00:00:00,1\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/report.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "report.csv.age")
+	if err := DownloadSmsReport(server.URL+"/report.csv", path, true); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = os.Stat("/tmp/test.json.age")
+	defer f.Close()
+	id, err := age.ParseX25519Identity(storage.GetConfig().AgeSecretKey)
 	if err != nil {
 		t.Fatal(err)
 	}
+	r, err := age.Decrypt(f, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := io.ReadAll(r); err != nil || string(decrypted) != content {
+		t.Errorf("decrypted %q (%v), expected %q", decrypted, err, content)
+	}
+	if err := DownloadSmsReport(server.URL+"/missing.csv", path, true); err == nil {
+		t.Errorf("expected a missing report to fail")
+	}
+}
+
+func TestWaitForSmsReport(t *testing.T) {
+	var polls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/stats/44"):
+			_, _ = w.Write([]byte(`{"status": "failed"}`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/stats/45"):
+			_, _ = w.Write([]byte(`{"status": "processing"}`))
+			return
+		case !strings.HasSuffix(r.URL.Path, "/stats/42"):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		polls++
+		if polls < 3 {
+			_, _ = w.Write([]byte(`{"status": "processing"}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"status": "complete", "download_url": "https://example.com/report.csv"}`)
+	}))
+	defer server.Close()
+	savedRoot, savedMin := contacts.DialpadApiRoot, ReportPollMinWait
+	contacts.DialpadApiRoot, ReportPollMinWait = server.URL, time.Millisecond
+	defer func() { contacts.DialpadApiRoot, ReportPollMinWait = savedRoot, savedMin }()
+
+	url, err := WaitForSmsReport(context.Background(), "42")
+	if err != nil || url != "https://example.com/report.csv" || polls != 3 {
+		t.Errorf("got %q, %v after %d polls", url, err, polls)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	polls = -100
+	if _, err := WaitForSmsReport(ctx, "42"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled wait, got %v", err)
+	}
+	if _, err := WaitForSmsReport(context.Background(), "43"); err == nil {
+		t.Errorf("expected an unknown report to fail")
+	}
+	if _, err := WaitForSmsReport(context.Background(), "44"); !errors.Is(err, ReportFailed) {
+		t.Errorf("expected a failed report to fail, got %v", err)
+	}
+	savedTimeout := ReportPollTimeout
+	ReportPollTimeout = 10 * time.Millisecond
+	defer func() { ReportPollTimeout = savedTimeout }()
+	if _, err := WaitForSmsReport(context.Background(), "45"); !errors.Is(err, ReportTimedOut) {
+		t.Errorf("expected a report that's never ready to time out, got %v", err)
+	}
 }
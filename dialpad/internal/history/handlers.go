@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,12 +22,52 @@ import (
 
 var (
 	EventHistory []SmsEvent
+	CallHistory  []CallRecord
 	AllContacts  []contacts.Entry
 )
 
+// historyLock protects EventHistory, CallHistory, and AllContacts, which are
+// replaced (but never changed) when they are reloaded while the server is running.
+var historyLock sync.RWMutex
+
+// installHistory replaces the loaded events, calls, and contacts, and their
+// index.  A nil slice leaves the loaded ones as they are.
+func installHistory(events []SmsEvent, calls []CallRecord, entries []contacts.Entry) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	if events != nil {
+		EventHistory = events
+	}
+	if calls != nil {
+		CallHistory = calls
+	}
+	if entries != nil {
+		AllContacts = entries
+	}
+	RebuildIndex()
+}
+
+// mergeHistory adds events and calls to the loaded ones (see [MergeSmsEvents]
+// and [MergeCallRecords]), and reindexes them.
+func mergeHistory(events []SmsEvent, calls []CallRecord) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	EventHistory, _ = MergeSmsEvents(EventHistory, events)
+	CallHistory, _ = MergeCallRecords(CallHistory, calls)
+	RebuildIndex()
+}
+
+// The number of search results returned by [SearchApiHandler] when
+// no limit is given, and the most it will return.
+var (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
 func RequestHandler(c *gin.Context) {
 	phone := c.Query("phone")
 	name := c.Query("name")
+	ext := c.Query("ext")
 	if phone == "" {
 		c.Redirect(http.StatusFound, fmt.Sprintf("/search?filter=%s", url.QueryEscape(name)))
 		return
@@ -39,8 +81,8 @@ func RequestHandler(c *gin.Context) {
 		c.Data(http.StatusOK, "text/html", ServerErrorForm(name, phone))
 		return
 	}
-	thread := SelectThreadByEmailPhone(email, phone, EventHistory)
-	c.Data(http.StatusOK, "text/html", RequestForm(name, phone, thread))
+	x := CurrentIndex()
+	c.Data(http.StatusOK, "text/html", RequestForm(name, phone, ext, x.Thread(email, phone), x.Calls(email, phone)))
 }
 
 func SearchHandler(c *gin.Context) {
@@ -51,14 +93,39 @@ func SearchHandler(c *gin.Context) {
 		c.Data(http.StatusOK, "text/html", contacts.ServerErrorForm(filter))
 		return
 	}
-	phones := SelectPhonesByEmail(email, EventHistory)
-	entries := contacts.SelectEntriesByPhones(phones, AllContacts)
-	if filter == "" {
-		c.Data(http.StatusOK, "text/html", contacts.SearchForm("", entries))
+	entries := CurrentIndex().Filter(email, filter)
+	c.Data(http.StatusOK, "text/html", contacts.SearchForm(filter, entries))
+}
+
+// SearchApiHandler returns the reader's contacts that match the "q" query
+// parameter, ranked by [contacts.RankSearchEntries], as JSON.  The "offset"
+// and "limit" parameters select a page of the results.
+func SearchApiHandler(c *gin.Context) {
+	userId, _ := c.Cookie(users.AuthCookieName)
+	email := users.CheckAuth(userId, "reader")
+	if email == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "details": "not logged in"})
+		return
+	}
+	query := c.Query("q")
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "details": "invalid offset"})
 		return
 	}
-	entries = contacts.FilterSearchEntries(filter, entries)
-	c.Data(http.StatusOK, "text/html", contacts.SearchForm(filter, entries))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultSearchLimit)))
+	if err != nil || limit < 1 || limit > MaxSearchLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "details": "invalid limit"})
+		return
+	}
+	ranked := CurrentIndex().Search(email, query, time.Now())
+	c.JSON(http.StatusOK, gin.H{
+		"query":   query,
+		"total":   len(ranked),
+		"offset":  offset,
+		"limit":   limit,
+		"results": contacts.PageSearchEntries(ranked, offset, limit),
+	})
 }
 
 func LoadEventHistory() error {
@@ -66,7 +133,19 @@ func LoadEventHistory() error {
 	if err != nil {
 		return err
 	}
-	EventHistory = events
+	installHistory(events, nil, nil)
+	return nil
+}
+
+func LoadCallHistory() error {
+	calls, err := DownloadCallHistory()
+	if err != nil {
+		return err
+	}
+	if calls == nil {
+		calls = []CallRecord{}
+	}
+	installHistory(nil, calls, nil)
 	return nil
 }
 
@@ -75,10 +154,21 @@ func LoadAllContacts() error {
 	if err != nil {
 		return err
 	}
-	AllContacts = entries
+	installHistory(nil, nil, entries)
 	return nil
 }
 
+// eventDates returns the dates of the first and last events in the history,
+// or empty strings if it has none (as it does before the history is loaded).
+func eventDates(events []SmsEvent) (first, last string) {
+	if len(events) == 0 {
+		return "", ""
+	}
+	first = time.UnixMicro(events[0].Date).In(PT).Format(time.RFC1123)
+	last = time.UnixMicro(events[len(events)-1].Date).In(PT).Format(time.RFC1123)
+	return
+}
+
 func StatsHandler(c *gin.Context) {
 	userId, _ := c.Cookie(users.AuthCookieName)
 	if userId == "" {
@@ -91,10 +181,14 @@ func StatsHandler(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "details": err.Error()})
 			return
 		}
+		historyLock.RLock()
+		defer historyLock.RUnlock()
+		first, last := eventDates(EventHistory)
 		c.IndentedJSON(http.StatusOK, gin.H{
 			"event_count":   len(EventHistory),
-			"first_event":   time.UnixMicro(EventHistory[0].Date).In(PT).Format(time.RFC1123),
-			"last_event":    time.UnixMicro(EventHistory[len(EventHistory)-1].Date).In(PT).Format(time.RFC1123),
+			"call_count":    len(CallHistory),
+			"first_event":   first,
+			"last_event":    last,
 			"contact_count": len(AllContacts),
 			"reader_count":  len(users.ListUsers("reader")),
 			"admin_count":   len(users.ListUsers("admin")),
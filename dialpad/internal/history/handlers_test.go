@@ -0,0 +1,22 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package history
+
+import (
+	"testing"
+)
+
+func TestEventDates(t *testing.T) {
+	if first, last := eventDates(nil); first != "" || last != "" {
+		t.Errorf("expected no dates for an empty history, got %q and %q", first, last)
+	}
+	events := []SmsEvent{{Date: 1730478600000000}, {Date: 1730565000000000}}
+	first, last := eventDates(events)
+	if first != "Fri, 01 Nov 2024 09:30:00 PDT" || last != "Sat, 02 Nov 2024 09:30:00 PDT" {
+		t.Errorf("unexpected dates %q and %q", first, last)
+	}
+}
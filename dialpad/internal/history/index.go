@@ -0,0 +1,165 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package history
+
+import (
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+)
+
+// An Index holds the event and call histories and contacts arranged for the handlers,
+// so that no request has to scan all of them.
+//
+// An index is never changed once it's built: when the history or contacts
+// are reloaded, a new index is built and swapped in (see [RebuildIndex]),
+// so requests in progress keep using the index they started with.
+type Index struct {
+	Contacts    *contacts.SearchIndex
+	lastContact map[string]map[string]int64
+	threads     map[string]map[string][]int
+	events      []SmsEvent
+	callThreads map[string]map[string][]int
+	calls       []CallRecord
+}
+
+var currentIndex atomic.Pointer[Index]
+
+// BuildIndex indexes the given events and contacts.
+func BuildIndex(events []SmsEvent, entries []contacts.Entry) *Index {
+	x := &Index{
+		Contacts:    contacts.NewSearchIndex(entries),
+		lastContact: make(map[string]map[string]int64),
+		threads:     make(map[string]map[string][]int),
+		events:      events,
+	}
+	for i, event := range events {
+		last, threads := x.lastContact[event.Email], x.threads[event.Email]
+		if last == nil {
+			last, threads = make(map[string]int64), make(map[string][]int)
+			x.lastContact[event.Email], x.threads[event.Email] = last, threads
+		}
+		phones := append([]string{event.FromPhone}, event.ToPhones...)
+		for j, phone := range phones {
+			if slices.Contains(phones[:j], phone) {
+				continue
+			}
+			threads[phone] = append(threads[phone], i)
+			if strings.HasPrefix(phone, "+") && event.Date > last[phone] {
+				last[phone] = event.Date
+			}
+		}
+	}
+	return x
+}
+
+// withCalls adds the given calls to the index, which must not be in use yet.
+// A call counts as contact with the other party, just as a text does.
+func (x *Index) withCalls(calls []CallRecord) *Index {
+	x.calls, x.callThreads = calls, make(map[string]map[string][]int)
+	for i, call := range calls {
+		threads := x.callThreads[call.Email]
+		if threads == nil {
+			threads = make(map[string][]int)
+			x.callThreads[call.Email] = threads
+		}
+		threads[call.ExternalNumber] = append(threads[call.ExternalNumber], i)
+		if !strings.HasPrefix(call.ExternalNumber, "+") {
+			continue
+		}
+		last := x.lastContact[call.Email]
+		if last == nil {
+			last = make(map[string]int64)
+			x.lastContact[call.Email] = last
+		}
+		if call.Date > last[call.ExternalNumber] {
+			last[call.ExternalNumber] = call.Date
+		}
+	}
+	return x
+}
+
+// CurrentIndex returns the index of the loaded history and contacts.
+func CurrentIndex() *Index {
+	if x := currentIndex.Load(); x != nil {
+		return x
+	}
+	return BuildIndex(nil, nil)
+}
+
+// RebuildIndex indexes the loaded history and contacts and makes that the current index.
+func RebuildIndex() {
+	currentIndex.Store(BuildIndex(EventHistory, AllContacts).withCalls(CallHistory))
+}
+
+// LastContact is [SelectLastContactByEmail] for the indexed events.
+// The returned map must not be changed.
+func (x *Index) LastContact(email string) map[string]int64 {
+	return x.lastContact[email]
+}
+
+// Phones is [SelectPhonesByEmail] for the indexed events.
+func (x *Index) Phones(email string) []string {
+	phones := make([]string, 0, len(x.lastContact[email]))
+	for phone := range x.lastContact[email] {
+		phones = append(phones, phone)
+	}
+	return phones
+}
+
+// Thread is [SelectThreadByEmailPhone] for the indexed events.
+func (x *Index) Thread(email, phone string) []SmsEvent {
+	var thread []SmsEvent
+	for _, i := range x.threads[email][phone] {
+		thread = append(thread, x.events[i])
+	}
+	return thread
+}
+
+// Calls is [SelectCallsByEmailPhone] for the indexed calls.
+func (x *Index) Calls(email, phone string) []CallRecord {
+	var calls []CallRecord
+	for _, i := range x.callThreads[email][phone] {
+		calls = append(calls, x.calls[i])
+	}
+	return calls
+}
+
+// Search returns the contacts of the user with the given email that match the query,
+// ranked by [contacts.RankSearchEntries].
+func (x *Index) Search(email, query string, now time.Time) []contacts.RankedEntry {
+	last := x.lastContact[email]
+	entries := x.Contacts.Entries(x.candidates(email, query))
+	return contacts.RankSearchEntries(query, entries, last, now)
+}
+
+// Filter returns the contacts of the user with the given email that match
+// the filter, as [contacts.FilterSearchEntries] does.  An empty filter
+// matches all the user's contacts.
+func (x *Index) Filter(email, filter string) []contacts.SearchEntry {
+	entries := x.Contacts.Entries(x.candidates(email, filter))
+	if filter == "" {
+		return entries
+	}
+	return contacts.FilterSearchEntries(filter, entries)
+}
+
+// candidates returns the user's phones that might match the query.
+func (x *Index) candidates(email, query string) []string {
+	last := x.lastContact[email]
+	matches, ok := x.Contacts.Candidates(query)
+	var phones []string
+	for phone := range last {
+		if !ok || matches[phone] || !x.Contacts.Has(phone) {
+			phones = append(phones, phone)
+		}
+	}
+	return phones
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package history
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+)
+
+var (
+	syntheticNames   = []string{"Ann", "José", "María", "Wei", "Fatima", "Olu", "Priya", "Dmitri", "Aiyana", "Ngozi", "Tomás", "Kenji"}
+	syntheticQueries = []string{"", "a", "ann", "jose", "garc", "555", "(415) 555", "kenji4", "zzz"}
+)
+
+// syntheticHistory returns realistic contacts and a year of texts between
+// them and the given number of readers.
+func syntheticHistory(rng *rand.Rand, contactCount, eventCount, readerCount int) ([]SmsEvent, []contacts.Entry, []string) {
+	var entries []contacts.Entry
+	var phones []string
+	for i := 0; i < contactCount; i++ {
+		phone := fmt.Sprintf("+1%d%03d%04d", 200+rng.IntN(800), 200+rng.IntN(800), rng.IntN(10000))
+		phones = append(phones, phone)
+		entries = append(entries, contacts.Entry{
+			FullId:    fmt.Sprintf("shared_contact_a_uid_%d", i+1),
+			Uid:       fmt.Sprint(i + 1),
+			FirstName: syntheticNames[rng.IntN(len(syntheticNames))] + fmt.Sprint(rng.IntN(100)),
+			LastName:  syntheticNames[rng.IntN(len(syntheticNames))],
+			Phones:    []string{phone},
+		})
+	}
+	var readers []string
+	for i := 0; i < readerCount; i++ {
+		readers = append(readers, fmt.Sprintf("reader%d@example.com", i))
+	}
+	start := time.Now().Add(-365 * 24 * time.Hour)
+	var events []SmsEvent
+	for i := 0; i < eventCount; i++ {
+		reader := rng.IntN(readerCount)
+		// each reader mostly texts with their own slice of the contacts
+		other := phones[(reader*37+rng.IntN(contactCount/10))%contactCount]
+		if rng.IntN(20) == 0 {
+			other = fmt.Sprintf("+1415555%04d", rng.IntN(10000))
+		}
+		event := SmsEvent{
+			Date:      start.Add(time.Duration(i) * time.Minute).UnixMicro(),
+			Email:     readers[reader],
+			Direction: "outbound",
+			FromPhone: "+15105550100",
+			ToPhones:  []string{other},
+		}
+		if rng.IntN(2) == 0 {
+			event.Direction, event.FromPhone, event.ToPhones = "inbound", other, []string{"+15105550100"}
+		}
+		events = append(events, event)
+	}
+	return events, entries, readers
+}
+
+func TestIndexMatchesLinearSearch(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	events, entries, readers := syntheticHistory(rng, 2000, 20000, 10)
+	x := BuildIndex(events, entries)
+	sorted := func(entries []contacts.SearchEntry) []contacts.SearchEntry {
+		slices.SortFunc(entries, contacts.SearchEntryCompare)
+		return entries
+	}
+	for _, email := range readers {
+		linear := contacts.SelectEntriesByPhones(SelectPhonesByEmail(email, events), entries)
+		for _, query := range syntheticQueries {
+			expected := linear
+			if query != "" {
+				expected = contacts.FilterSearchEntries(query, linear)
+			}
+			if diff := deep.Equal(sorted(x.Filter(email, query)), sorted(expected)); diff != nil {
+				t.Fatalf("%s %q: %v", email, query, diff)
+			}
+		}
+		phone := x.Phones(email)[0]
+		if diff := deep.Equal(x.Thread(email, phone), SelectThreadByEmailPhone(email, phone, events)); diff != nil {
+			t.Fatalf("%s thread with %s: %v", email, phone, diff)
+		}
+	}
+}
+
+func TestRebuildIndex(t *testing.T) {
+	savedEvents, savedContacts := EventHistory, AllContacts
+	defer func() { EventHistory, AllContacts = savedEvents, savedContacts; RebuildIndex() }()
+	rng := rand.New(rand.NewPCG(3, 4))
+	EventHistory, AllContacts, _ = syntheticHistory(rng, 100, 1000, 2)
+	RebuildIndex()
+	before := CurrentIndex()
+	if len(before.Phones("reader0@example.com")) == 0 {
+		t.Fatalf("expected reader0 to have phones")
+	}
+	EventHistory, AllContacts = nil, nil
+	RebuildIndex()
+	if len(CurrentIndex().Phones("reader0@example.com")) != 0 {
+		t.Errorf("expected the rebuilt index to be empty")
+	}
+	if len(before.Phones("reader0@example.com")) == 0 {
+		t.Errorf("expected the old index to be unchanged")
+	}
+}
+
+func TestIndexCalls(t *testing.T) {
+	email, phone := "reader@example.com", "+15105551234"
+	events := []SmsEvent{{Date: 1, Email: email, FromPhone: phone, ToPhones: []string{"+14155550000"}}}
+	calls := []CallRecord{
+		{Date: 2, Email: email, ExternalNumber: phone},
+		{Date: 3, Email: email, ExternalNumber: "+15105556789"},
+		{Date: 4, Email: "other@example.com", ExternalNumber: phone},
+	}
+	x := BuildIndex(events, nil).withCalls(calls)
+	if diff := deep.Equal(x.Calls(email, phone), SelectCallsByEmailPhone(email, phone, calls)); diff != nil {
+		t.Error(diff)
+	}
+	last := x.LastContact(email)
+	if last[phone] != 2 || last["+15105556789"] != 3 {
+		t.Errorf("expected calls to count as contact, got %v", last)
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	events, entries, readers := syntheticHistory(rng, 50000, 500000, 200)
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			email, query := readers[i%len(readers)], syntheticQueries[i%len(syntheticQueries)]
+			found := contacts.SelectEntriesByPhones(SelectPhonesByEmail(email, events), entries)
+			if query != "" {
+				_ = contacts.FilterSearchEntries(query, found)
+			}
+		}
+	})
+	x := BuildIndex(events, entries)
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			email, query := readers[i%len(readers)], syntheticQueries[i%len(syntheticQueries)]
+			_ = x.Filter(email, query)
+		}
+	})
+	b.Run("build", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = BuildIndex(events, entries)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package history
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/users"
+)
+
+// ReloadInProgress is returned by [Reload] when another reload hasn't finished.
+var ReloadInProgress = errors.New("a reload is already in progress")
+
+// ReloadStatus is what's known about the reloads done by a running server.
+type ReloadStatus struct {
+	Reloading     bool      `json:"reloading"`
+	Reloads       int       `json:"reloads"`
+	LastStarted   time.Time `json:"last_started,omitempty"`
+	LastCompleted time.Time `json:"last_completed,omitempty"`
+	LastDuration  string    `json:"last_duration,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+	UserCount     int       `json:"user_count"`
+	EventCount    int       `json:"event_count"`
+	CallCount     int       `json:"call_count"`
+	ContactCount  int       `json:"contact_count"`
+}
+
+var (
+	reloadLock   sync.Mutex
+	statusLock   sync.Mutex
+	reloadStatus ReloadStatus
+)
+
+// The sources of the reloaded data; replaced in tests.
+var (
+	downloadUsers    = users.DownloadUsersList
+	downloadEvents   = DownloadSmsHistory
+	downloadCalls    = DownloadCallHistory
+	downloadContacts = contacts.DownloadAllContacts
+)
+
+// Reload downloads the users, SMS and call histories, and contacts and, once all
+// of them have been downloaded, swaps them in for the loaded ones.
+// Requests are served from the loaded data until then, and if any
+// download fails none of the loaded data is replaced.
+//
+// Only one reload runs at a time: if another is in progress, this
+// returns [ReloadInProgress] without doing anything.
+func Reload() error {
+	if !reloadLock.TryLock() {
+		return ReloadInProgress
+	}
+	defer reloadLock.Unlock()
+	start := time.Now()
+	updateReloadStatus(func(s *ReloadStatus) {
+		s.Reloading, s.LastStarted = true, start
+	})
+	err := reload()
+	updateReloadStatus(func(s *ReloadStatus) {
+		s.Reloading, s.LastDuration, s.LastError = false, time.Since(start).String(), ""
+		if err != nil {
+			s.LastError = err.Error()
+			return
+		}
+		s.Reloads++
+		s.LastCompleted = time.Now()
+	})
+	return err
+}
+
+func reload() error {
+	userList, err := downloadUsers()
+	if err != nil {
+		return fmt.Errorf("error loading users: %w", err)
+	}
+	events, err := downloadEvents()
+	if err != nil {
+		return fmt.Errorf("error loading event history: %w", err)
+	}
+	calls, err := downloadCalls()
+	if err != nil {
+		return fmt.Errorf("error loading call history: %w", err)
+	}
+	entries, err := downloadContacts()
+	if err != nil {
+		return fmt.Errorf("error loading contacts: %w", err)
+	}
+	if events == nil {
+		events = []SmsEvent{}
+	}
+	if calls == nil {
+		calls = []CallRecord{}
+	}
+	if entries == nil {
+		entries = []contacts.Entry{}
+	}
+	users.InstallUsers(userList)
+	installHistory(events, calls, entries)
+	return nil
+}
+
+// CurrentReloadStatus returns the status of reloads, with the counts
+// of the currently loaded data.
+func CurrentReloadStatus() ReloadStatus {
+	statusLock.Lock()
+	status := reloadStatus
+	statusLock.Unlock()
+	status.UserCount = len(users.ListUsers("reader"))
+	historyLock.RLock()
+	status.EventCount, status.CallCount, status.ContactCount = len(EventHistory), len(CallHistory), len(AllContacts)
+	historyLock.RUnlock()
+	return status
+}
+
+func updateReloadStatus(update func(*ReloadStatus)) {
+	statusLock.Lock()
+	defer statusLock.Unlock()
+	update(&reloadStatus)
+}
+
+// ReloadEvery reloads the data on a schedule, until the returned stop
+// function is called.  Failures are reported to logf; the loaded data
+// is kept until a reload succeeds.
+func ReloadEvery(every time.Duration, logf func(string, ...any)) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			logf("Starting scheduled reload of users, histories, and contacts")
+			if err := Reload(); err != nil {
+				logf("Scheduled reload failed: %v", err)
+			} else {
+				logf("Completed scheduled reload of users, histories, and contacts")
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// ReloadHandler reloads the data (see [Reload]) for an admin and returns
+// the resulting reload status.  It waits for the reload to finish, and
+// responds with a conflict if another reload is in progress.
+func ReloadHandler(c *gin.Context) {
+	userId, _ := c.Cookie(users.AuthCookieName)
+	if users.CheckAuth(userId, "admin") == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "details": "not logged in as an admin"})
+		return
+	}
+	err := Reload()
+	switch {
+	case errors.Is(err, ReloadInProgress):
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "details": err.Error(), "reload": CurrentReloadStatus()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "details": err.Error(), "reload": CurrentReloadStatus()})
+	default:
+		c.IndentedJSON(http.StatusOK, gin.H{"status": "reloaded", "reload": CurrentReloadStatus()})
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package history
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/dialpad/internal/users"
+)
+
+// useReloadSources replaces the sources of reloaded data for the duration of a test.
+func useReloadSources(t *testing.T, userList []users.Entry, events []SmsEvent, entries []contacts.Entry) *error {
+	var failure error
+	oldUsers, oldEvents, oldCalls, oldContacts := downloadUsers, downloadEvents, downloadCalls, downloadContacts
+	savedEvents, savedCalls, savedContacts := EventHistory, CallHistory, AllContacts
+	savedReaders, savedAdmins := users.Readers, users.Admins
+	downloadUsers = func() ([]users.Entry, error) { return userList, nil }
+	downloadEvents = func() ([]SmsEvent, error) { return events, failure }
+	downloadCalls = func() ([]CallRecord, error) { return nil, nil }
+	downloadContacts = func() ([]contacts.Entry, error) { return entries, nil }
+	t.Cleanup(func() {
+		downloadUsers, downloadEvents, downloadCalls, downloadContacts = oldUsers, oldEvents, oldCalls, oldContacts
+		EventHistory, CallHistory, AllContacts = savedEvents, savedCalls, savedContacts
+		users.Readers, users.Admins = savedReaders, savedAdmins
+		RebuildIndex()
+	})
+	return &failure
+}
+
+func TestReload(t *testing.T) {
+	userList := []users.Entry{
+		{Id: "1", Emails: []string{"reader@example.com"}},
+		{Id: "2", Emails: []string{"admin@example.com"}, IsSuperAdmin: true},
+	}
+	events := []SmsEvent{{Date: 1, Email: "reader@example.com", FromPhone: "+15105551234", ToPhones: []string{"(Inbound)"}}}
+	entries := []contacts.Entry{{Uid: "1", FirstName: "Ann", Phones: []string{"+15105551234"}}}
+	failure := useReloadSources(t, userList, events, entries)
+	installHistory([]SmsEvent{}, []CallRecord{}, []contacts.Entry{})
+
+	reloads := CurrentReloadStatus().Reloads
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	status := CurrentReloadStatus()
+	if status.Reloading || status.LastError != "" || status.Reloads != reloads+1 || status.UserCount != 2 || status.EventCount != 1 || status.ContactCount != 1 {
+		t.Errorf("unexpected status after reload: %+v", status)
+	}
+	if users.CheckAuth("2", "admin") != "admin@example.com" || users.CheckAuth("1", "admin") != "" {
+		t.Errorf("reloaded users weren't installed")
+	}
+	if thread := CurrentIndex().Thread("reader@example.com", "+15105551234"); len(thread) != 1 {
+		t.Errorf("reloaded events weren't indexed: %v", thread)
+	}
+
+	// a failed reload keeps the loaded data
+	*failure = errors.New("download failed")
+	if err := Reload(); err == nil {
+		t.Fatalf("expected the reload to fail")
+	}
+	status = CurrentReloadStatus()
+	if status.LastError == "" || status.Reloads != reloads+1 {
+		t.Errorf("unexpected status after failed reload: %+v", status)
+	}
+	if status.EventCount != 1 || status.ContactCount != 1 {
+		t.Errorf("failed reload replaced the loaded data: %+v", status)
+	}
+
+	// only one reload runs at a time
+	reloadLock.Lock()
+	err := Reload()
+	reloadLock.Unlock()
+	if !errors.Is(err, ReloadInProgress) {
+		t.Errorf("expected a concurrent reload to be refused, got %v", err)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	failure := useReloadSources(t, []users.Entry{{Id: "2", Emails: []string{"admin@example.com"}, IsSuperAdmin: true}}, nil, nil)
+	users.InstallUsers([]users.Entry{{Id: "1", Emails: []string{"reader@example.com"}}})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/admin/reload", ReloadHandler)
+	post := func(userId string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+		req.AddCookie(&http.Cookie{Name: users.AuthCookieName, Value: userId})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := post("1"); code != http.StatusUnauthorized {
+		t.Errorf("expected a reader to be refused, got %d", code)
+	}
+	users.InstallUsers([]users.Entry{{Id: "2", Emails: []string{"admin@example.com"}, IsSuperAdmin: true}})
+	if code := post("2"); code != http.StatusOK {
+		t.Errorf("expected an admin reload to succeed, got %d", code)
+	}
+	*failure = errors.New("download failed")
+	if code := post("2"); code != http.StatusInternalServerError {
+		t.Errorf("expected a failed reload to be an error, got %d", code)
+	}
+}
@@ -28,6 +28,14 @@ type SmsEvent struct {
 	MmsUrl     string
 }
 
+func (e SmsEvent) recordDate() int64 {
+	return e.Date
+}
+
+func (e SmsEvent) recordId() string {
+	return e.MessageId
+}
+
 func SelectThreadByEmailPhone(email, phone string, events []SmsEvent) []SmsEvent {
 	var es []SmsEvent
 	for _, event := range events {
@@ -56,3 +64,19 @@ func SelectPhonesByEmail(email string, events []SmsEvent) []string {
 	}
 	return ps.ToSlice()
 }
+
+// SelectLastContactByEmail returns, for each phone the user with the given email
+// has texted with, the time (in UnixMicro) of their most recent message.
+func SelectLastContactByEmail(email string, events []SmsEvent) map[string]int64 {
+	last := make(map[string]int64)
+	for _, event := range events {
+		if event.Email == email {
+			for _, phone := range append([]string{event.FromPhone}, event.ToPhones...) {
+				if strings.HasPrefix(phone, "+") && event.Date > last[phone] {
+					last[phone] = event.Date
+				}
+			}
+		}
+	}
+	return last
+}
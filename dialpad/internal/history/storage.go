@@ -7,76 +7,473 @@
 package history
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/gob"
-	"os"
-
-	"filippo.io/age"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/clickonetwo/automations/dialpad/internal/storage"
 )
 
+// A history is stored in partitions, one for each month (in UTC) of
+// records, listed in a manifest.  Before the SMS history was partitioned,
+// it was stored as a single blob, which is still read if there is no manifest.
+var (
+	SmsHistoryFilename   = "sms-history.gob.age"
+	PartitionMonthFormat = "2006-01"
+)
+
+// PartitionWorkers is the number of partitions loaded at once.
+var PartitionWorkers = 4
+
+// A Partition describes the stored records of one month.
+//
+// Checksum is the SHA-256 of the partition's (unencrypted) content, which
+// is used both to check it when it's loaded and to tell whether it has
+// changed when the history is saved.  Archived partitions aren't loaded
+// by [DownloadSmsHistory] or [DownloadCallHistory].
+//
+// Blob is the name (after the history's prefix) of the blob holding the
+// partition, which includes its checksum, so a changed partition is saved
+// to a new blob rather than over the old one.  Partitions saved before
+// blobs were named this way have none, and are in a blob named by month.
+type Partition struct {
+	Month    string
+	Count    int
+	MinDate  int64 // UnixMicro
+	MaxDate  int64 // UnixMicro
+	Checksum string
+	Archived bool
+	Blob     string
+}
+
+// A Manifest lists the partitions of a history, oldest first.
+type Manifest struct {
+	Partitions []Partition
+	Updated    int64 // UnixMicro
+}
+
+// A historyRecord is a record kept in a history.
+type historyRecord interface {
+	SmsEvent | CallRecord
+	recordDate() int64
+	recordId() string
+}
+
+// A historyStore is where a history of records is stored: a manifest and
+// partitions whose blob names start with prefix.  If there's no manifest,
+// the history is read from the legacy blob, if any.
+type historyStore[T historyRecord] struct {
+	prefix string
+	legacy string
+	merge  func(existing, added []T) ([]T, int)
+}
+
 var (
-	SmsHistoryFilename = "sms-history.gob.age"
+	smsStore  = historyStore[SmsEvent]{prefix: "sms-history/", legacy: SmsHistoryFilename, merge: MergeSmsEvents}
+	callStore = historyStore[CallRecord]{prefix: "call-history/", merge: MergeCallRecords}
 )
 
+// A storeLock is held while a history's manifest and partitions are written,
+// so that only one process writes them at a time.
+type storeLock string
+
+func (l storeLock) StoragePrefix() string {
+	return "history-store-lock:"
+}
+
+func (l storeLock) StorageId() string {
+	return string(l)
+}
+
+// UploadInProgress is the error returned when another process is
+// writing the same history.
+var UploadInProgress = errors.New("another upload of this history is in progress")
+
+// StoreLockTimeout is how long a process writing a history holds its lock,
+// at most, in case the process dies without releasing it.
+var StoreLockTimeout = 10 * time.Minute
+
+// The blob store and lock used for the history; replaced in tests.
+var (
+	putBlob = func(name string, content []byte) error {
+		return storage.S3PutEncrypted(context.Background(), name, content)
+	}
+	getBlob = func(name string) ([]byte, error) {
+		return storage.S3GetEncrypted(context.Background(), name)
+	}
+	deleteBlob = func(name string) error {
+		return storage.S3DeleteBlob(context.Background(), name)
+	}
+	lockStore = func(prefix string) (func(), error) {
+		return tryLock(storeLock(prefix), StoreLockTimeout, UploadInProgress)
+	}
+)
+
+// UploadSmsHistory saves the events as the history of the months they
+// include, replacing the stored events of those months.  The stored
+// events of other months are left alone, as are archived months: if
+// the events include any of those, they are merged into them.
+//
+// Only the partitions whose content has changed are rewritten, and they
+// are saved to new blobs, which replace the old ones only when the
+// manifest listing them is saved, so a failed upload leaves the stored
+// history as it was.  Only one process writes a history at a time: if
+// another is writing it, this returns [UploadInProgress].
 func UploadSmsHistory(events []SmsEvent) error {
-	myself, err := age.ParseX25519Recipient(storage.GetConfig().AgePublicKey)
+	_, err := smsStore.write(events, false)
+	return err
+}
+
+// MergeSmsHistory merges the events into the stored history (see
+// [MergeSmsEvents]), rewriting only the partitions of the months that
+// have new events, as [UploadSmsHistory] does.  It returns the number
+// of events added.
+func MergeSmsHistory(events []SmsEvent) (int, error) {
+	return smsStore.write(events, true)
+}
+
+// DownloadSmsHistory loads the events of all the partitions that aren't
+// archived, in date order.  If the history hasn't been partitioned yet,
+// the single blob it used to be stored in is loaded instead.
+func DownloadSmsHistory() ([]SmsEvent, error) {
+	return smsStore.download()
+}
+
+// DownloadSmsPartitions loads the events of the partitions in the manifest
+// that are selected by include, several at a time, and returns them in order.
+func DownloadSmsPartitions(manifest Manifest, include func(Partition) bool) ([]SmsEvent, error) {
+	return smsStore.downloadPartitions(manifest, include)
+}
+
+// DownloadSmsManifest loads the manifest of the partitioned SMS history.
+// If the history hasn't been partitioned, the error is one that
+// [storage.IsBlobNotFound] recognizes.
+func DownloadSmsManifest() (Manifest, error) {
+	return smsStore.downloadManifest()
+}
+
+// ArchiveSmsHistory marks the partitions of months before the given one
+// (in [PartitionMonthFormat]) as archived, or, if archive is false,
+// marks them as not archived.  It returns the number of partitions changed.
+func ArchiveSmsHistory(before string, archive bool) (int, error) {
+	return smsStore.archive(before, archive)
+}
+
+// UploadCallHistory saves the calls, as [UploadSmsHistory] does for texts.
+func UploadCallHistory(calls []CallRecord) error {
+	_, err := callStore.write(calls, false)
+	return err
+}
+
+// MergeCallHistory merges the calls into the stored history,
+// as [MergeSmsHistory] does for texts.
+func MergeCallHistory(calls []CallRecord) (int, error) {
+	return callStore.write(calls, true)
+}
+
+// DownloadCallHistory loads the calls, as [DownloadSmsHistory] does for
+// texts.  If no calls have been saved, there are none.
+func DownloadCallHistory() ([]CallRecord, error) {
+	return callStore.download()
+}
+
+// DownloadCallManifest loads the manifest of the call history,
+// as [DownloadSmsManifest] does for texts.
+func DownloadCallManifest() (Manifest, error) {
+	return callStore.downloadManifest()
+}
+
+// ArchiveCallHistory archives partitions of the call history,
+// as [ArchiveSmsHistory] does for texts.
+func ArchiveCallHistory(before string, archive bool) (int, error) {
+	return callStore.archive(before, archive)
+}
+
+// write saves the records into the partitions of their months, either
+// merging them into the stored records of those months or (unless the
+// month is archived) replacing them.  It returns the number of records
+// that weren't already stored.
+//
+// A history that hasn't been partitioned yet is partitioned, so the
+// records of the legacy blob are kept in the months not being replaced.
+func (s historyStore[T]) write(records []T, merge bool) (int, error) {
+	unlock, err := lockStore(s.prefix)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	f, err := os.CreateTemp("", "gob-*.age")
-	if err != nil {
-		return err
+	defer unlock()
+	manifest, err := s.downloadManifest()
+	var unpartitioned map[string][]T
+	if storage.IsBlobNotFound(err) {
+		legacy, err := s.downloadLegacy()
+		if err != nil {
+			return 0, err
+		}
+		unpartitioned = partitionRecords(legacy)
+	} else if err != nil {
+		return 0, err
 	}
-	defer os.Remove(f.Name())
-	defer f.Close()
-	encryptedWriter, err := age.Encrypt(f, myself)
-	if err != nil {
-		return err
+	partitions := make(map[string]Partition, len(manifest.Partitions))
+	for _, p := range manifest.Partitions {
+		partitions[p.Month] = p
+	}
+	months := partitionRecords(records)
+	for month := range unpartitioned {
+		if _, ok := months[month]; !ok {
+			months[month] = nil
+		}
+	}
+	added, changed := 0, unpartitioned != nil
+	for _, month := range sortedMonths(months) {
+		old, found := partitions[month]
+		var stored []T
+		if found && (merge || old.Archived) {
+			if stored, err = s.downloadPartition(old); err != nil {
+				return 0, fmt.Errorf("partition %s: %w", month, err)
+			}
+		} else if !found && (merge || months[month] == nil) {
+			stored = unpartitioned[month]
+		}
+		monthRecords, count := s.merge(stored, months[month])
+		added += count
+		content, p, err := encodePartition(month, monthRecords)
+		if err != nil {
+			return 0, err
+		}
+		p.Archived = old.Archived
+		if found && old.Checksum == p.Checksum {
+			continue
+		}
+		p.Blob = fmt.Sprintf("%s-%s.gob.age", month, p.Checksum[:12])
+		if err = putBlob(s.prefix+p.Blob, content); err != nil {
+			return 0, err
+		}
+		partitions[month], changed = p, true
+	}
+	if !changed {
+		return added, nil
+	}
+	updated := Manifest{Updated: time.Now().UnixMicro()}
+	for _, month := range slices.Sorted(maps.Keys(partitions)) {
+		updated.Partitions = append(updated.Partitions, partitions[month])
+	}
+	if err = s.uploadManifest(updated); err != nil {
+		return 0, err
+	}
+	// Only this process writes the manifest, so the blobs that the old manifest
+	// listed and the new one doesn't are no longer listed by any manifest.  If
+	// they can't be deleted they do no harm, so the upload has succeeded.
+	for _, p := range manifest.Partitions {
+		if partitions[p.Month].Blob != p.Blob {
+			_ = deleteBlob(s.partitionBlobName(p))
+		}
+	}
+	return added, nil
+}
+
+func (s historyStore[T]) download() ([]T, error) {
+	manifest, err := s.downloadManifest()
+	if storage.IsBlobNotFound(err) {
+		return s.downloadLegacy()
 	}
-	encodedWriter := gob.NewEncoder(encryptedWriter)
-	err = encodedWriter.Encode(events)
-	encryptedWriter.Close()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return s.downloadPartitions(manifest, func(p Partition) bool { return !p.Archived })
+}
+
+// downloadLegacy loads the records of a history that hasn't been
+// partitioned, which has none if there's no legacy blob.
+func (s historyStore[T]) downloadLegacy() ([]T, error) {
+	if s.legacy == "" {
+		return nil, nil
+	}
+	var records []T
+	if err := downloadGob(s.legacy, &records); err != nil && !storage.IsBlobNotFound(err) {
+		return nil, err
+	}
+	return records, nil
+}
+
+// lastDate returns the date (in UnixMicro) of the latest stored record,
+// including those of archived months, or zero if there are none.
+func (s historyStore[T]) lastDate() (int64, error) {
+	manifest, err := s.downloadManifest()
+	if storage.IsBlobNotFound(err) {
+		legacy, err := s.downloadLegacy()
+		return lastRecordDate(legacy), err
 	}
-	_, err = f.Seek(0, 0)
 	if err != nil {
+		return 0, err
+	}
+	var last int64
+	for _, p := range manifest.Partitions {
+		last = max(last, p.MaxDate)
+	}
+	return last, nil
+}
+
+func (s historyStore[T]) downloadPartitions(manifest Manifest, include func(Partition) bool) ([]T, error) {
+	var selected []Partition
+	for _, p := range manifest.Partitions {
+		if include(p) {
+			selected = append(selected, p)
+		}
+	}
+	results := make([][]T, len(selected))
+	errs := make([]error, len(selected))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for range min(PartitionWorkers, len(selected)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i], errs[i] = s.downloadPartition(selected[i])
+			}
+		}()
+	}
+	for i := range selected {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	var records []T
+	for i, p := range selected {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("partition %s: %w", p.Month, errs[i])
+		}
+		records = append(records, results[i]...)
+	}
+	return records, nil
+}
+
+func (s historyStore[T]) downloadManifest() (Manifest, error) {
+	var manifest Manifest
+	err := downloadGob(s.manifestBlobName(), &manifest)
+	return manifest, err
+}
+
+func (s historyStore[T]) uploadManifest(manifest Manifest) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(manifest); err != nil {
 		return err
 	}
-	err = storage.S3PutBlob(context.Background(), SmsHistoryFilename, f)
-	return err
+	return putBlob(s.manifestBlobName(), buf.Bytes())
 }
 
-func DownloadSmsHistory() ([]SmsEvent, error) {
-	f, err := os.CreateTemp("", "gob-*.age")
-	if err != nil {
-		return nil, err
+func (s historyStore[T]) archive(before string, archive bool) (int, error) {
+	if _, err := time.Parse(PartitionMonthFormat, before); err != nil {
+		return 0, fmt.Errorf("%q is not a month (such as 2023-01)", before)
 	}
-	defer os.Remove(f.Name())
-	defer f.Close()
-	err = storage.S3GetBlob(context.Background(), SmsHistoryFilename, f)
+	unlock, err := lockStore(s.prefix)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	_, err = f.Seek(0, 0)
+	defer unlock()
+	manifest, err := s.downloadManifest()
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	changed := 0
+	for i, p := range manifest.Partitions {
+		if p.Month < before && p.Archived != archive {
+			manifest.Partitions[i].Archived = archive
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
 	}
-	myself, err := age.ParseX25519Identity(storage.GetConfig().AgeSecretKey)
+	manifest.Updated = time.Now().UnixMicro()
+	return changed, s.uploadManifest(manifest)
+}
+
+// downloadPartition loads the records of a partition, checking their checksum.
+func (s historyStore[T]) downloadPartition(p Partition) ([]T, error) {
+	content, err := getBlob(s.partitionBlobName(p))
 	if err != nil {
 		return nil, err
 	}
-	gobStream, err := age.Decrypt(f, myself)
-	if err != nil {
+	if sum := checksum(content); sum != p.Checksum {
+		return nil, fmt.Errorf("checksum is %s, expected %s", sum, p.Checksum)
+	}
+	var records []T
+	if err = gob.NewDecoder(bytes.NewReader(content)).Decode(&records); err != nil {
 		return nil, err
 	}
-	var events []SmsEvent
-	dec := gob.NewDecoder(gobStream)
-	err = dec.Decode(&events)
+	if len(records) != p.Count {
+		return nil, fmt.Errorf("has %d records, expected %d", len(records), p.Count)
+	}
+	return records, nil
+}
+
+func (s historyStore[T]) manifestBlobName() string {
+	return s.prefix + "manifest.gob.age"
+}
+
+func (s historyStore[T]) partitionBlobName(p Partition) string {
+	if p.Blob == "" {
+		return s.prefix + p.Month + ".gob.age"
+	}
+	return s.prefix + p.Blob
+}
+
+// partitionRecords groups the records by the month (in UTC) of their dates,
+// keeping their order.
+func partitionRecords[T historyRecord](records []T) map[string][]T {
+	months := make(map[string][]T)
+	for _, record := range records {
+		month := time.UnixMicro(record.recordDate()).UTC().Format(PartitionMonthFormat)
+		months[month] = append(months[month], record)
+	}
+	return months
+}
+
+func sortedMonths[T any](months map[string][]T) []string {
+	keys := make([]string, 0, len(months))
+	for month := range months {
+		keys = append(keys, month)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// encodePartition returns the (unencrypted) content of a partition, and its description.
+func encodePartition[T historyRecord](month string, records []T) ([]byte, Partition, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(records); err != nil {
+		return nil, Partition{}, err
+	}
+	p := Partition{Month: month, Count: len(records), Checksum: checksum(buf.Bytes())}
+	for i, record := range records {
+		date := record.recordDate()
+		if i == 0 || date < p.MinDate {
+			p.MinDate = date
+		}
+		p.MaxDate = max(p.MaxDate, date)
+	}
+	return buf.Bytes(), p, nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// downloadGob decodes the value stored in the named blob.
+func downloadGob(blobName string, value any) error {
+	content, err := getBlob(blobName)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return events, nil
+	return gob.NewDecoder(bytes.NewReader(content)).Decode(value)
 }
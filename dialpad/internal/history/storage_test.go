@@ -7,8 +7,15 @@
 package history
 
 import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/go-test/deep"
 
 	"github.com/clickonetwo/automations/dialpad/internal/storage"
@@ -35,3 +42,258 @@ func TestUploadDowloadSmsHistory(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+// useMemoryBlobs replaces the blob store with a map for the duration of a test.
+func useMemoryBlobs(t *testing.T) map[string][]byte {
+	blobs := make(map[string][]byte)
+	oldPut, oldGet, oldDelete, oldLock := putBlob, getBlob, deleteBlob, lockStore
+	putBlob = func(name string, content []byte) error {
+		blobs[name] = slices.Clone(content)
+		return nil
+	}
+	getBlob = func(name string) ([]byte, error) {
+		content, ok := blobs[name]
+		if !ok {
+			return nil, &types.NoSuchKey{}
+		}
+		return content, nil
+	}
+	deleteBlob = func(name string) error {
+		delete(blobs, name)
+		return nil
+	}
+	var lock sync.Mutex
+	lockStore = func(string) (func(), error) {
+		if !lock.TryLock() {
+			return nil, UploadInProgress
+		}
+		return lock.Unlock, nil
+	}
+	t.Cleanup(func() { putBlob, getBlob, deleteBlob, lockStore = oldPut, oldGet, oldDelete, oldLock })
+	return blobs
+}
+
+func monthEvent(id string, year int, month time.Month, day int) SmsEvent {
+	date := time.Date(year, month, day, 12, 0, 0, 0, time.UTC).UnixMicro()
+	return SmsEvent{Date: date, MessageId: id, Text: "text " + id}
+}
+
+func TestPartitionedSmsHistory(t *testing.T) {
+	blobs := useMemoryBlobs(t)
+	events := []SmsEvent{
+		monthEvent("1", 2023, time.December, 31),
+		monthEvent("2", 2024, time.January, 2),
+		monthEvent("3", 2024, time.January, 20),
+		monthEvent("4", 2024, time.March, 1),
+	}
+	if err := UploadSmsHistory(events); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := DownloadSmsManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Partitions) != 3 {
+		t.Fatalf("expected 3 partitions, got %+v", manifest.Partitions)
+	}
+	jan := manifest.Partitions[1]
+	if jan.Month != "2024-01" || jan.Count != 2 || jan.MinDate != events[1].Date || jan.MaxDate != events[2].Date {
+		t.Errorf("unexpected January partition: %+v", jan)
+	}
+	downloaded, err := DownloadSmsHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(events, downloaded); diff != nil {
+		t.Error(diff)
+	}
+
+	// only the changed month is rewritten, to a new blob, and the old one is deleted
+	before := manifest
+	added, _ := MergeSmsEvents(events, []SmsEvent{monthEvent("5", 2024, time.March, 2)})
+	if err := UploadSmsHistory(added); err != nil {
+		t.Fatal(err)
+	}
+	manifest, _ = DownloadSmsManifest()
+	for i, p := range manifest.Partitions {
+		if changed := p.Blob != before.Partitions[i].Blob; changed != (p.Month == "2024-03") {
+			t.Errorf("partition %s: blob was %q, now %q", p.Month, before.Partitions[i].Blob, p.Blob)
+		}
+	}
+	if _, ok := blobs[smsStore.partitionBlobName(before.Partitions[2])]; ok {
+		t.Errorf("superseded partition blob wasn't deleted")
+	}
+	if len(blobs) != len(manifest.Partitions)+1 {
+		t.Errorf("expected only the manifest and partitions to be stored, got %d blobs", len(blobs))
+	}
+
+	// a failed upload leaves the stored history as it was
+	savedPut := putBlob
+	putBlob = func(name string, content []byte) error {
+		if name == smsStore.manifestBlobName() {
+			return errors.New("upload failed")
+		}
+		return savedPut(name, content)
+	}
+	failed, _ := MergeSmsEvents(added, []SmsEvent{monthEvent("7", 2024, time.March, 3)})
+	if err := UploadSmsHistory(failed); err == nil {
+		t.Errorf("expected the upload to fail")
+	}
+	putBlob = savedPut
+	downloaded, err = DownloadSmsHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(added, downloaded); diff != nil {
+		t.Error(diff)
+	}
+
+	december := smsStore.partitionBlobName(manifest.Partitions[0])
+	content := blobs[december]
+	blobs[december] = []byte("corrupted")
+	if _, err := DownloadSmsHistory(); err == nil {
+		t.Errorf("expected a corrupted partition to fail its checksum")
+	}
+	blobs[december] = content
+
+	// archived months aren't loaded, but are kept and merged into
+	changed, err := ArchiveSmsHistory("2024-01", true)
+	if err != nil || changed != 1 {
+		t.Fatalf("expected 1 partition archived, got %d (%v)", changed, err)
+	}
+	downloaded, err = DownloadSmsHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(added[1:], downloaded); diff != nil {
+		t.Error(diff)
+	}
+	late := monthEvent("6", 2023, time.December, 1)
+	if err := UploadSmsHistory(append([]SmsEvent{late}, downloaded...)); err != nil {
+		t.Fatal(err)
+	}
+	manifest, _ = DownloadSmsManifest()
+	if p := manifest.Partitions[0]; p.Month != "2023-12" || !p.Archived || p.Count != 2 {
+		t.Errorf("unexpected archived partition: %+v", p)
+	}
+	if _, err := ArchiveSmsHistory("2024-01", false); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, _ = DownloadSmsHistory()
+	if len(downloaded) != 6 || downloaded[0].MessageId != "6" {
+		t.Errorf("unexpected history after unarchiving: %+v", downloaded)
+	}
+	if _, err := ArchiveSmsHistory("January", true); err == nil {
+		t.Errorf("expected a bad month to be rejected")
+	}
+}
+
+func TestMergeSmsHistory(t *testing.T) {
+	useMemoryBlobs(t)
+	events := []SmsEvent{
+		monthEvent("1", 2023, time.December, 31),
+		monthEvent("2", 2024, time.January, 2),
+		monthEvent("3", 2024, time.January, 20),
+		monthEvent("4", 2024, time.March, 1),
+	}
+	if err := UploadSmsHistory(events); err != nil {
+		t.Fatal(err)
+	}
+
+	// uploading some months leaves the others alone
+	january := []SmsEvent{monthEvent("2", 2024, time.January, 2)}
+	if err := UploadSmsHistory(january); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := DownloadSmsHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SmsEvent{events[0], events[1], events[3]}
+	if diff := deep.Equal(expected, downloaded); diff != nil {
+		t.Error(diff)
+	}
+
+	// merging rewrites only the months with new events
+	before, _ := DownloadSmsManifest()
+	added, err := MergeSmsHistory([]SmsEvent{events[1], monthEvent("5", 2024, time.March, 2)})
+	if err != nil || added != 1 {
+		t.Fatalf("expected 1 event added, got %d (%v)", added, err)
+	}
+	after, _ := DownloadSmsManifest()
+	for i, p := range after.Partitions {
+		if changed := p.Blob != before.Partitions[i].Blob; changed != (p.Month == "2024-03") {
+			t.Errorf("partition %s: blob was %q, now %q", p.Month, before.Partitions[i].Blob, p.Blob)
+		}
+	}
+	if added, err = MergeSmsHistory(events[:1]); err != nil || added != 0 {
+		t.Errorf("expected nothing added, got %d (%v)", added, err)
+	}
+
+	// only one process writes at a time
+	unlock, _ := lockStore(smsStore.prefix)
+	if _, err := MergeSmsHistory(events); !errors.Is(err, UploadInProgress) {
+		t.Errorf("expected a concurrent upload to be refused, got %v", err)
+	}
+	unlock()
+}
+
+func TestLegacySmsHistory(t *testing.T) {
+	blobs := useMemoryBlobs(t)
+	events := []SmsEvent{monthEvent("1", 2024, time.January, 2)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(events); err != nil {
+		t.Fatal(err)
+	}
+	blobs[SmsHistoryFilename] = buf.Bytes()
+	downloaded, err := DownloadSmsHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(events, downloaded); diff != nil {
+		t.Error(diff)
+	}
+
+	// merging into the legacy history partitions it
+	added := monthEvent("2", 2024, time.February, 2)
+	if count, err := MergeSmsHistory([]SmsEvent{added}); err != nil || count != 1 {
+		t.Fatalf("expected 1 event added, got %d (%v)", count, err)
+	}
+	if manifest, err := DownloadSmsManifest(); err != nil || len(manifest.Partitions) != 2 {
+		t.Errorf("expected 2 partitions, got %+v (%v)", manifest.Partitions, err)
+	}
+	downloaded, _ = DownloadSmsHistory()
+	if diff := deep.Equal(append(events, added), downloaded); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestUnnamedPartitionBlobs(t *testing.T) {
+	blobs := useMemoryBlobs(t)
+	events := []SmsEvent{monthEvent("1", 2024, time.January, 2)}
+	content, p, err := encodePartition("2024-01", events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs[smsStore.prefix+"2024-01.gob.age"] = content
+	if err = smsStore.uploadManifest(Manifest{Partitions: []Partition{p}}); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := DownloadSmsHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(events, downloaded); diff != nil {
+		t.Error(diff)
+	}
+	added, _ := MergeSmsEvents(events, []SmsEvent{monthEvent("2", 2024, time.January, 3)})
+	if err = UploadSmsHistory(added); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := blobs[smsStore.prefix+"2024-01.gob.age"]; ok {
+		t.Errorf("superseded partition blob wasn't deleted")
+	}
+	if downloaded, _ = DownloadSmsHistory(); len(downloaded) != 2 {
+		t.Errorf("expected 2 events after the upload, got %+v", downloaded)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package history
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/clickonetwo/automations/dialpad/internal/storage"
+)
+
+// HistorySyncJob is the stored state of a sync of a history with Dialpad,
+// so that a sync that's interrupted can be resumed where it left off.
+type HistorySyncJob string
+
+// The prefix (and the ID of the SMS job) date from when only the SMS
+// history was synced, and are kept so that syncs in progress still resume.
+func (j HistorySyncJob) StoragePrefix() string {
+	return "sms-sync:"
+}
+
+func (j HistorySyncJob) StorageId() string {
+	return string(j)
+}
+
+// The jobs that sync the SMS and call histories.
+var (
+	SmsHistorySync  = HistorySyncJob("history")
+	CallHistorySync = HistorySyncJob("calls")
+)
+
+// The stages of a sync, in order.  A sync with no stored
+// state hasn't started (or has finished).
+const (
+	SyncRequested  = "requested"
+	SyncDownloaded = "downloaded"
+)
+
+// HistorySyncState is what's known about a sync in progress.
+//
+// ReportId is the ID of the requested report, and FromDate (in UnixMicro)
+// the date of the last stored event when it was requested.  ReportPath is
+// where the report was downloaded to (encrypted), once it has been.
+type HistorySyncState struct {
+	Stage      string `json:"stage"`
+	ReportId   string `json:"report_id"`
+	FromDate   int64  `json:"from_date"`
+	ReportPath string `json:"report_path,omitempty"`
+	Updated    int64  `json:"updated"`
+}
+
+// The waits between checks on whether a requested report is ready.
+// They start at the minimum and double up to the maximum, and if the
+// report isn't ready after the timeout, the wait fails with [ReportTimedOut].
+var (
+	ReportPollMinWait = 2 * time.Second
+	ReportPollMaxWait = time.Minute
+	ReportPollTimeout = 30 * time.Minute
+)
+
+// ReportTimedOut is the error returned (wrapped) by [WaitForSmsReport]
+// when a report isn't ready within [ReportPollTimeout].
+var ReportTimedOut = errors.New("report timed out")
+
+// SyncInProgress is the error returned when another sync of the same job
+// (from the command line or the history server) hasn't finished.
+var SyncInProgress = errors.New("another sync of this history is in progress")
+
+// SyncLockTimeout is how long a sync holds its job's lock, at most,
+// in case the process holding it dies without releasing it.
+var SyncLockTimeout = 2 * ReportPollTimeout
+
+// A syncLock is held by the one sync of a job that's allowed to run.
+type syncLock string
+
+func (l syncLock) StoragePrefix() string {
+	return "sms-sync-lock:"
+}
+
+func (l syncLock) StorageId() string {
+	return string(l)
+}
+
+// Lock takes the job's lock, so no other sync of it can run until the
+// returned unlock function is called.  If another sync holds the lock,
+// this returns [SyncInProgress].
+func (j HistorySyncJob) Lock() (unlock func(), err error) {
+	return tryLock(syncLock(j), SyncLockTimeout, SyncInProgress)
+}
+
+// tryLock takes a lock shared by all the processes using the database, which
+// is held until the returned unlock function is called or the ttl passes.
+// If the lock is already held, it returns busy.
+func tryLock[L storage.String](lock L, ttl time.Duration, busy error) (unlock func(), err error) {
+	token := uuid.NewString()
+	locked, err := storage.StoreStringIfAbsent(context.Background(), lock, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, busy
+	}
+	return func() { _, _ = storage.DeleteStringIfEqual(context.Background(), lock, token) }, nil
+}
+
+// Load returns the state of the sync in progress, if there is one.
+func (j HistorySyncJob) Load() (HistorySyncState, bool, error) {
+	var state HistorySyncState
+	val, err := storage.FetchString(context.Background(), j)
+	if err != nil || val == "" {
+		return state, false, err
+	}
+	if err = json.Unmarshal([]byte(val), &state); err != nil {
+		return state, false, fmt.Errorf("sync state not understood: %v", err)
+	}
+	return state, true, nil
+}
+
+// Save stores the state of the sync in progress.
+func (j HistorySyncJob) Save(state HistorySyncState) error {
+	state.Updated = time.Now().UnixMicro()
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return storage.StoreString(context.Background(), j, string(bytes))
+}
+
+// Clear forgets the sync in progress.
+func (j HistorySyncJob) Clear() error {
+	return storage.DeleteStorage(context.Background(), j)
+}
+
+// A historyPipeline is how a kind of history is synced with Dialpad.
+type historyPipeline[T historyRecord] struct {
+	noun         string // as in "SMS history"
+	statType     string
+	store        historyStore[T]
+	importReport func(path string) ([]T, error)
+	install      func([]T) // merges the synced records into the loaded ones
+}
+
+var (
+	smsPipeline = historyPipeline[SmsEvent]{
+		noun:         "SMS",
+		statType:     SmsStatType,
+		store:        smsStore,
+		importReport: ImportEncryptedSmsEvents,
+		install:      func(events []SmsEvent) { mergeHistory(events, nil) },
+	}
+	callPipeline = historyPipeline[CallRecord]{
+		noun:         "call",
+		statType:     CallStatType,
+		store:        callStore,
+		importReport: ImportEncryptedCallRecords,
+		install:      func(calls []CallRecord) { mergeHistory(nil, calls) },
+	}
+)
+
+// SyncSmsHistory brings the stored SMS history up to date with Dialpad.
+//
+// It requests a report of the texts since the last stored event, waits for
+// it to be ready, downloads it (encrypted) into workDir, and merges its
+// events into the stored history (see [MergeSmsHistory]) and the [EventHistory].  The job's state is saved after each stage, so if the sync
+// is interrupted (or fails) it resumes from the last completed stage.  But if
+// the report fails or times out, the state is cleared, so the next sync
+// requests a new report.  Only one sync of a job runs at a time: if another
+// is in progress, this returns [SyncInProgress].
+//
+// It returns the number of events added, which is zero (with no error) if
+// the history is too recent to report on.  Progress is reported to logf.
+func SyncSmsHistory(ctx context.Context, job HistorySyncJob, workDir string, logf func(string, ...any)) (int, error) {
+	return syncHistory(ctx, smsPipeline, job, workDir, logf)
+}
+
+// SyncCallHistory brings the stored call history up to date with Dialpad,
+// as [SyncSmsHistory] does for texts, merging its calls into the [CallHistory].
+func SyncCallHistory(ctx context.Context, job HistorySyncJob, workDir string, logf func(string, ...any)) (int, error) {
+	return syncHistory(ctx, callPipeline, job, workDir, logf)
+}
+
+func syncHistory[T historyRecord](ctx context.Context, p historyPipeline[T], job HistorySyncJob, workDir string, logf func(string, ...any)) (int, error) {
+	unlock, err := job.Lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	state, found, err := job.Load()
+	if err != nil {
+		return 0, err
+	}
+	if found && state.Stage == SyncDownloaded {
+		if _, err := os.Stat(state.ReportPath); err != nil {
+			logf("Report %s was downloaded to %q, which is gone; downloading it again", state.ReportId, state.ReportPath)
+			state.Stage, state.ReportPath = SyncRequested, ""
+		}
+	}
+	if !found {
+		from, err := p.store.lastDate()
+		if err != nil {
+			return 0, err
+		}
+		state = HistorySyncState{Stage: SyncRequested, FromDate: from}
+		logf("Requesting a report of %s since %s...", p.statType, time.UnixMicro(state.FromDate).Format(time.RFC1123))
+		state.ReportId, err = RequestReport(p.statType, state.FromDate)
+		if errors.Is(err, ReportTooRecent) {
+			logf("The %s history is already up to date", p.noun)
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err = job.Save(state); err != nil {
+			return 0, err
+		}
+	}
+	if state.Stage == SyncRequested {
+		logf("Waiting for report %s...", state.ReportId)
+		url, err := WaitForSmsReport(ctx, state.ReportId)
+		if errors.Is(err, ReportFailed) || errors.Is(err, ReportTimedOut) {
+			// the report will never be ready, so the next sync must request another
+			logf("Abandoning report %s; the next sync will request a new one", state.ReportId)
+			return 0, errors.Join(err, job.Clear())
+		}
+		if err != nil {
+			return 0, err
+		}
+		path := filepath.Join(workDir, fmt.Sprintf("%s-report-%s.csv.age", p.statType, state.ReportId))
+		logf("Downloading report %s to %q...", state.ReportId, path)
+		if err = DownloadSmsReport(url, path, true); err != nil {
+			_ = os.Remove(path)
+			return 0, err
+		}
+		state.Stage, state.ReportPath = SyncDownloaded, path
+		if err = job.Save(state); err != nil {
+			return 0, err
+		}
+	}
+	logf("Importing report %s...", state.ReportId)
+	records, err := p.importReport(state.ReportPath)
+	if err != nil {
+		return 0, err
+	}
+	logf("Merging %d records into the %s history...", len(records), p.noun)
+	added, err := p.store.write(records, true)
+	if err != nil {
+		return 0, err
+	}
+	p.install(records)
+	if err = job.Clear(); err != nil {
+		return added, err
+	}
+	_ = os.Remove(state.ReportPath)
+	return added, nil
+}
+
+// WaitForSmsReport polls Dialpad until the requested report is ready, waiting
+// longer between each poll (see [ReportPollMinWait]), and returns its URL.
+// It gives up if the context is done, if the report fails (see
+// [GetSmsReportDownloadUrl]), or if it isn't ready by [ReportPollTimeout].
+func WaitForSmsReport(ctx context.Context, id string) (string, error) {
+	wait := ReportPollMinWait
+	deadline := time.Now().Add(ReportPollTimeout)
+	for {
+		url, err := GetSmsReportDownloadUrl(id)
+		if err != nil || url != "" {
+			return url, err
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("%w: report %s not ready after %s", ReportTimedOut, id, ReportPollTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(min(wait, time.Until(deadline))):
+		}
+		wait = min(2*wait, ReportPollMaxWait)
+	}
+}
+
+// LastEventDate returns the date of the latest event (in UnixMicro), or zero if there are none.
+func LastEventDate(events []SmsEvent) int64 {
+	return lastRecordDate(events)
+}
+
+func lastRecordDate[T historyRecord](records []T) int64 {
+	var last int64
+	for _, record := range records {
+		last = max(last, record.recordDate())
+	}
+	return last
+}
+
+// MergeSmsEvents adds the events that aren't already in the existing ones,
+// as identified by their message IDs, and returns all the events in date order
+// along with the number that were added.  Events with no message ID are only
+// added if they aren't identical to an existing event.
+func MergeSmsEvents(existing, added []SmsEvent) ([]SmsEvent, int) {
+	return mergeRecords(existing, added, smsEventEqual)
+}
+
+// mergeRecords adds the records that aren't already in the existing ones,
+// as [MergeSmsEvents] does, using equal to compare records with no ID.
+func mergeRecords[T historyRecord](existing, added []T, equal func(a, b T) bool) ([]T, int) {
+	ids := make(map[string]bool, len(existing))
+	for _, record := range existing {
+		if id := record.recordId(); id != "" {
+			ids[id] = true
+		}
+	}
+	merged := slices.Clone(existing)
+	count := 0
+	for _, record := range added {
+		if id := record.recordId(); id != "" {
+			if ids[id] {
+				continue
+			}
+			ids[id] = true
+		} else if slices.ContainsFunc(merged, func(r T) bool { return equal(r, record) }) {
+			continue
+		}
+		merged = append(merged, record)
+		count++
+	}
+	slices.SortStableFunc(merged, func(a, b T) int {
+		return cmp.Compare(a.recordDate(), b.recordDate())
+	})
+	return merged, count
+}
+
+func smsEventEqual(a, b SmsEvent) bool {
+	return a.Date == b.Date && a.Email == b.Email && a.Direction == b.Direction &&
+		a.FromPhone == b.FromPhone && slices.Equal(a.ToPhones, b.ToPhones) && a.Text == b.Text
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package history
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestMergeSmsEvents(t *testing.T) {
+	existing := []SmsEvent{
+		{Date: 1, MessageId: "a", Text: "one"},
+		{Date: 3, MessageId: "c", Text: "three"},
+		{Date: 4, Text: "no id"},
+	}
+	added := []SmsEvent{
+		{Date: 3, MessageId: "c", Text: "three again"},
+		{Date: 2, MessageId: "b", Text: "two"},
+		{Date: 4, Text: "no id"},
+		{Date: 5, MessageId: "d", Text: "five"},
+		{Date: 5, MessageId: "d", Text: "five again"},
+	}
+	merged, count := MergeSmsEvents(existing, added)
+	expected := []SmsEvent{
+		{Date: 1, MessageId: "a", Text: "one"},
+		{Date: 2, MessageId: "b", Text: "two"},
+		{Date: 3, MessageId: "c", Text: "three"},
+		{Date: 4, Text: "no id"},
+		{Date: 5, MessageId: "d", Text: "five"},
+	}
+	if diff := deep.Equal(merged, expected); diff != nil {
+		t.Error(diff)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 events added, got %d", count)
+	}
+	if len(existing) != 3 || existing[1].MessageId != "c" {
+		t.Errorf("existing events were changed: %v", existing)
+	}
+	if last := LastEventDate(merged); last != 5 {
+		t.Errorf("expected the last date to be 5, got %d", last)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/clickonetwo/automations/dialpad/internal/contacts"
+	"github.com/clickonetwo/automations/phonenum"
 )
 
 var (
@@ -28,14 +29,18 @@ func init() {
 	PT = loc
 }
 
-func RequestForm(name string, phone string, events []SmsEvent) []byte {
-	labelString := contacts.FormatForHTML(phone)
+// RequestForm is the page showing the texts and calls with a phone, interleaved by date.
+func RequestForm(name, phone, ext string, events []SmsEvent, calls []CallRecord) []byte {
+	labelString := contacts.FormatNumberHTML(phonenum.Number{E164: phone, Extension: ext})
 	if name != "" && name != contacts.UnknownName {
 		labelString = html.EscapeString(name)
+		if ext != "" {
+			labelString += "&nbsp;(x" + html.EscapeString(ext) + ")"
+		}
 	}
 	head := fmt.Sprintf(`
 <head>
-	<title>SMS History: %s</title>
+	<title>History: %s</title>
 	<meta charset="utf-8" />
 	<style>
 		body {
@@ -62,6 +67,9 @@ func RequestForm(name string, phone string, events []SmsEvent) []byte {
 			width: 100%%;
 			border: 1px solid black;
 		}
+		.call {
+			font-style: italic;
+		}
 		th, td {
 			border: 1px solid black;
 			padding-top: 2px;
@@ -80,21 +88,21 @@ func RequestForm(name string, phone string, events []SmsEvent) []byte {
 </form>`
 	page := `<!DOCTYPE html><html>` + head + `<body>`
 	page += form
-	if len(events) == 0 {
+	if len(events) == 0 && len(calls) == 0 {
 		if phone != "" {
-			page += fmt.Sprintf(`<p class="message">You have no text history with %s</p>`, phone)
+			page += fmt.Sprintf(`<p class="message">You have no text or call history with %s</p>`, phone)
 		} else {
 			page += fmt.Sprintf(`<p class="message">Please specify a phone number</p>`)
 		}
 	} else {
-		page += threadTable(labelString, phone, events)
+		page += threadTable(labelString, phone, events, calls)
 	}
 	page += `<p class="logout"><a href="/logout">Logout</a></p>`
 	page += `</body></html>`
 	return []byte(page)
 }
 
-func threadTable(label, phone string, events []SmsEvent) string {
+func threadTable(label, phone string, events []SmsEvent, calls []CallRecord) string {
 	tableHdr := fmt.Sprintf(`
 <table>
 <tr>
@@ -103,13 +111,27 @@ func threadTable(label, phone string, events []SmsEvent) string {
 	<th style="width:"5%%">When</th>
 </tr>`, label)
 	tableFooter := `</table>`
-	var rows []string
-	for _, event := range events {
-		start := `<tr><td>`
-		leftMiddle := `</td><td>`
-		rightMiddle := `</td><td style="background-color:#D6EEEE">`
-		ts := time.UnixMicro(event.Date).In(PT).Format("1/2/06 3:04PM")
+	start := `<tr><td>`
+	leftMiddle := `</td><td>`
+	rightMiddle := `</td><td style="background-color:#D6EEEE">`
+	row := func(date int64, content string, fromThem bool) string {
+		ts := time.UnixMicro(date).In(PT).Format("1/2/06 3:04PM")
 		end := fmt.Sprintf("</td><td style=\"color:grey\">%s</td></tr>", ts)
+		if fromThem {
+			return start + rightMiddle + content + end
+		}
+		return start + content + leftMiddle + end
+	}
+	var rows []string
+	for len(events) > 0 || len(calls) > 0 {
+		if len(calls) > 0 && (len(events) == 0 || calls[0].Date < events[0].Date) {
+			call := calls[0]
+			calls = calls[1:]
+			rows = append(rows, row(call.Date, callDescription(call), call.Direction == "inbound"))
+			continue
+		}
+		event := events[0]
+		events = events[1:]
 		var content []string
 		if event.Text != "" {
 			content = append(content, html.EscapeString(event.Text))
@@ -117,20 +139,35 @@ func threadTable(label, phone string, events []SmsEvent) string {
 		if event.MmsUrl != "" {
 			content = append(content, fmt.Sprintf("<img src=%q />", event.MmsUrl))
 		}
-		var row string
+		var r string
 		for _, c := range content {
-			if event.FromPhone == phone {
-				row = start + rightMiddle + c + end
-			} else {
-				row = start + c + leftMiddle + end
-			}
+			r = row(event.Date, c, event.FromPhone == phone)
 		}
-		rows = append(rows, row)
+		rows = append(rows, r)
 	}
 	tableBody := strings.Join(rows, "")
 	return tableHdr + tableBody + tableFooter
 }
 
+// callDescription describes a call for the thread table.
+func callDescription(call CallRecord) string {
+	var desc string
+	switch {
+	case call.Voicemail:
+		desc = "Voicemail"
+	case call.Duration == 0 && call.Direction == "outbound":
+		desc = "No answer"
+	case call.Duration == 0:
+		desc = "Missed call"
+	default:
+		desc = "Call, " + call.Duration.String()
+	}
+	if call.WasRecorded {
+		desc += " (recorded)"
+	}
+	return `<span class="call">&#128222; ` + desc + `</span>`
+}
+
 func ServerErrorForm(name, phone string) []byte {
 	label := phone
 	if name != "" && name != contacts.UnknownName {
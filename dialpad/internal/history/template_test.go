@@ -19,18 +19,18 @@ func TestHistoryForm(t *testing.T) {
 		t.Fatal(err)
 	}
 	thread := SelectThreadByEmailPhone("anuar.arriaga@oasislegalservices.org", "+14158234525", events)
-	page := RequestForm("Moises Someone", "+14158234525", thread)
+	page := RequestForm("Moises Someone", "+14158234525", "", thread, nil)
 	err = os.WriteFile("../../local/test-thread-1.html", []byte(page), 0644)
 	if err != nil {
 		t.Fatal(err)
 	}
 	thread = SelectThreadByEmailPhone("anuar.arriaga@oasislegalservices.org", "+15109260499", events)
-	page = RequestForm("Daniel Brotsky", "+15109260499", thread)
+	page = RequestForm("Daniel Brotsky", "+15109260499", "12", thread, nil)
 	err = os.WriteFile("../../local/test-thread-2.html", []byte(page), 0644)
 	if err != nil {
 		t.Fatal(err)
 	}
-	page = RequestForm(contacts.UnknownName, "+15109260499", nil)
+	page = RequestForm(contacts.UnknownName, "+15109260499", "12", nil, nil)
 	err = os.WriteFile("../../local/test-thread-3.html", []byte(page), 0644)
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io"
+	"os"
+
+	"filippo.io/age"
+)
+
+// SaveEncryptedGob gob-encodes the value and saves it, age-encrypted, at the given path.
+func SaveEncryptedGob(path string, value any) error {
+	myself, err := age.ParseX25519Recipient(GetConfig().AgePublicKey)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	encryptedWriter, err := age.Encrypt(f, myself)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(encryptedWriter).Encode(value)
+	if err != nil {
+		encryptedWriter.Close()
+		return err
+	}
+	return encryptedWriter.Close()
+}
+
+// LoadEncryptedGob decrypts and decodes the value saved at the given path.
+//
+// The value must be a pointer to the type of value that was saved.
+func LoadEncryptedGob(path string, value any) error {
+	myself, err := age.ParseX25519Identity(GetConfig().AgeSecretKey)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gobStream, err := age.Decrypt(f, myself)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(gobStream).Decode(value)
+}
+
+// S3PutEncrypted stores the content, age-encrypted, in the named blob.
+func S3PutEncrypted(ctx context.Context, blobname string, content []byte) error {
+	myself, err := age.ParseX25519Recipient(GetConfig().AgePublicKey)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "blob-*.age")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	encryptedWriter, err := age.Encrypt(f, myself)
+	if err != nil {
+		return err
+	}
+	if _, err = encryptedWriter.Write(content); err != nil {
+		encryptedWriter.Close()
+		return err
+	}
+	if err = encryptedWriter.Close(); err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, 0); err != nil {
+		return err
+	}
+	return S3PutBlob(ctx, blobname, f)
+}
+
+// S3GetEncrypted returns the decrypted content of a blob stored by [S3PutEncrypted].
+// If there's no such blob, the error is one that [IsBlobNotFound] recognizes.
+func S3GetEncrypted(ctx context.Context, blobname string) ([]byte, error) {
+	myself, err := age.ParseX25519Identity(GetConfig().AgeSecretKey)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "blob-*.age")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err = S3GetBlob(ctx, blobname, f); err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	plain, err := age.Decrypt(f, myself)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(plain)
+}
+
+// S3PutEncryptedGob gob-encodes the value and stores it, age-encrypted, in the named blob.
+func S3PutEncryptedGob(ctx context.Context, blobname string, value any) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return err
+	}
+	return S3PutEncrypted(ctx, blobname, buf.Bytes())
+}
+
+// S3GetEncryptedGob decrypts and decodes the value stored by [S3PutEncryptedGob].
+//
+// The value must be a pointer to the type of value that was stored.
+func S3GetEncryptedGob(ctx context.Context, blobname string, value any) error {
+	content, err := S3GetEncrypted(ctx, blobname)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(content)).Decode(value)
+}
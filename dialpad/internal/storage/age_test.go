@@ -0,0 +1,33 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/google/uuid"
+)
+
+func TestSaveLoadEncryptedGob(t *testing.T) {
+	if err := PushConfig("ci"); err != nil {
+		t.Fatal(err)
+	}
+	defer PopConfig()
+	path := "/tmp/" + uuid.New().String() + ".gob.age"
+	saved := map[string][]string{"one": {"a", "b"}, "two": nil}
+	if err := SaveEncryptedGob(path, saved); err != nil {
+		t.Fatal(err)
+	}
+	var loaded map[string][]string
+	if err := LoadEncryptedGob(path, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(saved, loaded); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -8,14 +8,25 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// IsBlobNotFound reports whether an error from [S3GetBlob] means
+// there's no blob with the requested name.
+func IsBlobNotFound(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	return errors.As(err, &noSuchKey)
+}
+
 func S3GetBlob(ctx context.Context, blobname string, blobfile *os.File) error {
 	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(GetConfig().AwsRegion))
 	if err != nil {
@@ -56,3 +67,55 @@ func S3PutBlob(ctx context.Context, blobname string, blobfile *os.File) error {
 	})
 	return err
 }
+
+// S3DeleteBlob removes the named blob.  It's not an error if there's no such blob.
+func S3DeleteBlob(ctx context.Context, blobname string) error {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(GetConfig().AwsRegion))
+	if err != nil {
+		return err
+	}
+	client := s3.NewFromConfig(cfg)
+	env := GetConfig()
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(env.AwsBucket),
+		Key:    aws.String(env.AwsDialpadFolder + "/" + blobname),
+	})
+	return err
+}
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// S3ListBlobs lists the blobs whose names start with the given prefix.
+func S3ListBlobs(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(GetConfig().AwsRegion))
+	if err != nil {
+		return nil, err
+	}
+	client := s3.NewFromConfig(cfg)
+	env := GetConfig()
+	folder := env.AwsDialpadFolder + "/"
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(env.AwsBucket),
+		Prefix: aws.String(folder + prefix),
+	})
+	var blobs []BlobInfo
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			blobs = append(blobs, BlobInfo{
+				Name:     strings.TrimPrefix(aws.ToString(obj.Key), folder),
+				Size:     aws.ToInt64(obj.Size),
+				Modified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return blobs, nil
+}
@@ -43,3 +43,37 @@ func TestS3GetPutBlob(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestS3ListBlobs(t *testing.T) {
+	err := PushConfig("testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer PopConfig()
+	blobs, err := S3ListBlobs(context.Background(), "sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 || blobs[0].Name != "sample.csv" {
+		t.Errorf("got %v, want just sample.csv", blobs)
+	}
+}
+
+func TestS3PutGetEncryptedGob(t *testing.T) {
+	err := PushConfig("testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer PopConfig()
+	saved := map[string][]string{"one": {"a", "b"}, "two": nil}
+	if err = S3PutEncryptedGob(context.Background(), "test-encrypted.gob.age", saved); err != nil {
+		t.Fatal(err)
+	}
+	var loaded map[string][]string
+	if err = S3GetEncryptedGob(context.Background(), "test-encrypted.gob.age", &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || len(loaded["one"]) != 2 || loaded["one"][1] != "b" {
+		t.Errorf("got %v, want %v", loaded, saved)
+	}
+}
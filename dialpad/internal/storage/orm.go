@@ -125,6 +125,38 @@ func StoreString[T String](ctx context.Context, obj T, val string) error {
 	return nil
 }
 
+// StoreStringIfAbsent stores the string only if none is stored, and reports
+// whether it was stored.  If ttl is positive, the stored string expires after it.
+func StoreStringIfAbsent[T String](ctx context.Context, obj T, val string, ttl time.Duration) (bool, error) {
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := db.SetNX(ctx, key, val, ttl)
+	if err := res.Err(); err != nil {
+		return false, err
+	}
+	return res.Val(), nil
+}
+
+var deleteIfEqualScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// DeleteStringIfEqual deletes the stored string only if it has the given
+// value, and reports whether it was deleted.
+func DeleteStringIfEqual[T String](ctx context.Context, obj T, val string) (bool, error) {
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := deleteIfEqualScript.Run(ctx, db, []string{key}, val)
+	count, err := res.Int()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 type Set interface {
 	~string
 	Storable
@@ -176,6 +208,49 @@ func RemoveMembers[T Set](ctx context.Context, obj T, members ...string) error {
 	return nil
 }
 
+type Map interface {
+	~string
+	Storable
+}
+
+func FetchMap[T Map](ctx context.Context, obj T) (map[string]string, error) {
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := db.HGetAll(ctx, key)
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	return res.Val(), nil
+}
+
+func StoreMapFields[T Map](ctx context.Context, obj T, fields map[string]string) error {
+	if len(fields) == 0 {
+		// nothing to store
+		return nil
+	}
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := db.HSet(ctx, key, fields)
+	if err := res.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func RemoveMapFields[T Map](ctx context.Context, obj T, fields ...string) error {
+	if len(fields) == 0 {
+		// nothing to delete
+		return nil
+	}
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := db.HDel(ctx, key, fields...)
+	if err := res.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
 type SortedSet interface {
 	~string
 	Storable
@@ -276,3 +351,53 @@ func RemoveElement[T List](ctx context.Context, obj T, count int64, element stri
 	}
 	return nil
 }
+
+type Stream interface {
+	Storable
+	~string
+}
+
+// A StreamEntry is an entry in a stream: its ID, which is assigned
+// when it's added, and its fields.
+type StreamEntry struct {
+	Id     string
+	Fields map[string]string
+}
+
+// AddStreamEntry appends an entry with the given fields to the stream,
+// and returns the ID assigned to it.
+func AddStreamEntry[T Stream](ctx context.Context, obj T, fields map[string]string) (string, error) {
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := db.XAdd(ctx, &redis.XAddArgs{Stream: key, Values: fields})
+	if err := res.Err(); err != nil {
+		return "", err
+	}
+	return res.Val(), nil
+}
+
+// FetchStreamRange returns up to count entries of the stream whose IDs are
+// between start and end (inclusive), oldest first.  Use "-" and "+" for the
+// first and last IDs, and a count of 0 for all the entries.
+func FetchStreamRange[T Stream](ctx context.Context, obj T, start, end string, count int64) ([]StreamEntry, error) {
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	var res *redis.XMessageSliceCmd
+	if count > 0 {
+		res = db.XRangeN(ctx, key, start, end, count)
+	} else {
+		res = db.XRange(ctx, key, start, end)
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	entries := make([]StreamEntry, len(res.Val()))
+	for i, msg := range res.Val() {
+		fields := make(map[string]string, len(msg.Values))
+		for k, v := range msg.Values {
+			fields[k] = fmt.Sprint(v)
+		}
+		entries[i] = StreamEntry{Id: msg.ID, Fields: fields}
+	}
+	return entries, nil
+}
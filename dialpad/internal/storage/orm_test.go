@@ -209,6 +209,70 @@ func TestFetchSetFetchString(t *testing.T) {
 	}
 }
 
+func TestStoreStringIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	id := OrmTestString(uuid.New().String())
+	if stored, err := StoreStringIfAbsent(ctx, id, "first", time.Minute); err != nil || !stored {
+		t.Errorf("StoreStringIfAbsent of missing string failed (%v) or didn't store", err)
+	}
+	if stored, err := StoreStringIfAbsent(ctx, id, "second", time.Minute); err != nil || stored {
+		t.Errorf("StoreStringIfAbsent of present string failed (%v) or stored", err)
+	}
+	if deleted, err := DeleteStringIfEqual(ctx, id, "second"); err != nil || deleted {
+		t.Errorf("DeleteStringIfEqual of a different value failed (%v) or deleted", err)
+	}
+	if deleted, err := DeleteStringIfEqual(ctx, id, "first"); err != nil || !deleted {
+		t.Errorf("DeleteStringIfEqual of the stored value failed (%v) or didn't delete", err)
+	}
+	if val, err := FetchString(ctx, id); err != nil || val != "" {
+		t.Errorf("expected the string to be deleted, got %q (%v)", val, err)
+	}
+}
+
+type OrmTestMap string
+
+func (s OrmTestMap) StoragePrefix() string {
+	return "ormTestMap:"
+}
+
+func (s OrmTestMap) StorageId() string {
+	return string(s)
+}
+
+func TestStoreFetchRemoveMapFields(t *testing.T) {
+	ctx := context.Background()
+	id := OrmTestMap(uuid.New().String())
+	if found, err := FetchMap(ctx, id); err != nil || len(found) != 0 {
+		t.Errorf("FetchMap of empty map failed (%v), expected success with no fields: %#v", err, found)
+	}
+	saved := map[string]string{"a": "1", "b": "2", "c": "3"}
+	if err := StoreMapFields(ctx, id, saved); err != nil {
+		t.Errorf("Failed to store fields: %v", err)
+	}
+	if err := StoreMapFields(ctx, id, nil); err != nil {
+		t.Errorf("Failed to store no fields: %v", err)
+	}
+	if found, err := FetchMap(ctx, id); err != nil {
+		t.Errorf("FetchMap failed: %v", err)
+	} else if diff := deep.Equal(found, saved); diff != nil {
+		t.Errorf("FetchMap returned wrong fields: %v", diff)
+	}
+	if err := RemoveMapFields(ctx, id, "b", "c"); err != nil {
+		t.Errorf("Failed to remove fields: %v", err)
+	}
+	if err := RemoveMapFields(ctx, id); err != nil {
+		t.Errorf("Failed to remove no fields: %v", err)
+	}
+	if found, err := FetchMap(ctx, id); err != nil {
+		t.Errorf("FetchMap failed: %v", err)
+	} else if diff := deep.Equal(found, map[string]string{"a": "1"}); diff != nil {
+		t.Errorf("FetchMap returned wrong fields: %v", diff)
+	}
+	if err := DeleteStorage(ctx, id); err != nil {
+		t.Errorf("Failed to delete stored data for %q: %v", id, err)
+	}
+}
+
 type OrmTestSet string
 
 func (s OrmTestSet) StoragePrefix() string {
@@ -386,3 +450,48 @@ func TestFetchOneBlocking(t *testing.T) {
 		t.Errorf("FetchRange of remaining list is:\n%v\ndifferences are:\n%v", remaining, diff)
 	}
 }
+
+type OrmTestStream string
+
+func (s OrmTestStream) StoragePrefix() string {
+	return "ormTestStream:"
+}
+
+func (s OrmTestStream) StorageId() string {
+	return string(s)
+}
+
+func TestAddFetchStreamEntries(t *testing.T) {
+	ctx := context.Background()
+	id := OrmTestStream(uuid.New().String())
+	defer func() {
+		if err := DeleteStorage(ctx, &id); err != nil {
+			t.Errorf("Failed to delete stored data for %q: %v", id, err)
+		}
+	}()
+	if entries, err := FetchStreamRange(ctx, id, "-", "+", 0); err != nil || len(entries) != 0 {
+		t.Errorf("FetchStreamRange of empty stream failed, expected success with no entries")
+	}
+	var ids []string
+	for _, val := range []string{"a", "b", "c"} {
+		entryId, err := AddStreamEntry(ctx, id, map[string]string{"val": val})
+		if err != nil {
+			t.Fatalf("Failed to add %q: %v", val, err)
+		}
+		ids = append(ids, entryId)
+	}
+	if entries, err := FetchStreamRange(ctx, id, "-", "+", 0); err != nil {
+		t.Errorf("FetchStreamRange failed: %v", err)
+	} else if diff := deep.Equal(entries, []StreamEntry{
+		{Id: ids[0], Fields: map[string]string{"val": "a"}},
+		{Id: ids[1], Fields: map[string]string{"val": "b"}},
+		{Id: ids[2], Fields: map[string]string{"val": "c"}},
+	}); diff != nil {
+		t.Errorf("FetchStreamRange differences: %v", diff)
+	}
+	if entries, err := FetchStreamRange(ctx, id, ids[1], "+", 1); err != nil {
+		t.Errorf("FetchStreamRange failed: %v", err)
+	} else if len(entries) != 1 || entries[0].Fields["val"] != "b" {
+		t.Errorf("FetchStreamRange with count returned %v", entries)
+	}
+}
@@ -7,6 +7,8 @@
 package users
 
 import (
+	"sync"
+
 	"github.com/clickonetwo/automations/dialpad/internal/storage"
 )
 
@@ -16,7 +18,32 @@ var (
 	Readers        map[string]Entry
 )
 
+// usersLock protects Admins and Readers, which are replaced (but never
+// changed) when the users are reloaded while the server is running.
+var usersLock sync.RWMutex
+
+// InstallUsers makes the given users the known admins and readers.
+//
+// SuperAdmins in Dialpad become admins in this server.
+// Every user becomes a reader in this server.
+func InstallUsers(users []Entry) {
+	readers, admins := make(map[string]Entry), make(map[string]Entry)
+	for _, user := range users {
+		readers[user.Id] = user
+		if user.IsSuperAdmin {
+			admins[user.Id] = user
+		}
+	}
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	Readers, Admins = readers, admins
+}
+
+// ListUsers returns the users with the given capability.
+// The returned map must not be changed.
 func ListUsers(capability string) map[string]Entry {
+	usersLock.RLock()
+	defer usersLock.RUnlock()
 	switch capability {
 	case "admin":
 		return Admins
@@ -32,6 +59,8 @@ func CheckAuth(userId, capability string) string {
 	if userId == env.MasterAdminId {
 		return env.MasterAdminEmail
 	}
+	usersLock.RLock()
+	defer usersLock.RUnlock()
 	switch capability {
 	case "admin":
 		if admin, ok := Admins[userId]; ok {
@@ -81,21 +81,12 @@ func DownloadUsersList() ([]Entry, error) {
 	return events, nil
 }
 
-// LoadUsers loads the users list from AWS.
-//
-// SuperAdmins in Dialpad become admins in this server.
-// Every user becomes a reader in this server.
+// LoadUsers loads the users list from AWS and installs it (see [InstallUsers]).
 func LoadUsers() error {
 	users, err := DownloadUsersList()
 	if err != nil {
 		return err
 	}
-	Readers, Admins = make(map[string]Entry), make(map[string]Entry)
-	for _, user := range users {
-		Readers[user.Id] = user
-		if user.IsSuperAdmin {
-			Admins[user.Id] = user
-		}
-	}
+	InstallUsers(users)
 	return nil
 }
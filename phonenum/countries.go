@@ -0,0 +1,342 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package phonenum
+
+import (
+	"slices"
+	"strings"
+)
+
+// A Country is an ITU country calling code, and the rules for numbers in it.
+//
+// Regions are the ISO 3166 codes of the regions that share the calling code,
+// with the main one first.  MinDigits and MaxDigits bound the length of the
+// national significant number (the digits after the calling code), and
+// TrunkPrefix is what's dialed before that number within the country.
+// Groups are the display groupings of national numbers of particular lengths;
+// numbers of other lengths are grouped in threes.
+type Country struct {
+	CallingCode string
+	Regions     []string
+	MinDigits   int
+	MaxDigits   int
+	TrunkPrefix string
+	Groups      [][]int
+}
+
+// Countries is the table of ITU country calling codes.
+//
+//goland:noinspection SpellCheckingInspection
+var Countries = []Country{
+	{"1", []string{
+		"US", "CA", "AG", "AI", "AS", "BB", "BM", "BS", "DM", "DO", "GD", "GU", "JM", "KN", "KY",
+		"LC", "MP", "MS", "PR", "SX", "TC", "TT", "VC", "VG", "VI",
+	}, 10, 10, "1", nil},
+	{"7", []string{"RU", "KZ"}, 10, 10, "8", [][]int{{3, 3, 2, 2}}},
+	{"20", []string{"EG"}, 8, 10, "0", [][]int{{3, 3, 4}}},
+	{"27", []string{"ZA"}, 9, 9, "0", [][]int{{2, 3, 4}}},
+	{"30", []string{"GR"}, 10, 10, "", [][]int{{3, 3, 4}}},
+	{"31", []string{"NL"}, 9, 9, "0", [][]int{{1, 4, 4}}},
+	{"32", []string{"BE"}, 8, 9, "0", [][]int{{1, 3, 2, 2}, {3, 2, 2, 2}}},
+	{"33", []string{"FR"}, 9, 9, "0", [][]int{{1, 2, 2, 2, 2}}},
+	{"34", []string{"ES"}, 9, 9, "", [][]int{{3, 3, 3}}},
+	{"36", []string{"HU"}, 8, 9, "06", [][]int{{1, 3, 4}, {2, 3, 4}}},
+	{"39", []string{"IT", "VA"}, 6, 11, "", [][]int{{3, 3, 4}}},
+	{"40", []string{"RO"}, 9, 9, "0", [][]int{{3, 3, 3}}},
+	{"41", []string{"CH"}, 9, 9, "0", [][]int{{2, 3, 2, 2}}},
+	{"43", []string{"AT"}, 4, 13, "0", nil},
+	{"44", []string{"GB", "GG", "IM", "JE"}, 7, 10, "0", [][]int{{4, 6}}},
+	{"45", []string{"DK"}, 8, 8, "", [][]int{{2, 2, 2, 2}}},
+	{"46", []string{"SE"}, 6, 10, "0", [][]int{{2, 3, 2, 2}}},
+	{"47", []string{"NO", "SJ"}, 5, 8, "", [][]int{{3, 2, 3}}},
+	{"48", []string{"PL"}, 9, 9, "", [][]int{{3, 3, 3}}},
+	{"49", []string{"DE"}, 5, 14, "0", nil},
+	{"51", []string{"PE"}, 8, 9, "0", [][]int{{3, 3, 3}}},
+	{"52", []string{"MX"}, 10, 10, "", [][]int{{2, 4, 4}}},
+	{"53", []string{"CU"}, 6, 8, "0", [][]int{{1, 3, 4}}},
+	{"54", []string{"AR"}, 10, 11, "0", [][]int{{2, 4, 4}, {1, 2, 4, 4}}},
+	{"55", []string{"BR"}, 10, 11, "0", [][]int{{2, 4, 4}, {2, 5, 4}}},
+	{"56", []string{"CL"}, 9, 9, "", [][]int{{1, 4, 4}}},
+	{"57", []string{"CO"}, 8, 10, "0", [][]int{{3, 3, 4}}},
+	{"58", []string{"VE"}, 10, 10, "0", [][]int{{3, 3, 4}}},
+	{"60", []string{"MY"}, 8, 10, "0", [][]int{{2, 3, 4}, {2, 4, 4}}},
+	{"61", []string{"AU", "CC", "CX"}, 5, 9, "0", [][]int{{3, 3, 3}}},
+	{"62", []string{"ID"}, 8, 12, "0", [][]int{{3, 4, 4}}},
+	{"63", []string{"PH"}, 8, 10, "0", [][]int{{3, 3, 4}}},
+	{"64", []string{"NZ"}, 8, 10, "0", [][]int{{1, 3, 4}, {2, 3, 4}}},
+	{"65", []string{"SG"}, 8, 8, "", [][]int{{4, 4}}},
+	{"66", []string{"TH"}, 8, 9, "0", [][]int{{1, 3, 4}, {2, 3, 4}}},
+	{"81", []string{"JP"}, 9, 10, "0", [][]int{{1, 4, 4}, {2, 4, 4}}},
+	{"82", []string{"KR"}, 8, 10, "0", [][]int{{1, 3, 4}, {2, 3, 4}, {2, 4, 4}}},
+	{"84", []string{"VN"}, 9, 10, "0", [][]int{{2, 3, 4}, {3, 3, 4}}},
+	{"86", []string{"CN"}, 9, 11, "0", [][]int{{3, 4, 4}}},
+	{"90", []string{"TR"}, 10, 10, "0", [][]int{{3, 3, 2, 2}}},
+	{"91", []string{"IN"}, 10, 10, "0", [][]int{{5, 5}}},
+	{"92", []string{"PK"}, 9, 10, "0", [][]int{{3, 7}}},
+	{"93", []string{"AF"}, 9, 9, "0", [][]int{{2, 3, 4}}},
+	{"94", []string{"LK"}, 9, 9, "0", [][]int{{2, 3, 4}}},
+	{"95", []string{"MM"}, 7, 10, "0", nil},
+	{"98", []string{"IR"}, 10, 10, "0", [][]int{{3, 3, 4}}},
+	{"211", []string{"SS"}, 9, 9, "0", nil},
+	{"212", []string{"MA", "EH"}, 9, 9, "0", nil},
+	{"213", []string{"DZ"}, 8, 9, "0", nil},
+	{"216", []string{"TN"}, 8, 8, "", nil},
+	{"218", []string{"LY"}, 9, 9, "0", nil},
+	{"220", []string{"GM"}, 7, 7, "", nil},
+	{"221", []string{"SN"}, 9, 9, "", nil},
+	{"222", []string{"MR"}, 8, 8, "", nil},
+	{"223", []string{"ML"}, 8, 8, "", nil},
+	{"224", []string{"GN"}, 8, 9, "", nil},
+	{"225", []string{"CI"}, 8, 10, "", nil},
+	{"226", []string{"BF"}, 8, 8, "", nil},
+	{"227", []string{"NE"}, 8, 8, "", nil},
+	{"228", []string{"TG"}, 8, 8, "", nil},
+	{"229", []string{"BJ"}, 8, 10, "", nil},
+	{"230", []string{"MU"}, 7, 8, "", nil},
+	{"231", []string{"LR"}, 7, 9, "0", nil},
+	{"232", []string{"SL"}, 8, 8, "0", nil},
+	{"233", []string{"GH"}, 9, 9, "0", nil},
+	{"234", []string{"NG"}, 8, 10, "0", nil},
+	{"235", []string{"TD"}, 8, 8, "", nil},
+	{"236", []string{"CF"}, 8, 8, "", nil},
+	{"237", []string{"CM"}, 8, 9, "", nil},
+	{"238", []string{"CV"}, 7, 7, "", nil},
+	{"239", []string{"ST"}, 7, 7, "", nil},
+	{"240", []string{"GQ"}, 9, 9, "", nil},
+	{"241", []string{"GA"}, 7, 8, "0", nil},
+	{"242", []string{"CG"}, 9, 9, "", nil},
+	{"243", []string{"CD"}, 9, 9, "0", nil},
+	{"244", []string{"AO"}, 9, 9, "", nil},
+	{"245", []string{"GW"}, 7, 9, "", nil},
+	{"246", []string{"IO"}, 7, 7, "", nil},
+	{"247", []string{"AC"}, 5, 6, "", nil},
+	{"248", []string{"SC"}, 7, 7, "", nil},
+	{"249", []string{"SD"}, 9, 9, "0", nil},
+	{"250", []string{"RW"}, 9, 9, "0", nil},
+	{"251", []string{"ET"}, 9, 9, "0", nil},
+	{"252", []string{"SO"}, 7, 9, "0", nil},
+	{"253", []string{"DJ"}, 8, 8, "", nil},
+	{"254", []string{"KE"}, 9, 10, "0", nil},
+	{"255", []string{"TZ"}, 9, 9, "0", nil},
+	{"256", []string{"UG"}, 9, 9, "0", nil},
+	{"257", []string{"BI"}, 8, 8, "", nil},
+	{"258", []string{"MZ"}, 8, 9, "", nil},
+	{"260", []string{"ZM"}, 9, 9, "0", nil},
+	{"261", []string{"MG"}, 9, 9, "0", nil},
+	{"262", []string{"RE", "YT"}, 9, 9, "0", nil},
+	{"263", []string{"ZW"}, 5, 10, "0", nil},
+	{"264", []string{"NA"}, 8, 9, "0", nil},
+	{"265", []string{"MW"}, 7, 9, "0", nil},
+	{"266", []string{"LS"}, 8, 8, "", nil},
+	{"267", []string{"BW"}, 7, 8, "", nil},
+	{"268", []string{"SZ"}, 8, 8, "", nil},
+	{"269", []string{"KM"}, 7, 7, "", nil},
+	{"290", []string{"SH", "TA"}, 4, 5, "", nil},
+	{"291", []string{"ER"}, 7, 7, "0", nil},
+	{"297", []string{"AW"}, 7, 7, "", nil},
+	{"298", []string{"FO"}, 6, 6, "", nil},
+	{"299", []string{"GL"}, 6, 6, "", nil},
+	{"350", []string{"GI"}, 8, 8, "", nil},
+	{"351", []string{"PT"}, 9, 9, "", nil},
+	{"352", []string{"LU"}, 4, 11, "", nil},
+	{"353", []string{"IE"}, 7, 9, "0", nil},
+	{"354", []string{"IS"}, 7, 9, "", nil},
+	{"355", []string{"AL"}, 8, 9, "0", nil},
+	{"356", []string{"MT"}, 8, 8, "", nil},
+	{"357", []string{"CY"}, 8, 8, "", nil},
+	{"358", []string{"FI", "AX"}, 5, 12, "0", nil},
+	{"359", []string{"BG"}, 7, 9, "0", nil},
+	{"370", []string{"LT"}, 8, 8, "8", nil},
+	{"371", []string{"LV"}, 8, 8, "", nil},
+	{"372", []string{"EE"}, 7, 8, "", nil},
+	{"373", []string{"MD"}, 8, 8, "0", nil},
+	{"374", []string{"AM"}, 8, 8, "0", nil},
+	{"375", []string{"BY"}, 9, 9, "8", nil},
+	{"376", []string{"AD"}, 6, 9, "", nil},
+	{"377", []string{"MC"}, 8, 9, "0", nil},
+	{"378", []string{"SM"}, 6, 10, "", nil},
+	{"380", []string{"UA"}, 9, 9, "0", nil},
+	{"381", []string{"RS"}, 6, 12, "0", nil},
+	{"382", []string{"ME"}, 8, 8, "0", nil},
+	{"383", []string{"XK"}, 8, 9, "0", nil},
+	{"385", []string{"HR"}, 8, 9, "0", nil},
+	{"386", []string{"SI"}, 8, 8, "0", nil},
+	{"387", []string{"BA"}, 8, 9, "0", nil},
+	{"389", []string{"MK"}, 8, 8, "0", nil},
+	{"420", []string{"CZ"}, 9, 9, "", [][]int{{3, 3, 3}}},
+	{"421", []string{"SK"}, 9, 9, "0", [][]int{{3, 3, 3}}},
+	{"423", []string{"LI"}, 7, 9, "", nil},
+	{"500", []string{"FK"}, 5, 5, "", nil},
+	{"501", []string{"BZ"}, 7, 7, "", nil},
+	{"502", []string{"GT"}, 8, 8, "", [][]int{{4, 4}}},
+	{"503", []string{"SV"}, 8, 8, "", [][]int{{4, 4}}},
+	{"504", []string{"HN"}, 8, 8, "", [][]int{{4, 4}}},
+	{"505", []string{"NI"}, 8, 8, "", [][]int{{4, 4}}},
+	{"506", []string{"CR"}, 8, 8, "", [][]int{{4, 4}}},
+	{"507", []string{"PA"}, 7, 8, "", [][]int{{3, 4}, {4, 4}}},
+	{"508", []string{"PM"}, 6, 6, "0", nil},
+	{"509", []string{"HT"}, 8, 8, "", [][]int{{2, 2, 4}}},
+	{"590", []string{"GP", "BL", "MF"}, 9, 9, "0", nil},
+	{"591", []string{"BO"}, 8, 8, "0", nil},
+	{"592", []string{"GY"}, 7, 7, "", nil},
+	{"593", []string{"EC"}, 8, 9, "0", nil},
+	{"594", []string{"GF"}, 9, 9, "0", nil},
+	{"595", []string{"PY"}, 6, 9, "0", nil},
+	{"596", []string{"MQ"}, 9, 9, "0", nil},
+	{"597", []string{"SR"}, 6, 7, "", nil},
+	{"598", []string{"UY"}, 8, 8, "0", nil},
+	{"599", []string{"CW", "BQ"}, 7, 8, "", nil},
+	{"670", []string{"TL"}, 7, 8, "", nil},
+	{"672", []string{"NF"}, 5, 6, "", nil},
+	{"673", []string{"BN"}, 7, 7, "", nil},
+	{"674", []string{"NR"}, 7, 7, "", nil},
+	{"675", []string{"PG"}, 7, 8, "", nil},
+	{"676", []string{"TO"}, 5, 7, "", nil},
+	{"677", []string{"SB"}, 5, 7, "", nil},
+	{"678", []string{"VU"}, 5, 7, "", nil},
+	{"679", []string{"FJ"}, 7, 7, "", nil},
+	{"680", []string{"PW"}, 7, 7, "", nil},
+	{"681", []string{"WF"}, 6, 6, "", nil},
+	{"682", []string{"CK"}, 5, 5, "", nil},
+	{"683", []string{"NU"}, 4, 7, "", nil},
+	{"685", []string{"WS"}, 5, 7, "", nil},
+	{"686", []string{"KI"}, 5, 8, "", nil},
+	{"687", []string{"NC"}, 6, 6, "", nil},
+	{"688", []string{"TV"}, 5, 7, "", nil},
+	{"689", []string{"PF"}, 6, 8, "", nil},
+	{"690", []string{"TK"}, 4, 7, "", nil},
+	{"691", []string{"FM"}, 7, 7, "", nil},
+	{"692", []string{"MH"}, 7, 7, "", nil},
+	{"800", []string{"001"}, 8, 8, "", nil},
+	{"808", []string{"001"}, 8, 8, "", nil},
+	{"850", []string{"KP"}, 8, 10, "0", nil},
+	{"852", []string{"HK"}, 8, 8, "", [][]int{{4, 4}}},
+	{"853", []string{"MO"}, 8, 8, "", [][]int{{4, 4}}},
+	{"855", []string{"KH"}, 8, 9, "0", nil},
+	{"856", []string{"LA"}, 8, 10, "0", nil},
+	{"870", []string{"001"}, 9, 9, "", nil},
+	{"878", []string{"001"}, 10, 12, "", nil},
+	{"880", []string{"BD"}, 6, 10, "0", nil},
+	{"881", []string{"001"}, 9, 10, "", nil},
+	{"882", []string{"001"}, 7, 12, "", nil},
+	{"883", []string{"001"}, 9, 12, "", nil},
+	{"886", []string{"TW"}, 8, 9, "0", [][]int{{1, 3, 4}, {3, 3, 3}}},
+	{"888", []string{"001"}, 11, 11, "", nil},
+	{"960", []string{"MV"}, 7, 7, "", nil},
+	{"961", []string{"LB"}, 7, 8, "0", nil},
+	{"962", []string{"JO"}, 8, 9, "0", nil},
+	{"963", []string{"SY"}, 8, 9, "0", nil},
+	{"964", []string{"IQ"}, 8, 10, "0", nil},
+	{"965", []string{"KW"}, 7, 8, "", nil},
+	{"966", []string{"SA"}, 9, 9, "0", [][]int{{2, 3, 4}}},
+	{"967", []string{"YE"}, 7, 9, "0", nil},
+	{"968", []string{"OM"}, 7, 8, "", nil},
+	{"970", []string{"PS"}, 8, 9, "0", nil},
+	{"971", []string{"AE"}, 8, 9, "0", [][]int{{1, 3, 4}, {2, 3, 4}}},
+	{"972", []string{"IL"}, 8, 9, "0", [][]int{{1, 3, 4}, {2, 3, 4}}},
+	{"973", []string{"BH"}, 8, 8, "", nil},
+	{"974", []string{"QA"}, 7, 8, "", nil},
+	{"975", []string{"BT"}, 7, 8, "", nil},
+	{"976", []string{"MN"}, 8, 8, "", nil},
+	{"977", []string{"NP"}, 8, 10, "0", nil},
+	{"979", []string{"001"}, 9, 9, "", nil},
+	{"992", []string{"TJ"}, 9, 9, "", nil},
+	{"993", []string{"TM"}, 8, 8, "8", nil},
+	{"994", []string{"AZ"}, 9, 9, "0", nil},
+	{"995", []string{"GE"}, 9, 9, "0", nil},
+	{"996", []string{"KG"}, 9, 9, "0", nil},
+	{"998", []string{"UZ"}, 9, 9, "", nil},
+}
+
+var (
+	countriesByCode   = make(map[string]*Country)
+	countriesByRegion = make(map[string]*Country)
+)
+
+func init() {
+	for i := range Countries {
+		c := &Countries[i]
+		countriesByCode[c.CallingCode] = c
+		for _, region := range c.Regions {
+			if _, ok := countriesByRegion[region]; !ok {
+				countriesByRegion[region] = c
+			}
+		}
+	}
+}
+
+// CountryForRegion returns the country whose calling code is used in the
+// given region (an ISO 3166 code, such as "US" or "GB").
+func CountryForRegion(region string) (*Country, bool) {
+	c, ok := countriesByRegion[strings.ToUpper(region)]
+	return c, ok
+}
+
+// IsRegion tells whether the region (an ISO 3166 code) has a calling code.
+func IsRegion(region string) bool {
+	c, ok := CountryForRegion(region)
+	return ok && c.Regions[0] != "001"
+}
+
+// SplitCallingCode finds the country whose calling code starts the given
+// digits (which follow a '+'), and returns it with the national number.
+// Calling codes are prefix-free, so at most one country can match.
+func SplitCallingCode(digits string) (*Country, string, bool) {
+	for n := 1; n <= 3 && n <= len(digits); n++ {
+		if c, ok := countriesByCode[digits[:n]]; ok {
+			return c, digits[n:], true
+		}
+	}
+	return nil, "", false
+}
+
+// CountryOf returns the country of an E.164 phone number.
+func CountryOf(e164 string) (*Country, bool) {
+	if !strings.HasPrefix(e164, "+") {
+		return nil, false
+	}
+	c, _, ok := SplitCallingCode(e164[1:])
+	return c, ok
+}
+
+// RegionOf returns the main region of an E.164 phone number's country,
+// or "" if the country is unknown.  (For a number shared by several regions,
+// it's the main region of the calling code, which may not be the number's own.)
+func RegionOf(e164 string) string {
+	if c, ok := CountryOf(e164); ok {
+		return c.Regions[0]
+	}
+	return ""
+}
+
+// fits tells whether a national number has a valid length for the country.
+func (c *Country) fits(national string) bool {
+	return len(national) >= c.MinDigits && len(national) <= c.MaxDigits
+}
+
+// group splits a national number into its display groups.
+func (c *Country) group(national string) []string {
+	idx := slices.IndexFunc(c.Groups, func(g []int) bool {
+		sum := 0
+		for _, n := range g {
+			sum += n
+		}
+		return sum == len(national)
+	})
+	var groups []string
+	if idx >= 0 {
+		for _, n := range c.Groups[idx] {
+			groups, national = append(groups, national[:n]), national[n:]
+		}
+		return groups
+	}
+	// groups of three, with up to four in the last group
+	for len(national) > 4 {
+		groups, national = append(groups, national[:3]), national[3:]
+	}
+	return append(groups, national)
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package phonenum
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// These patterns recognize the ways people type phone numbers into web forms.
+// They are matched after spaces and dashes are removed, except for zone1NumberFront.
+var (
+	spacesDashesOnly   = regexp.MustCompile(`[-—‑\s]+`)
+	zone1NumberFront   = regexp.MustCompile(`^\s*(\(\d{3}\)\s*\d{3}(?:\s*-?\s*)\d{4})(?:\D|$)`)
+	zone1Plus1         = regexp.MustCompile(`^\(\+?0?0?1\)(\(\d{3}\)\d{3}\d{4})(?:\D|$)`)
+	zone1AreaFront     = regexp.MustCompile(`^(\(\d{3}\)\(\d{3}\)\d{4})(\D|$)`)
+	zone1DoubleArea    = regexp.MustCompile(`^\((\d{3})\)(\((\d{3})\)\d{3}\d{4})(?:\D|$)`)
+	zone1AreaZipArea   = regexp.MustCompile(`^\((\d{3})\)\(\d{5}\)(?:\+?0?0?1)?(\(?(\d{3})\)?\d{3}\d{4})(?:\D|$)`)
+	zone1ZipArea       = regexp.MustCompile(`^\(\+?0?0?1\)\(\d{5}\)(?:\+?0?0?1)?(\(?\d{3}\)?\d{3}\d{4})(?:\D|$)`)
+	zone1ZipFront      = regexp.MustCompile(`^\(\d{5}\)(\(\d{3}\)\d{3}\d{4})(?:\D|$)`)
+	zone1ZipDouble     = regexp.MustCompile(`^\(\d{5}\)\(\d{5}\)(?:\+?0?0?1)?(\(?\d{3}\)?\d{3}\d{4})(?:\D|$)`)
+	zone1DigitsOnly    = regexp.MustCompile(`^(?:\+?1)?(\(?\d{3}\)?\d{7})(?:\D|$)`)
+	zone1AreaTenDigits = regexp.MustCompile(`^\([0+]?0?1?\)\((?:1|\d{3})\)(\d{10})(?:\D|$)`)
+	intlPlus           = regexp.MustCompile(`(^\(?\+0?0?[2-9]\d\d?\)?\(?\d+\)?\d+)(?:\D|$)`)
+	intlNonPlus        = regexp.MustCompile(`(^\(0?[2-9]\d\d?\)\(?\d+\)?\d+)(?:\D|$)`)
+	intlDialingPrefix  = regexp.MustCompile(`^\(011\)(\(?\d+\)?\d+)(?:\D|$)`)
+)
+
+// Extract finds a valid phone number at the start of messy input, such as
+// a web form field where people have typed their numbers (and sometimes
+// their zip codes) in whatever way they like.  Numbers without an explicit
+// country code are taken to be North American.  A trailing extension is kept.
+//
+// Extract is more lenient than [Canonicalize] about North American numbers:
+// as the migration's cleanup always has, it keeps those whose exchange starts
+// with 0 or 1 or whose area code isn't geographic, since those are still
+// what people typed.  Use Canonicalize to tell whether a number is dialable.
+func Extract(s string) (Number, bool) {
+	s, ext := SplitExtension(s)
+	e164 := extractE164(s)
+	if e164 == "" {
+		return Number{}, false
+	}
+	return Number{E164: e164, Extension: ext}, true
+}
+
+func extractE164(s string) string {
+	if match := zone1NumberFront.FindStringSubmatch(s); match != nil {
+		return zone1E164(match[1])
+	}
+	ns := spacesDashesOnly.ReplaceAllString(s, "")
+	if ns == "" {
+		return ""
+	}
+	if match := zone1Plus1.FindStringSubmatch(ns); match != nil {
+		return zone1E164(match[1])
+	}
+	if match := zone1AreaFront.FindStringSubmatch(ns); match != nil {
+		return zone1E164(match[1])
+	}
+	if match := zone1DoubleArea.FindStringSubmatch(ns); match != nil && match[1] == match[3] {
+		return zone1E164(match[2])
+	}
+	if match := zone1AreaZipArea.FindStringSubmatch(ns); match != nil && match[1] == match[3] {
+		return zone1E164(match[2])
+	}
+	if match := zone1ZipArea.FindStringSubmatch(ns); match != nil {
+		return zone1E164(match[1])
+	}
+	if match := zone1ZipFront.FindStringSubmatch(ns); match != nil {
+		return zone1E164(match[1])
+	}
+	if match := zone1ZipDouble.FindStringSubmatch(ns); match != nil {
+		return zone1E164(match[1])
+	}
+	if match := zone1DigitsOnly.FindStringSubmatch(ns); match != nil {
+		return zone1E164(match[1])
+	}
+	if match := zone1AreaTenDigits.FindStringSubmatch(ns); match != nil {
+		return zone1E164(match[1])
+	}
+	if match := intlPlus.FindStringSubmatch(ns); match != nil {
+		return intlE164(match[1])
+	}
+	if match := intlNonPlus.FindStringSubmatch(ns); match != nil {
+		return intlE164(match[1])
+	}
+	if match := intlDialingPrefix.FindStringSubmatch(ns); match != nil {
+		return intlE164(match[1])
+	}
+	return ""
+}
+
+// zone1E164 returns the E.164 form of a matched North American number,
+// or "" if it has the wrong number of digits.
+func zone1E164(s string) string {
+	number := "+1" + nonDigitsOnly.ReplaceAllString(s, "")
+	e164, err := canonicalize(number, "US")
+	if errors.Is(err, InvalidPrefix) || errors.Is(err, NonGeographicAreaCode) {
+		return number
+	}
+	if err != nil {
+		return ""
+	}
+	return e164
+}
+
+// intlE164 returns the E.164 form of a matched international number,
+// or "" if it's not valid.  People often type a trunk prefix after the
+// country code (as in "+44 (0) 20...") or repeat the country code,
+// so those are removed.
+func intlE164(s string) string {
+	digits := strings.TrimLeft(nonDigitsOnly.ReplaceAllString(s, ""), "01")
+	c, national, ok := SplitCallingCode(digits)
+	if !ok {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(national, c.TrunkPrefix); ok && c.TrunkPrefix != "" && c.fits(rest) {
+		national = rest
+	}
+	if !c.fits(national) {
+		national = strings.TrimPrefix(national, c.CallingCode)
+	}
+	e164, err := canonicalize("+"+c.CallingCode+national, "US")
+	if err != nil {
+		return ""
+	}
+	return e164
+}
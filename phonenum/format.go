@@ -0,0 +1,52 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package phonenum
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format formats an E.164 phone number for display, grouping the digits
+// of its national number according to the conventions of its country.
+// North American numbers are shown as (NXX) NXX-XXXX, without their
+// calling code.  Anything that's not a valid E.164 number is returned as is.
+func Format(e164 string) string {
+	return FormatWith(e164, " ", "-")
+}
+
+// FormatWith is [Format] with the given separators between groups of digits:
+// space between most groups, and dash between the exchange and line number
+// of North American numbers.  (HTML, for example, wants non-breaking ones.)
+func FormatWith(e164, space, dash string) string {
+	if !strings.HasPrefix(e164, "+") || nonDigitsOnly.MatchString(e164[1:]) {
+		return e164
+	}
+	c, national, ok := SplitCallingCode(e164[1:])
+	if !ok || !c.fits(national) {
+		return e164
+	}
+	if c.CallingCode == "1" {
+		return fmt.Sprintf("(%s)%s%s%s%s", national[:3], space, national[3:6], dash, national[6:])
+	}
+	return "+" + c.CallingCode + space + strings.Join(c.group(national), space)
+}
+
+// Format formats the number for display, as with the package [Format],
+// followed by its extension (if any) as " x123".
+func (n Number) Format() string {
+	return n.FormatWith(" ", "-")
+}
+
+// FormatWith formats the number for display, as with the package [FormatWith],
+// followed by its extension (if any) as " x123", using the given space.
+func (n Number) FormatWith(space, dash string) string {
+	if n.Extension == "" {
+		return FormatWith(n.E164, space, dash)
+	}
+	return FormatWith(n.E164, space, dash) + space + "x" + n.Extension
+}
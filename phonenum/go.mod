@@ -0,0 +1,3 @@
+module github.com/clickonetwo/automations/phonenum
+
+go 1.23.2
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+// Package phonenum parses, validates, and formats phone numbers.
+//
+// It's shared by the Dialpad tools and the Airtable migration, so that
+// both agree on what a valid number is and how it's written.  Numbers are
+// kept in E.164 format, with an optional extension alongside.
+package phonenum
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	NoContent              = errors.New("no content")
+	TooFewDigits           = errors.New("too few digits")
+	TooManyDigits          = errors.New("too many digits")
+	InvalidPrefix          = errors.New("invalid prefix (starts with 0 or 1)")
+	NonGeographicAreaCode  = errors.New("non-geographic area code")
+	UnknownCountryCode     = errors.New("unknown country code")
+	nonGeographicAreaCodes = map[string]bool{
+		"500": true, "511": true,
+		"521": true, "522": true, "523": true, "524": true, "525": true, "526": true, "527": true, "528": true, "529": true,
+		"532": true, "533": true, "535": true, "538": true,
+		"542": true, "543": true, "544": true, "545": true, "546": true, "547": true, "549": true,
+		"550": true, "552": true, "553": true, "554": true, "555": true, "556": true, "558": true,
+		"566": true, "569": true,
+		"576": true, "577": true, "578": true, "588": true, "589": true,
+	}
+	nonDigitsOnly = regexp.MustCompile(`\D+`)
+	extension     = regexp.MustCompile(`(?i)(?:;\s*ext\s*=|\s*(?:ext(?:ension)?\.?|x|#)\s*:?|\s*,+)\s*(\d{1,7})\s*$`)
+)
+
+// A Number is a phone number in E.164 format, with an optional extension.
+type Number struct {
+	E164      string
+	Extension string
+}
+
+// String returns the number as an E.164 number followed, if there's
+// an extension, by an RFC 3966 extension parameter (";ext=123").
+func (n Number) String() string {
+	if n.Extension == "" {
+		return n.E164
+	}
+	return n.E164 + ";ext=" + n.Extension
+}
+
+// ParseString is the inverse of [Number.String].
+func ParseString(s string) Number {
+	e164, ext, _ := strings.Cut(s, ";ext=")
+	return Number{E164: e164, Extension: ext}
+}
+
+// SplitExtension splits a trailing extension from a phone number.  Extensions
+// are introduced by "x", "ext", "ext.", "extension", "#", ";ext=", or by one
+// or more commas (which phones dial as pauses before the extension).
+func SplitExtension(s string) (number, ext string) {
+	if loc := extension.FindStringSubmatchIndex(s); loc != nil {
+		return strings.TrimSpace(s[:loc[0]]), s[loc[2]:loc[3]]
+	}
+	return strings.TrimSpace(s), ""
+}
+
+// Parse validates a phone number, which may have an extension, and returns it
+// in canonical form.  Numbers without an international prefix are taken to
+// be in the given region (an ISO 3166 code such as "US").  See [Canonicalize]
+// for the rules.
+func Parse(s, region string) (Number, error) {
+	number, ext := SplitExtension(s)
+	e164, err := canonicalize(number, region)
+	if err != nil {
+		return Number{}, err
+	}
+	return Number{E164: e164, Extension: ext}, nil
+}
+
+// Canonicalize validates a phone number and returns it in E.164 format.
+// Any extension is dropped; use [Parse] to keep it.
+//
+// The canonicalization is intended to make the number acceptable to Dialpad, so
+// it's based on experience with what Dialpad will accept.  Here are the steps:
+//
+//  1. Non-numeric characters other than a leading '+' are removed.
+//  2. An initial international prefix (011 in North America, 00 elsewhere)
+//     is replaced with '+'.
+//  3. A number with no '+' is taken to be a national number in the region
+//     if it fits that region's length rules (after removing any trunk prefix),
+//     and is otherwise taken to be international if it's too long to be national.
+//  4. The country calling code is identified from the [Countries] table, and
+//     numbers with unknown calling codes are rejected.
+//  5. Numbers with too few or too many digits for their country are rejected.
+//  6. If a North American number, after the area code, has a prefix starting with "0" or "1"
+//     (such as `510-123-4567`), it's rejected because North American prefixes can't start
+//     with either of those numbers.  (This typically means it's an international number
+//     that has not been prefixed correctly with a '+'.)
+//  7. If a North American number has one of the "non-geographic" (aka 5XX) area codes
+//     that are reserved for machine-to-machine communication,
+//     Dialpad will not accept it, so it is rejected.
+func Canonicalize(s, region string) (string, error) {
+	n, err := Parse(s, region)
+	return n.E164, err
+}
+
+func canonicalize(s, region string) (string, error) {
+	number := strings.TrimSpace(s)
+	digits := nonDigitsOnly.ReplaceAllString(number, "")
+	if digits == "" {
+		return "", NoContent
+	}
+	home, ok := CountryForRegion(region)
+	if !ok {
+		return "", fmt.Errorf("unknown region %q", region)
+	}
+	switch {
+	case strings.HasPrefix(number, "+"):
+	case home.CallingCode == "1" && strings.HasPrefix(digits, "011"):
+		digits = digits[3:]
+	case home.CallingCode != "1" && strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case home.TrunkPrefix != "" && strings.HasPrefix(digits, home.TrunkPrefix) && home.fits(digits[len(home.TrunkPrefix):]):
+		digits = home.CallingCode + digits[len(home.TrunkPrefix):]
+	case len(digits) <= home.MaxDigits:
+		digits = home.CallingCode + digits
+	}
+	country, national, ok := SplitCallingCode(digits)
+	if !ok {
+		return "", fmt.Errorf("%w: %q", UnknownCountryCode, s)
+	}
+	if len(national) < country.MinDigits {
+		return "", fmt.Errorf("%w: %q", TooFewDigits, s)
+	}
+	if len(national) > country.MaxDigits {
+		return "", fmt.Errorf("%w: %q", TooManyDigits, s)
+	}
+	if country.CallingCode == "1" {
+		if national[3] == '0' || national[3] == '1' {
+			return "", fmt.Errorf("%w: %q", InvalidPrefix, s)
+		}
+		if nonGeographicAreaCodes[national[0:3]] {
+			return "", fmt.Errorf("%w: %q", NonGeographicAreaCode, s)
+		}
+	}
+	return "+" + digits, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+package phonenum
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/clickonetwo/automations/phonenum/phonetest"
+)
+
+func TestCountryTable(t *testing.T) {
+	for i, c := range Countries {
+		if c.MinDigits > c.MaxDigits || len(c.Regions) == 0 {
+			t.Errorf("bad country entry: %v", c)
+		}
+		for _, o := range Countries[i+1:] {
+			if strings.HasPrefix(o.CallingCode, c.CallingCode) || strings.HasPrefix(c.CallingCode, o.CallingCode) {
+				t.Errorf("calling codes %s and %s overlap", c.CallingCode, o.CallingCode)
+			}
+		}
+	}
+	if !IsRegion("gb") || IsRegion("001") || IsRegion("ZZ") {
+		t.Errorf("IsRegion is wrong")
+	}
+	if region := RegionOf("+447700900123"); region != "GB" {
+		t.Errorf("RegionOf = %q, expected GB", region)
+	}
+}
+
+func TestCorpusParse(t *testing.T) {
+	for _, test := range phonetest.Load().Canonicalize {
+		n, err := Parse(test.Input, test.Region)
+		if test.Error != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.Error) {
+				t.Errorf("%s %q: expected error %q, got %v (%v)", test.Region, test.Input, test.Error, n, err)
+			}
+		} else if err != nil || n.E164 != test.E164 || n.Extension != test.Ext {
+			t.Errorf("%s %q: expected %s x%s, got %v (%v)", test.Region, test.Input, test.E164, test.Ext, n, err)
+		}
+	}
+	if _, err := Canonicalize("(500) 555-1234", "US"); !errors.Is(err, NonGeographicAreaCode) {
+		t.Errorf("expected a NonGeographicAreaCode error, got %v", err)
+	}
+}
+
+func TestCorpusExtract(t *testing.T) {
+	for _, test := range phonetest.Load().Extract {
+		n, ok := Extract(test.Input)
+		if ok != (test.E164 != "") || n.E164 != test.E164 || n.Extension != test.Ext {
+			t.Errorf("Extract(%q) = %v, %v; expected %q x%q", test.Input, n, ok, test.E164, test.Ext)
+		}
+	}
+}
+
+func TestCorpusFormat(t *testing.T) {
+	for _, test := range phonetest.Load().Format {
+		n := Number{E164: test.E164, Extension: test.Ext}
+		if display := n.Format(); display != test.Display {
+			t.Errorf("Format(%v) = %q, expected %q", n, display, test.Display)
+		}
+	}
+	if display := FormatWith("+15105551234", "&nbsp;", "&#8209;"); display != "(510)&nbsp;555&#8209;1234" {
+		t.Errorf("FormatWith = %q", display)
+	}
+}
+
+func TestNumberString(t *testing.T) {
+	n := Number{E164: "+15105551234", Extension: "22"}
+	if s := n.String(); s != "+15105551234;ext=22" {
+		t.Errorf("String = %q", s)
+	}
+	if p := ParseString(n.String()); p != n {
+		t.Errorf("ParseString = %v", p)
+	}
+	if p := ParseString("+15105551234"); p.Extension != "" {
+		t.Errorf("ParseString = %v", p)
+	}
+}
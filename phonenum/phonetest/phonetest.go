@@ -0,0 +1,61 @@
+/*
+ * Copyright 2024 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * open source MIT License, reproduced in the LICENSE file.
+ */
+
+// Package phonetest provides the corpus of phone number test cases
+// shared by the tests of phonenum and of the tools that use it.
+//
+// The cases started as the phone numbers that the Airtable migration's
+// cleanup had to handle, and each tool's tests check that the tool treats
+// them the same way the library does.
+package phonetest
+
+import (
+	_ "embed"
+	"encoding/json"
+)
+
+//go:embed corpus.json
+var corpusJson []byte
+
+// An ExtractCase is messy input, and the number (if any) that should be found in it.
+type ExtractCase struct {
+	Input string `json:"input"`
+	E164  string `json:"e164"`
+	Ext   string `json:"ext"`
+}
+
+// A CanonicalizeCase is input in a default region, and either its canonical
+// form or the message of the error that's expected.
+type CanonicalizeCase struct {
+	Region string `json:"region"`
+	Input  string `json:"input"`
+	E164   string `json:"e164"`
+	Ext    string `json:"ext"`
+	Error  string `json:"error"`
+}
+
+// A FormatCase is a number and its display form.
+type FormatCase struct {
+	E164    string `json:"e164"`
+	Ext     string `json:"ext"`
+	Display string `json:"display"`
+}
+
+// The Corpus is all the test cases.
+type Corpus struct {
+	Extract      []ExtractCase      `json:"extract"`
+	Canonicalize []CanonicalizeCase `json:"canonicalize"`
+	Format       []FormatCase       `json:"format"`
+}
+
+// Load returns the corpus.
+func Load() Corpus {
+	var c Corpus
+	if err := json.Unmarshal(corpusJson, &c); err != nil {
+		panic(err)
+	}
+	return c
+}